@@ -15,6 +15,10 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 			"environment": app.config.env,
 			"version":     version,
 		},
+		"storage": map[string]string{
+			"sync":          app.config.storage.sync,
+			"sync_interval": app.config.storage.syncInterval.String(),
+		},
 	}
 
 	// Add a 4 second delay.
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/hex"
 	"expvar"
 	"flag"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/abdulmajid18/keyVal/key_value/internal/data"
 	"github.com/abdulmajid18/keyVal/key_value/internal/mailer"
+	"github.com/abdulmajid18/keyVal/key_value/internal/storage"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -26,6 +28,7 @@ type Config struct {
 	smtp    smtp
 	cors    cors
 	limiter limiter
+	storage storageConfig
 }
 type smtp struct {
 	host     string
@@ -63,6 +66,21 @@ type limiter struct {
 	enabled bool
 }
 
+// Add a storageConfig struct holding the settings used when opening the key-value database
+// files of each user.
+type storageConfig struct {
+	dir          string
+	maxOpen      int
+	idleTimeout  time.Duration
+	compression  string
+	masterKey    string
+	mmap         bool
+	cacheSize    int
+	sync         string
+	syncInterval time.Duration
+	lockTimeout  time.Duration
+}
+
 func getDataBaseEnvVariables() string {
 	role := "ROLE"
 	password := "PASSWORD"
@@ -160,16 +178,69 @@ func main() {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
+	// Read where the key-value databases live and how many of them stay open between
+	// requests.
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "/home/rozz/Desktop/database", "Directory holding the key-value database files")
+	flag.IntVar(&cfg.storage.maxOpen, "storage-max-open", 64, "Maximum number of database files kept open")
+	flag.DurationVar(&cfg.storage.idleTimeout, "storage-idle-timeout", 5*time.Minute, "Close database files unused for this long")
+
+	// Read the page compression codec used for newly created key-value databases.
+	flag.StringVar(&cfg.storage.compression, "storage-compression", "none", "Page compression for new databases (none|flate)")
+	// The hex encoded master key wrapping the data key of every encrypted database. It
+	// defaults to the STORAGE_MASTER_KEY environment variable, when empty new databases
+	// are created in plaintext.
+	flag.StringVar(&cfg.storage.masterKey, "storage-master-key", os.Getenv("STORAGE_MASTER_KEY"), "Hex encoded storage master key")
+	flag.BoolVar(&cfg.storage.mmap, "storage-mmap", false, "Serve database reads from a memory mapping of the file")
+	flag.IntVar(&cfg.storage.cacheSize, "storage-cache-size", storage.DefaultCacheSize, "Decoded blocks cached per open database (0 disables the cache)")
+	// Choose how writes are made durable before "Created Successfully!" is sent: sync the
+	// file on every write, group the syncs of concurrent writes every interval, or leave
+	// flushing to the operating system.
+	flag.StringVar(&cfg.storage.sync, "storage-sync", "always", "Database durability (always|interval|none)")
+	flag.DurationVar(&cfg.storage.syncInterval, "storage-sync-interval", storage.DefaultSyncInterval, "Group commit interval for -storage-sync=interval")
+	flag.DurationVar(&cfg.storage.lockTimeout, "storage-lock-timeout", storage.DefaultLockTimeout, "How long to wait for a database file locked by another process")
+
 	flag.Parse()
 
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
+	storageOptions := storage.Options{
+		Compression:  cfg.storage.compression,
+		Mmap:         cfg.storage.mmap,
+		CacheSize:    cfg.storage.cacheSize,
+		Sync:         cfg.storage.sync,
+		SyncInterval: cfg.storage.syncInterval,
+		LockTimeout:  cfg.storage.lockTimeout,
+	}
+	if cfg.storage.masterKey != "" {
+		masterKey, err := hex.DecodeString(cfg.storage.masterKey)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		storageOptions.MasterKey = masterKey
+	}
+	if err := storageOptions.Validate(); err != nil {
+		logger.Fatal(err)
+	}
+
 	db, err := openDB(cfg.db)
 	if err != nil {
 		log.
 			Fatal(err)
 	}
 
+	// Each database is opened with the engine its owner picked when registering.
+	err = data.ConfigureStorage(data.StorageConfig{
+		Dir:         cfg.storage.dir,
+		MaxOpen:     cfg.storage.maxOpen,
+		IdleTimeout: cfg.storage.idleTimeout,
+		Options:     storageOptions,
+		EngineFor:   data.UserModel{DB: db}.EngineFor,
+		ErrorLog:    logger,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	// Publish the number of active goroutines.
 	expvar.Publish("goroutines", expvar.Func(func() interface{} {
 		return runtime.NumGoroutine()
@@ -178,6 +249,14 @@ func main() {
 	expvar.Publish("database", expvar.Func(func() interface{} {
 		return db.Stats()
 	}))
+	// Publish the number of key-value database files held open.
+	expvar.Publish("storage_handles", expvar.Func(func() interface{} {
+		return data.StorageStats()
+	}))
+	// Publish the page compression counters of the open key-value databases.
+	expvar.Publish("storage_compression", expvar.Func(func() interface{} {
+		return data.StorageCompression()
+	}))
 	// Publish the current Unix timestamp.
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
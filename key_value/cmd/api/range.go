@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/abdulmajid18/keyVal/key_value/internal/data"
+	"github.com/abdulmajid18/keyVal/key_value/internal/validator"
+	"github.com/gorilla/mux"
+)
+
+// deleteRangeHandler removes the keys in [start, end) of a database, both taken from the
+// query string. An empty end removes every key from start on.
+func (app *application) deleteRangeHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	// Only the owner of the database may wipe part of it.
+	user := app.contextGetUser(r)
+	if user.DbName != name {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	start, end := query.Get("start"), query.Get("end")
+	v := validator.New()
+	v.Check(start == "" && end == "", "range", "start or end must be provided")
+	v.Check(end != "" && end <= start, "end", "must sort after start")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	removed, err := data.DeleteRange(name, start, end)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"deleted": removed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
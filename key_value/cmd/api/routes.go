@@ -17,6 +17,8 @@ func (app *application) routes() http.Handler {
 	router.HandleFunc("/v1/tokens/authentication", app.createAuthenticationTokenHandler).Methods("POST")
 	router.HandleFunc("/v1/put/{secret_key}", app.requirePermission("key_val:read", app.PutHandler)).Methods("POST")
 	router.HandleFunc("/v1/get/{secret_key}", app.requirePermission("key_val:write", app.GetHandler)).Methods("POST")
+	router.HandleFunc("/v1/databases/{name}/stats", app.requireActivatedUser(app.databaseStatsHandler)).Methods("GET")
+	router.HandleFunc("/v1/databases/{name}/keys", app.requireActivatedUser(app.deleteRangeHandler)).Methods("DELETE")
 	router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 	return app.metrics(app.recoverPanic(app.rateLimit(app.enableCORS((app.authenticate(router))))))
 }
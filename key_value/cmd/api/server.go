@@ -9,6 +9,8 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/internal/data"
 )
 
 func (app *application) serve() error {
@@ -78,6 +80,13 @@ func (app *application) serve() error {
 		return err
 	}
 
+	// No request is using the key-value databases anymore, close them so pending writes
+	// are flushed and the file locks released.
+	err = data.CloseStorage()
+	if err != nil {
+		return err
+	}
+
 	// At this point we know that the graceful shutdown completed successfully and we
 	// log a "stopped server" message.
 	app.logger.Println("stopped server", map[string]string{
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/abdulmajid18/keyVal/key_value/internal/data"
+	"github.com/gorilla/mux"
+)
+
+func (app *application) databaseStatsHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	// Users may only look at their own database.
+	user := app.contextGetUser(r)
+	if user.DbName != name {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	stats, err := data.DatabaseStats(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/abdulmajid18/keyVal/key_value/internal/data"
+	"github.com/abdulmajid18/keyVal/key_value/internal/storage"
 	"github.com/abdulmajid18/keyVal/key_value/internal/validator"
 )
 
@@ -15,6 +16,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		UserName string `json:"username"`
 		Email    string `json:"email"`
 		DbName   string `json:"dbname"`
+		Engine   string `json:"engine"`
 		Password string `json:"password"`
 	}
 
@@ -33,8 +35,13 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		UserName:  input.UserName,
 		Email:     input.Email,
 		DbName:    input.DbName,
+		Engine:    input.Engine,
 		Activated: false,
 	}
+	// The storage engine of the database is picked once, when the user registers.
+	if user.Engine == "" {
+		user.Engine = storage.Default
+	}
 
 	err = user.Password.Set(input.Password)
 	if err != nil {
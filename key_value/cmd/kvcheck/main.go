@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+func main() {
+	path := flag.String("db", "", "Path of the database file to check")
+	masterKey := flag.String("key", os.Getenv("STORAGE_MASTER_KEY"), "Hex encoded master key of an encrypted file")
+	repairTo := flag.String("repair", "", "Salvage the pairs of a damaged file into a new file at this path instead of checking it")
+	flag.Parse()
+
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var opts []helper.Option
+	if *masterKey != "" {
+		key, err := hex.DecodeString(*masterKey)
+		if err != nil {
+			log.Fatalf("key must be hex encoded: %v", err)
+		}
+		opts = append(opts, helper.WithEncryptionKey(key))
+	}
+
+	// Reports go to stdout as JSON and the exit status tells scripts whether the file is
+	// healthy.
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+
+	if *repairTo != "" {
+		report, err := helper.Repair(*path, *repairTo, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	report, err := helper.Check(*path, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
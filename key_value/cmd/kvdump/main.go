@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+func main() {
+	path := flag.String("db", "", "Path of the database file to dump")
+	format := flag.String("format", "json", "Output format (json|dot)")
+	masterKey := flag.String("key", os.Getenv("STORAGE_MASTER_KEY"), "Hex encoded master key of an encrypted file")
+	flag.Parse()
+
+	if *path == "" || (*format != "json" && *format != "dot") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Open read-only with a shared lock, the file can be dumped while it is being served.
+	opts := []helper.Option{helper.WithReadOnly()}
+	if *masterKey != "" {
+		key, err := hex.DecodeString(*masterKey)
+		if err != nil {
+			log.Fatalf("key must be hex encoded: %v", err)
+		}
+		opts = append(opts, helper.WithEncryptionKey(key))
+	}
+	db, err := helper.Open(*path, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if *format == "dot" {
+		err = db.DumpDOT(os.Stdout)
+	} else {
+		err = db.DumpJSON(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+// decodeKey turns a hex encoded master key into bytes. An empty string means the file is
+// (or should become) plaintext.
+func decodeKey(name, value string) []byte {
+	if value == "" {
+		return nil
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		log.Fatalf("%s must be hex encoded: %v", name, err)
+	}
+	return key
+}
+
+func main() {
+	// The master keys default to environment variables so they don't have to show up in
+	// the process list. STORAGE_MASTER_KEY is the variable read by the API server.
+	path := flag.String("db", "", "Path of the database file to re-encrypt")
+	oldKey := flag.String("old-key", os.Getenv("STORAGE_MASTER_KEY"), "Current hex encoded master key (empty for a plaintext file)")
+	newKey := flag.String("new-key", os.Getenv("STORAGE_NEW_MASTER_KEY"), "New hex encoded master key (empty to decrypt the file)")
+	flag.Parse()
+
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := helper.RotateKey(*path, decodeKey("old-key", *oldKey), decodeKey("new-key", *newKey))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("re-encrypted %s", *path)
+}
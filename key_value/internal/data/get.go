@@ -18,10 +18,11 @@ func ValidateGetData(v *validator.Validator, data *GetData) {
 }
 
 func Get(data GetData) (string, bool, error) {
-	db, err := OpenDB(data.DbName)
+	db, release, err := storageHandles().Acquire(data.DbName)
 	if err != nil {
 		return "", false, err
 	}
+	defer release()
 	value, state, err := db.Get(data.Key)
 	if err != nil {
 		return "", false, err
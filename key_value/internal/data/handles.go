@@ -0,0 +1,399 @@
+package data
+
+import (
+	"container/list"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/internal/storage"
+)
+
+var ErrStorageClosed = errors.New("storage has been shut down")
+
+// StorageConfig describes where the key-value database of each user lives, how it is
+// opened and how many of them are kept open at once.
+type StorageConfig struct {
+	Dir         string
+	MaxOpen     int
+	IdleTimeout time.Duration
+	Options     storage.Options
+	// EngineFor returns the engine a database was created with, databases use
+	// storage.Default when it is nil.
+	EngineFor func(dbname string) (string, error)
+	// ErrorLog receives the errors of databases closed in the background, the standard
+	// logger when it is nil.
+	ErrorLog *log.Logger
+}
+
+// HandleStats holds the counters published for the handle manager.
+type HandleStats struct {
+	Open    int   `json:"open"`
+	InUse   int   `json:"in_use"`
+	Opened  int64 `json:"opened_total"`
+	Evicted int64 `json:"evicted_total"`
+	// CloseErrors counts the evicted databases that failed to close, their last writes
+	// may not have reached the disk.
+	CloseErrors int64 `json:"close_errors_total"`
+}
+
+// handle is one open database along with the number of requests currently using it.
+type handle struct {
+	name string
+	db   storage.Engine
+	err  error
+	// pinned handles hold engines that lose their data when closed, they are never evicted
+	pinned   bool
+	ready    chan struct{}
+	refs     int
+	lastUsed time.Time
+	elem     *list.Element
+	// closed is closed once an evicted handle closed its database, so reopening it waits
+	// for its file locks
+	closed chan struct{}
+}
+
+// HandleManager keeps the databases of the tenants open between requests. Handles are
+// reference counted while a request uses them, and idle ones are closed least recently
+// used first once more than MaxOpen are open, or when they have not been used for
+// IdleTimeout. Databases are closed without holding the lock, a slow sync of one of them
+// doesn't hold up requests for the others.
+type HandleManager struct {
+	cfg StorageConfig
+
+	mu      sync.Mutex
+	handles map[string]*handle
+	// closing holds the evicted handles still closing their database
+	closing     map[string]*handle
+	lru         *list.List
+	opened      int64
+	evicted     int64
+	closeErrors int64
+	closed      bool
+	stop        chan struct{}
+	// released is signaled whenever a handle is no longer in use
+	released *sync.Cond
+}
+
+func NewHandleManager(cfg StorageConfig) *HandleManager {
+	m := &HandleManager{
+		cfg:     cfg,
+		handles: make(map[string]*handle),
+		closing: make(map[string]*handle),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+	m.released = sync.NewCond(&m.mu)
+	if m.cfg.ErrorLog == nil {
+		m.cfg.ErrorLog = log.Default()
+	}
+	// Launch a background goroutine which closes databases nobody used for a while, in
+	// the same way the rate limiter forgets clients.
+	if cfg.IdleTimeout > 0 {
+		go m.closeIdleHandles()
+	}
+	return m
+}
+
+func (m *HandleManager) engineFor(dbname string) (string, error) {
+	if m.cfg.EngineFor == nil {
+		return storage.Default, nil
+	}
+	return m.cfg.EngineFor(dbname)
+}
+
+// exists reports whether the database of dbname is open or was created before.
+func (m *HandleManager) exists(dbname string) (bool, error) {
+	m.mu.Lock()
+	_, open := m.handles[dbname]
+	m.mu.Unlock()
+	if open {
+		return true, nil
+	}
+	engine, err := m.engineFor(dbname)
+	if err != nil {
+		return false, err
+	}
+	return storage.Exists(engine, storage.Path(m.cfg.Dir, dbname)), nil
+}
+
+// Acquire returns the open database for dbname, opening it on first use. The returned
+// release function must be called once the caller is done with the database.
+func (m *HandleManager) Acquire(dbname string) (storage.Engine, func(), error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, nil, ErrStorageClosed
+	}
+	h, found := m.handles[dbname]
+	if found {
+		h.refs++
+		m.mu.Unlock()
+		// Another request may still be opening the file.
+		<-h.ready
+		if h.err != nil {
+			m.release(h)
+			return nil, nil, h.err
+		}
+		return h.db, func() { m.release(h) }, nil
+	}
+
+	// Open the file without holding the lock, waiting on a file locked by another
+	// process must not hold up requests for other databases.
+	h = &handle{name: dbname, refs: 1, ready: make(chan struct{})}
+	m.handles[dbname] = h
+	previous := m.closing[dbname]
+	m.mu.Unlock()
+
+	if previous != nil {
+		<-previous.closed
+	}
+	engine, err := m.engineFor(dbname)
+	var db storage.Engine
+	if err == nil {
+		db, err = storage.Open(engine, storage.Path(m.cfg.Dir, dbname), m.cfg.Options)
+	}
+
+	m.mu.Lock()
+	h.db, h.err = db, err
+	h.pinned = err == nil && !storage.Persistent(engine)
+	if err != nil {
+		delete(m.handles, dbname)
+	} else {
+		m.opened++
+		h.elem = m.lru.PushFront(h)
+	}
+	close(h.ready)
+	m.mu.Unlock()
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() { m.release(h) }, nil
+}
+
+func (m *HandleManager) release(h *handle) {
+	m.mu.Lock()
+	h.refs--
+	h.lastUsed = time.Now()
+	if h.refs == 0 {
+		m.released.Broadcast()
+	}
+	if h.elem != nil && !m.closed {
+		m.lru.MoveToFront(h.elem)
+	}
+	evicted := m.evictOverflow()
+	m.mu.Unlock()
+	m.closeEvicted(evicted)
+}
+
+// evictOverflow forgets the least recently used idle handles until no more than MaxOpen
+// are open, and returns them to be closed. Must be called with the lock held.
+func (m *HandleManager) evictOverflow() []*handle {
+	if m.cfg.MaxOpen <= 0 || m.closed {
+		return nil
+	}
+	var evicted []*handle
+	for e := m.lru.Back(); e != nil && m.lru.Len() > m.cfg.MaxOpen; {
+		prev := e.Prev()
+		h := e.Value.(*handle)
+		if h.refs == 0 && !h.pinned {
+			m.evict(h)
+			evicted = append(evicted, h)
+		}
+		e = prev
+	}
+	return evicted
+}
+
+// evict forgets the handle, which closeEvicted closes once the lock is released. Must be
+// called with the lock held.
+func (m *HandleManager) evict(h *handle) {
+	m.lru.Remove(h.elem)
+	delete(m.handles, h.name)
+	h.closed = make(chan struct{})
+	m.closing[h.name] = h
+	m.evicted++
+}
+
+// closeEvicted closes the databases of the evicted handles. Must be called without the
+// lock held.
+func (m *HandleManager) closeEvicted(evicted []*handle) {
+	for _, h := range evicted {
+		err := h.db.Close()
+		m.mu.Lock()
+		if m.closing[h.name] == h {
+			delete(m.closing, h.name)
+		}
+		if err != nil {
+			m.closeErrors++
+		}
+		m.mu.Unlock()
+		close(h.closed)
+		if err != nil {
+			m.cfg.ErrorLog.Printf("closing the database %s: %v", h.name, err)
+		}
+	}
+}
+
+func (m *HandleManager) closeIdleHandles() {
+	ticker := time.NewTicker(m.cfg.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			var evicted []*handle
+			m.mu.Lock()
+			for e := m.lru.Back(); e != nil; {
+				prev := e.Prev()
+				h := e.Value.(*handle)
+				if h.refs == 0 && !h.pinned && time.Since(h.lastUsed) > m.cfg.IdleTimeout {
+					m.evict(h)
+					evicted = append(evicted, h)
+				}
+				e = prev
+			}
+			m.mu.Unlock()
+			m.closeEvicted(evicted)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Stats returns the current handle counts.
+func (m *HandleManager) Stats() HandleStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := HandleStats{Open: m.lru.Len(), Opened: m.opened, Evicted: m.evicted, CloseErrors: m.closeErrors}
+	for e := m.lru.Front(); e != nil; e = e.Next() {
+		if e.Value.(*handle).refs > 0 {
+			stats.InUse++
+		}
+	}
+	return stats
+}
+
+// Compression returns the page compression counters of the open databases that compress
+// their pages, by database name.
+func (m *HandleManager) Compression() map[string]storage.CompressionStats {
+	m.mu.Lock()
+	open := make(map[string]storage.Engine, m.lru.Len())
+	for e := m.lru.Front(); e != nil; e = e.Next() {
+		h := e.Value.(*handle)
+		open[h.name] = h.db
+	}
+	m.mu.Unlock()
+	// Read without the lock, a database evicted meanwhile is closed and left out
+	stats := make(map[string]storage.CompressionStats)
+	for name, db := range open {
+		if compression, ok := storage.Compression(db); ok {
+			stats[name] = compression
+		}
+	}
+	return stats
+}
+
+// Close closes every open database, flushing their pending writes. It is meant to run
+// once the HTTP server has stopped handing out requests, new requests are refused and the
+// ones still using a database are waited for.
+func (m *HandleManager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.stop)
+	for m.inUse() {
+		m.released.Wait()
+	}
+	open := make([]*handle, 0, m.lru.Len())
+	for e := m.lru.Front(); e != nil; e = e.Next() {
+		open = append(open, e.Value.(*handle))
+	}
+	closing := make([]*handle, 0, len(m.closing))
+	for _, h := range m.closing {
+		closing = append(closing, h)
+	}
+	m.lru.Init()
+	m.handles = make(map[string]*handle)
+	m.mu.Unlock()
+
+	var err error
+	for _, h := range open {
+		if closeErr := h.db.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	// Evictions still closing in the background must be done once Close returns
+	for _, h := range closing {
+		<-h.closed
+	}
+	return err
+}
+
+// inUse reports whether a request still uses or is opening a database. Must be called
+// with the lock held.
+func (m *HandleManager) inUse() bool {
+	for _, h := range m.handles {
+		if h.refs > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Options returns the options the databases are opened with.
+func (m *HandleManager) Options() storage.Options {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg.Options
+}
+
+var (
+	// handlesMu guards the swap of the process wide handle manager by ConfigureStorage.
+	handlesMu sync.RWMutex
+	// handles is the process wide handle manager used by Insert and Get, read it through
+	// storageHandles.
+	handles = NewHandleManager(StorageConfig{
+		Dir:         "/home/rozz/Desktop/database",
+		MaxOpen:     64,
+		IdleTimeout: 5 * time.Minute,
+		Options:     storage.DefaultOptions(),
+	})
+)
+
+// storageHandles returns the process wide handle manager.
+func storageHandles() *HandleManager {
+	handlesMu.RLock()
+	defer handlesMu.RUnlock()
+	return handles
+}
+
+// ConfigureStorage replaces the process wide handle manager, closing the databases held
+// by the previous one.
+func ConfigureStorage(cfg StorageConfig) error {
+	handlesMu.Lock()
+	previous := handles
+	handles = NewHandleManager(cfg)
+	handlesMu.Unlock()
+	return previous.Close()
+}
+
+// CloseStorage closes every open tenant database.
+func CloseStorage() error {
+	return storageHandles().Close()
+}
+
+// StorageStats returns the handle counts of the process wide handle manager.
+func StorageStats() HandleStats {
+	return storageHandles().Stats()
+}
+
+// StorageCompression returns the page compression counters of the databases open in the
+// process wide handle manager.
+func StorageCompression() map[string]storage.CompressionStats {
+	return storageHandles().Compression()
+}
@@ -0,0 +1,257 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/internal/storage"
+	"github.com/abdulmajid18/keyVal/key_value/internal/validator"
+)
+
+// testEngine counts how often the databases of the tests are opened and closed, closing
+// one named in failClose fails.
+const testEngine = "handles-test"
+
+var (
+	testMu     sync.Mutex
+	opens      = make(map[string]int)
+	closes     = make(map[string]int)
+	failClose  = make(map[string]bool)
+	errClosing = errors.New("sync failed")
+)
+
+type countingEngine struct {
+	storage.Engine
+	path string
+}
+
+func (e *countingEngine) Close() error {
+	testMu.Lock()
+	defer testMu.Unlock()
+	closes[e.path]++
+	if failClose[e.path] {
+		return errClosing
+	}
+	return e.Engine.Close()
+}
+
+func init() {
+	storage.Register(testEngine, storage.Driver{
+		Open: func(path string, opts storage.Options) (storage.Engine, error) {
+			testMu.Lock()
+			defer testMu.Unlock()
+			opens[path]++
+			return &countingEngine{Engine: storage.NewMemory(), path: path}, nil
+		},
+		Exists:     func(string) bool { return false },
+		Persistent: true,
+	})
+}
+
+func counts(m *HandleManager, dbname string) (int, int) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	path := storage.Path(m.cfg.Dir, dbname)
+	return opens[path], closes[path]
+}
+
+func newTestManager(t *testing.T, maxOpen int, errorLog *log.Logger) *HandleManager {
+	return NewHandleManager(StorageConfig{
+		Dir:      t.TempDir(),
+		MaxOpen:  maxOpen,
+		ErrorLog: errorLog,
+		EngineFor: func(dbname string) (string, error) {
+			if strings.HasPrefix(dbname, "memory") {
+				return storage.Memory, nil
+			}
+			return testEngine, nil
+		},
+	})
+}
+
+func TestAcquireSharesHandles(t *testing.T) {
+	m := newTestManager(t, 8, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, release, err := m.Acquire("shared")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+			if err := db.Put("key", "value"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if opened, _ := counts(m, "shared"); opened != 1 {
+		t.Error("Concurrent requests should share a single open database", opened)
+	}
+	if stats := m.Stats(); stats.Open != 1 || stats.InUse != 0 {
+		t.Error("Every request should have released the handle", stats)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, closed := counts(m, "shared"); closed != 1 {
+		t.Error("Close should close the database once", closed)
+	}
+	if _, _, err := m.Acquire("shared"); err != ErrStorageClosed {
+		t.Error("A closed manager should refuse requests", err)
+	}
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	var logged bytes.Buffer
+	m := newTestManager(t, 2, log.New(&logged, "", 0))
+	defer m.Close()
+	testMu.Lock()
+	failClose[storage.Path(m.cfg.Dir, "db-0")] = true
+	testMu.Unlock()
+
+	// The pinned memory database doesn't count as evictable
+	_, releaseMemory, err := m.Acquire("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseMemory()
+	for i := 0; i < 3; i++ {
+		_, release, err := m.Acquire(fmt.Sprintf("db-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if _, closed := counts(m, "db-0"); closed != 1 {
+		t.Error("The least recently used database should be closed", closed)
+	}
+	if _, closed := counts(m, "db-2"); closed != 0 {
+		t.Error("The most recently used database should stay open", closed)
+	}
+	stats := m.Stats()
+	if stats.Open != 2 || stats.Evicted != 2 || stats.CloseErrors != 1 {
+		t.Error("Unexpected counts after evicting", stats)
+	}
+	if !strings.Contains(logged.String(), "db-0") || !strings.Contains(logged.String(), errClosing.Error()) {
+		t.Error("A failed close should be logged", logged.String())
+	}
+
+	// A database in use is never evicted, reopening an evicted one opens it again
+	_, release, err := m.Acquire("db-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dbname := range []string{"db-0", "db-1"} {
+		_, releaseOther, err := m.Acquire(dbname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releaseOther()
+	}
+	if _, closed := counts(m, "db-2"); closed != 0 {
+		t.Error("A database in use should not be evicted", closed)
+	}
+	release()
+	if opened, _ := counts(m, "db-0"); opened != 2 {
+		t.Error("An evicted database should be opened again", opened)
+	}
+}
+
+func TestCloseWaitsForRequests(t *testing.T) {
+	m := newTestManager(t, 8, nil)
+	_, release, err := m.Acquire("busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- m.Close()
+	}()
+	select {
+	case <-done:
+		t.Fatal("Close should wait for the request using the database")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, closed := counts(m, "busy"); closed != 0 {
+		t.Error("A database in use should not be closed", closed)
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, closed := counts(m, "busy"); closed != 1 {
+		t.Error("Close should close the database once released", closed)
+	}
+}
+
+func TestCompressionOfOpenDatabases(t *testing.T) {
+	options := storage.DefaultOptions()
+	options.Compression = "flate"
+	m := NewHandleManager(StorageConfig{
+		Dir:     t.TempDir(),
+		MaxOpen: 8,
+		Options: options,
+		EngineFor: func(dbname string) (string, error) {
+			if dbname == "counted" {
+				return testEngine, nil
+			}
+			return storage.BTree, nil
+		},
+	})
+	defer m.Close()
+	for _, dbname := range []string{"compressed", "counted"} {
+		db, release, err := m.Acquire(dbname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			db.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf(`{"value":%d}`, i))
+		}
+		release()
+	}
+	stats := m.Compression()
+	compressed, found := stats["compressed"]
+	if len(stats) != 1 || !found || compressed.PagesWritten == 0 || compressed.Ratio <= 0 || compressed.Ratio >= 1 {
+		t.Error("Only the compressed database should report its ratio", stats)
+	}
+}
+
+// TestValidateUserWhileConfiguring reads the storage options while the handle manager is
+// replaced, run it with -race.
+func TestValidateUserWhileConfiguring(t *testing.T) {
+	user := &User{UserName: "rozz", Email: "rozz@example.com", Engine: storage.BTree}
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if err := ConfigureStorage(StorageConfig{Dir: t.TempDir(), Options: storage.DefaultOptions()}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		v := validator.New()
+		ValidateUser(v, user)
+		if !v.Valid() {
+			t.Fatal("User should be valid", v.Errors)
+		}
+	}
+}
@@ -3,10 +3,8 @@ package data
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 
 	"github.com/abdulmajid18/keyVal/key_value/internal/validator"
-	"github.com/abdulmajid18/keyVal/key_value/other/helper"
 )
 
 type PutModel struct {
@@ -47,25 +45,11 @@ func (m PutModel) CheckExistenceDB(secretKey string) (bool, error) {
 	return true, nil
 }
 
-func OpenDB(dbname string) (*helper.DB, error) {
-	new_db := fmt.Sprintf("%s.db", dbname)
-
-	path := fmt.Sprintf("/home/rozz/Desktop/database/%s", new_db)
-	db, err := helper.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	return db, nil
-}
-
 func Insert(data PutData) error {
-	db, err := OpenDB(data.DbName)
-	if err != nil {
-		return err
-	}
-	err = db.Put(data.Key, data.Value)
+	db, release, err := storageHandles().Acquire(data.DbName)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer release()
+	return db.Put(data.Key, data.Value)
 }
@@ -0,0 +1,21 @@
+package data
+
+// DeleteRange removes the keys in [start, end) from the database of dbname and returns how
+// many were removed. Like DatabaseStats it reports a database that was never written to as
+// missing rather than creating it.
+func DeleteRange(dbname, start, end string) (int64, error) {
+	manager := storageHandles()
+	exists, err := manager.exists(dbname)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrRecordNotFound
+	}
+	db, release, err := manager.Acquire(dbname)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return db.DeleteRange(start, end)
+}
@@ -0,0 +1,24 @@
+package data
+
+import (
+	"github.com/abdulmajid18/keyVal/key_value/internal/storage"
+)
+
+// DatabaseStats returns the statistics of the database of dbname. Databases that were
+// never written to don't exist yet, we report them as missing rather than creating them.
+func DatabaseStats(dbname string) (storage.Stats, error) {
+	manager := storageHandles()
+	exists, err := manager.exists(dbname)
+	if err != nil {
+		return storage.Stats{}, err
+	}
+	if !exists {
+		return storage.Stats{}, ErrRecordNotFound
+	}
+	db, release, err := manager.Acquire(dbname)
+	if err != nil {
+		return storage.Stats{}, err
+	}
+	defer release()
+	return db.Stats()
+}
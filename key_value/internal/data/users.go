@@ -5,11 +5,13 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/abdulmajid18/keyVal/key_value/internal/storage"
 	"github.com/abdulmajid18/keyVal/key_value/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -29,6 +31,7 @@ type User struct {
 	UserName  string    `json:"username"`
 	Email     string    `json:"email"`
 	DbName    string    `json:"dbname"`
+	Engine    string    `json:"engine"`
 	Version   int       `json:"-"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
@@ -114,6 +117,10 @@ func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(len(user.UserName) >= 500, "username", "must not be more than 500 bytes long")
 	// Call the standalone ValidateEmail() helper.
 	ValidateEmail(v, user.Email)
+	// An engine unable to open databases with the storage options of the server, like lsm
+	// with a master key, would fail every later request of the user.
+	options := storageHandles().Options()
+	v.Check(!storage.Selectable(user.Engine, options), "engine", fmt.Sprintf("must be one of %s", strings.Join(storage.SelectableEngines(options), ", ")))
 
 	// If the plaintext password is not nil, call the standalone
 	// ValidatePasswordPlaintext() helper.
@@ -140,11 +147,11 @@ type UserModel struct {
 // automatically generated
 func (m UserModel) Insert(user *User) error {
 	query := `
-			INSERT INTO users (username, email, dbname, password_hash, activated, key)
-			VALUES ($1, $2, $3, $4, $5, $6)
+			INSERT INTO users (username, email, dbname, engine, password_hash, activated, key)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 			RETURNING id, created_at, version`
 
-	args := []interface{}{user.UserName, user.Email, user.DbName, user.Password.hash, user.Activated, user.Key}
+	args := []interface{}{user.UserName, user.Email, user.DbName, user.Engine, user.Password.hash, user.Activated, user.Key}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -171,7 +178,7 @@ func (m UserModel) Insert(user *User) error {
 // return one record (or none at all, in which case we return a ErrRecordNotFound error).
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, username, email,  dbname, version, password_hash, activated, key
+	SELECT id, created_at, username, email,  dbname, engine, version, password_hash, activated, key
 	FROM users
 	WHERE email = $1`
 	var user User
@@ -183,6 +190,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.UserName,
 		&user.Email,
 		&user.DbName,
+		&user.Engine,
 		&user.Version,
 		&user.Password.hash,
 		&user.Activated,
@@ -243,7 +251,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	// Set up the SQL query.
 	query := `
-	SELECT users.id, users.created_at, users.username, users.email, users.dbname, users.password_hash, users.key, users.activated, users.version
+	SELECT users.id, users.created_at, users.username, users.email, users.dbname, users.engine, users.password_hash, users.key, users.activated, users.version
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
@@ -267,6 +275,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.UserName,
 		&user.Email,
 		&user.DbName,
+		&user.Engine,
 		&user.Password.hash,
 		&user.Key,
 		&user.Activated,
@@ -283,3 +292,23 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// Return the matching user.
 	return &user, nil
 }
+
+// EngineFor returns the storage engine the database dbname was created with. Databases
+// not owned by any user fall back to the default engine, as they did before engines
+// could be chosen.
+func (m UserModel) EngineFor(dbname string) (string, error) {
+	query := `SELECT engine FROM users WHERE dbname = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var engine string
+	err := m.DB.QueryRowContext(ctx, query, dbname).Scan(&engine)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return storage.Default, nil
+		default:
+			return "", err
+		}
+	}
+	return engine, nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"os"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/bitcask"
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+func init() {
+	Register(Bitcask, Driver{Open: openBitcask, Exists: bitcaskExists, Persistent: true})
+}
+
+// bitcaskEngine stores the database in a directory of append-only files managed by
+// other/bitcask, suited to databases only read by key. Every key is held in memory.
+type bitcaskEngine struct {
+	db *bitcask.DB
+}
+
+func bitcaskDir(path string) string {
+	return path + ".bitcask"
+}
+
+func openBitcask(path string, opts Options) (Engine, error) {
+	if opts.MasterKey != nil {
+		return nil, errors.New("the bitcask engine doesn't support encryption")
+	}
+	syncMode, err := helper.ParseSyncMode(opts.Sync)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bitcask.Open(bitcaskDir(path),
+		bitcask.WithSync(syncMode, opts.SyncInterval),
+		bitcask.WithLockTimeout(opts.LockTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &bitcaskEngine{db: db}, nil
+}
+
+func bitcaskExists(path string) bool {
+	_, err := os.Stat(bitcaskDir(path))
+	return err == nil
+}
+
+func (e *bitcaskEngine) Get(key string) (string, bool, error) {
+	return e.db.Get(key)
+}
+
+func (e *bitcaskEngine) Put(key, value string) error {
+	return e.db.Put(key, value)
+}
+
+func (e *bitcaskEngine) Delete(key string) (bool, error) {
+	return e.db.Delete(key)
+}
+
+func (e *bitcaskEngine) Scan(start, end string, fn func(key, value string) bool) error {
+	return e.db.Scan(start, end, fn)
+}
+
+func (e *bitcaskEngine) Batch(ops []Op) error {
+	batch := &bitcask.Batch{}
+	for _, op := range ops {
+		switch op.Kind {
+		case OpPut:
+			batch.Put(op.Key, op.Value)
+		case OpDelete:
+			batch.Delete(op.Key)
+		}
+	}
+	return e.db.Write(batch)
+}
+
+// DeleteRange deletes the keys of the range in one batch, the engine has no range
+// deletion of its own.
+func (e *bitcaskEngine) DeleteRange(start, end string) (int64, error) {
+	return deleteByScan(e, start, end)
+}
+
+func (e *bitcaskEngine) Stats() (Stats, error) {
+	stats, err := e.db.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{Engine: Bitcask, Keys: stats.Keys, Details: stats}, nil
+}
+
+func (e *bitcaskEngine) Close() error {
+	return e.db.Close()
+}
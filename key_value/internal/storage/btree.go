@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"os"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+func init() {
+	Register(BTree, Driver{Open: openBTree, Exists: btreeExists, Persistent: true, Encrypted: true})
+}
+
+// ErrClosed is returned by every engine once it has been closed.
+var ErrClosed = helper.ErrClosed
+
+// btreeEngine stores the database in a single B-tree file managed by other/helper.
+type btreeEngine struct {
+	db *helper.DB
+}
+
+func btreeFile(path string) string {
+	return path + ".db"
+}
+
+func openBTree(path string, opts Options) (Engine, error) {
+	helperOpts, err := opts.helperOptions()
+	if err != nil {
+		return nil, err
+	}
+	db, err := helper.Open(btreeFile(path), helperOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &btreeEngine{db: db}, nil
+}
+
+func btreeExists(path string) bool {
+	_, err := os.Stat(btreeFile(path))
+	return err == nil
+}
+
+func (e *btreeEngine) Get(key string) (string, bool, error) {
+	return e.db.Get(key)
+}
+
+func (e *btreeEngine) Put(key, value string) error {
+	return e.db.Put(key, value)
+}
+
+func (e *btreeEngine) Delete(key string) (bool, error) {
+	return e.db.Delete(key)
+}
+
+func (e *btreeEngine) Scan(start, end string, fn func(key, value string) bool) error {
+	return e.db.Scan(start, end, fn)
+}
+
+func (e *btreeEngine) Batch(ops []Op) error {
+	batch := &helper.Batch{}
+	for _, op := range ops {
+		switch op.Kind {
+		case OpPut:
+			batch.Put(op.Key, op.Value)
+		case OpDelete:
+			batch.Delete(op.Key)
+		}
+	}
+	return e.db.Write(batch)
+}
+
+func (e *btreeEngine) DeleteRange(start, end string) (int64, error) {
+	return e.db.DeleteRange(start, end)
+}
+
+func (e *btreeEngine) Stats() (Stats, error) {
+	stats, err := e.db.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{Engine: BTree, Keys: stats.Keys, Details: stats}, nil
+}
+
+func (e *btreeEngine) compression() *CompressionStats {
+	return e.db.Compression()
+}
+
+func (e *btreeEngine) Close() error {
+	return e.db.Close()
+}
@@ -0,0 +1,190 @@
+// Package storage defines the interface the API uses to reach the key-value database of
+// a tenant, and the engines implementing it.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Names of the engines shipped with the package.
+const (
+	BTree   = "btree"
+	Bitcask = "bitcask"
+	LSM     = "lsm"
+	Memory  = "memory"
+
+	// Default is the engine of databases created without choosing one.
+	Default = BTree
+)
+
+var ErrUnknownEngine = errors.New("unknown storage engine")
+
+// Engine is an open key-value database. Implementations are safe for concurrent use.
+type Engine interface {
+	// Get returns the value stored for key and whether it was found.
+	Get(key string) (string, bool, error)
+	// Put stores value under key, replacing any previous value.
+	Put(key, value string) error
+	// Delete removes key, reporting whether it was stored.
+	Delete(key string) (bool, error)
+	// Scan calls fn for the pairs with a key in [start, end) in key order until fn returns
+	// false. An empty end scans to the last key. fn must not write to the engine.
+	Scan(start, end string, fn func(key, value string) bool) error
+	// Batch applies the operations in order, readers never see part of a batch.
+	Batch(ops []Op) error
+	// DeleteRange removes the keys in [start, end) and returns how many it removed. An
+	// empty end removes every key from start on.
+	DeleteRange(start, end string) (int64, error)
+	// Stats describes the content of the database.
+	Stats() (Stats, error)
+	// Close flushes pending writes and releases the database.
+	Close() error
+}
+
+// OpKind tells a batch operation what to do with its key.
+type OpKind int
+
+const (
+	OpPut OpKind = iota
+	OpDelete
+)
+
+// Op is one operation of a batch.
+type Op struct {
+	Kind  OpKind
+	Key   string
+	Value string
+}
+
+// Stats holds the statistics common to every engine, Details carries the engine specific
+// ones.
+type Stats struct {
+	Engine  string      `json:"engine"`
+	Keys    int64       `json:"keys"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Driver opens the databases of one engine.
+type Driver struct {
+	// Open opens or creates the database stored at path. Path has no extension, the
+	// driver picks the name of its files from it.
+	Open func(path string, opts Options) (Engine, error)
+	// Exists reports whether a database was created at path.
+	Exists func(path string) bool
+	// Persistent is false for engines that lose their data once closed, whoever holds
+	// them open must not close them to save resources.
+	Persistent bool
+	// Encrypted is true for engines encrypting their databases with Options.MasterKey, the
+	// others refuse to open any database once it is set.
+	Encrypted bool
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// Register makes an engine available under name. It panics when the name is taken.
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, taken := drivers[name]; taken {
+		panic(fmt.Sprintf("storage: engine %q registered twice", name))
+	}
+	drivers[name] = driver
+}
+
+func lookup(name string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	driver, found := drivers[name]
+	if !found {
+		return Driver{}, fmt.Errorf("%w %q", ErrUnknownEngine, name)
+	}
+	return driver, nil
+}
+
+// Engines returns the names of the registered engines in alphabetical order.
+func Engines() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Valid reports whether an engine is registered under name.
+func Valid(name string) bool {
+	_, err := lookup(name)
+	return err == nil
+}
+
+// Path returns where the database dbname lives in dir.
+func Path(dir, dbname string) string {
+	return filepath.Join(dir, dbname)
+}
+
+// Open opens the database at path with the named engine.
+func Open(name, path string, opts Options) (Engine, error) {
+	driver, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return driver.Open(path, opts)
+}
+
+// Exists reports whether the named engine has a database at path.
+func Exists(name, path string) bool {
+	driver, err := lookup(name)
+	return err == nil && driver.Exists(path)
+}
+
+// deleteByScan removes the keys in [start, end) with a single batch, for engines that have
+// no range deletion of their own.
+func deleteByScan(e Engine, start, end string) (int64, error) {
+	var ops []Op
+	err := e.Scan(start, end, func(key, value string) bool {
+		ops = append(ops, Op{Kind: OpDelete, Key: key})
+		return true
+	})
+	if err != nil || len(ops) == 0 {
+		return 0, err
+	}
+	if err := e.Batch(ops); err != nil {
+		return 0, err
+	}
+	return int64(len(ops)), nil
+}
+
+// Persistent reports whether the named engine keeps its data once closed.
+func Persistent(name string) bool {
+	driver, err := lookup(name)
+	return err == nil && driver.Persistent
+}
+
+// Selectable reports whether tenants may create their database with the named engine
+// when databases are opened with opts. Engines losing their data once closed are left to
+// tests, and only encrypted engines can open databases once a master key is set.
+func Selectable(name string, opts Options) bool {
+	driver, err := lookup(name)
+	return err == nil && driver.Persistent && (driver.Encrypted || opts.MasterKey == nil)
+}
+
+// SelectableEngines returns the names of the engines tenants may pick when databases are
+// opened with opts, in alphabetical order.
+func SelectableEngines(opts Options) []string {
+	var names []string
+	for _, name := range Engines() {
+		if Selectable(name, opts) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
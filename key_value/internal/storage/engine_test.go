@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEngines runs the same checks against every registered engine.
+func TestEngines(t *testing.T) {
+	for _, name := range Engines() {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tenant")
+			engine, err := Open(name, path, DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 100; i++ {
+				if err := engine.Put(fmt.Sprintf("key-%03d", i), "old"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := engine.Put("key-000", "new"); err != nil {
+				t.Fatal(err)
+			}
+			if value, found, err := engine.Get("key-000"); err != nil || !found || value != "new" {
+				t.Error("Put should replace the value", value, err)
+			}
+			if found, err := engine.Delete("key-001"); err != nil || !found {
+				t.Error("Delete should find the key", err)
+			}
+			if found, _ := engine.Delete("key-001"); found {
+				t.Error("Key should be gone")
+			}
+
+			err = engine.Batch([]Op{
+				{Kind: OpPut, Key: "key-100", Value: "batch"},
+				{Kind: OpDelete, Key: "key-002"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			err = engine.Scan("key-000", "key-005", func(key, value string) bool {
+				keys = append(keys, key)
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(keys) != "[key-000 key-003 key-004]" {
+				t.Error("Unexpected scan", keys)
+			}
+
+			stats, err := engine.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Engine != name || stats.Keys != 99 {
+				t.Error("Unexpected stats", stats)
+			}
+
+			removed, err := engine.DeleteRange("key-090", "key-095")
+			if err != nil || removed != 5 {
+				t.Error("DeleteRange should remove the keys of the range", removed, err)
+			}
+			if removed, _ := engine.DeleteRange("key-098", ""); removed != 3 {
+				t.Error("Open ended DeleteRange should remove to the last key", removed)
+			}
+			if _, found, _ := engine.Get("key-095"); !found {
+				t.Error("The end of the range should be kept")
+			}
+
+			if err := engine.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := engine.Get("key-000"); !errors.Is(err, ErrClosed) {
+				t.Error("Get after close should fail", err)
+			}
+		})
+	}
+}
+
+func TestUnknownEngine(t *testing.T) {
+	if _, err := Open("nope", "", DefaultOptions()); !errors.Is(err, ErrUnknownEngine) {
+		t.Error("Unknown engines should be rejected", err)
+	}
+}
+
+func TestSelectableEngines(t *testing.T) {
+	opts := DefaultOptions()
+	if Selectable(Memory, opts) {
+		t.Error("Tenants should not pick an engine losing its data")
+	}
+	if fmt.Sprint(SelectableEngines(opts)) != "[bitcask btree lsm]" {
+		t.Error("Unexpected engines", SelectableEngines(opts))
+	}
+	opts.MasterKey = make([]byte, 32)
+	if fmt.Sprint(SelectableEngines(opts)) != "[btree]" {
+		t.Error("Only encrypted engines should be picked with a master key", SelectableEngines(opts))
+	}
+}
+
+// TestMemoryRefusesLikeBTree checks the memory engine stands in for the B-tree one.
+func TestMemoryRefusesLikeBTree(t *testing.T) {
+	refused := map[string]string{
+		"empty":     "",
+		"oversized": strings.Repeat("v", 1<<20+1),
+	}
+	for _, name := range []string{BTree, Memory} {
+		engine, err := Open(name, filepath.Join(t.TempDir(), "tenant"), DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range refused {
+			if err := engine.Put(key, value); err == nil {
+				t.Error("Value should be refused", name, key)
+			}
+			if err := engine.Batch([]Op{{Kind: OpPut, Key: "batch", Value: "ok"}, {Kind: OpPut, Key: key, Value: value}}); err == nil {
+				t.Error("Batch should be refused", name, key)
+			}
+		}
+		if err := engine.Put(strings.Repeat("k", 31), "value"); err == nil {
+			t.Error("Key should be refused", name)
+		}
+		if stats, err := engine.Stats(); err != nil || stats.Keys != 0 {
+			t.Error("A refused write should store nothing", name, stats.Keys, err)
+		}
+		engine.Close()
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"os"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+	"github.com/abdulmajid18/keyVal/key_value/other/lsm"
+)
+
+func init() {
+	Register(LSM, Driver{Open: openLSM, Exists: lsmExists, Persistent: true})
+}
+
+// lsmEngine stores the database in a directory of sorted tables managed by other/lsm,
+// suited to write heavy databases.
+type lsmEngine struct {
+	db *lsm.DB
+}
+
+func lsmDir(path string) string {
+	return path + ".lsm"
+}
+
+func openLSM(path string, opts Options) (Engine, error) {
+	if opts.MasterKey != nil {
+		return nil, errors.New("the lsm engine doesn't support encryption")
+	}
+	syncMode, err := helper.ParseSyncMode(opts.Sync)
+	if err != nil {
+		return nil, err
+	}
+	db, err := lsm.Open(lsmDir(path),
+		lsm.WithSync(syncMode, opts.SyncInterval),
+		lsm.WithLockTimeout(opts.LockTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &lsmEngine{db: db}, nil
+}
+
+func lsmExists(path string) bool {
+	_, err := os.Stat(lsmDir(path))
+	return err == nil
+}
+
+func (e *lsmEngine) Get(key string) (string, bool, error) {
+	return e.db.Get(key)
+}
+
+func (e *lsmEngine) Put(key, value string) error {
+	return e.db.Put(key, value)
+}
+
+func (e *lsmEngine) Delete(key string) (bool, error) {
+	return e.db.Delete(key)
+}
+
+func (e *lsmEngine) Scan(start, end string, fn func(key, value string) bool) error {
+	return e.db.Scan(start, end, fn)
+}
+
+func (e *lsmEngine) Batch(ops []Op) error {
+	batch := &lsm.Batch{}
+	for _, op := range ops {
+		switch op.Kind {
+		case OpPut:
+			batch.Put(op.Key, op.Value)
+		case OpDelete:
+			batch.Delete(op.Key)
+		}
+	}
+	return e.db.Write(batch)
+}
+
+// DeleteRange deletes the keys of the range in one batch, the engine has no range
+// deletion of its own.
+func (e *lsmEngine) DeleteRange(start, end string) (int64, error) {
+	return deleteByScan(e, start, end)
+}
+
+func (e *lsmEngine) Stats() (Stats, error) {
+	stats, err := e.db.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{Engine: LSM, Keys: stats.Keys, Details: stats}, nil
+}
+
+func (e *lsmEngine) Close() error {
+	return e.db.Close()
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+func init() {
+	Register(Memory, Driver{Open: openMemory, Exists: func(string) bool { return false }})
+}
+
+// memoryEngine keeps the database in a map. Nothing is written to disk, the data is gone
+// once it is closed, which makes it handy for tests. Tenants can't select it. It refuses
+// the pairs the B-tree engine refuses, so tests see the same errors.
+type memoryEngine struct {
+	mu     sync.RWMutex
+	pairs  map[string]string
+	closed bool
+}
+
+func openMemory(path string, opts Options) (Engine, error) {
+	return NewMemory(), nil
+}
+
+// NewMemory returns an empty in-memory engine.
+func NewMemory() Engine {
+	return &memoryEngine{pairs: make(map[string]string)}
+}
+
+func (e *memoryEngine) Get(key string) (string, bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return "", false, ErrClosed
+	}
+	value, found := e.pairs[key]
+	return value, found, nil
+}
+
+func (e *memoryEngine) Put(key, value string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	if err := helper.ValidatePair(key, value); err != nil {
+		return err
+	}
+	e.pairs[key] = value
+	return nil
+}
+
+func (e *memoryEngine) Delete(key string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return false, ErrClosed
+	}
+	_, found := e.pairs[key]
+	delete(e.pairs, key)
+	return found, nil
+}
+
+func (e *memoryEngine) Scan(start, end string, fn func(key, value string) bool) error {
+	// Copy the range out so fn runs without the lock held.
+	e.mu.RLock()
+	if e.closed {
+		e.mu.RUnlock()
+		return ErrClosed
+	}
+	var keys []string
+	for key := range e.pairs {
+		if key >= start && (end == "" || key < end) {
+			keys = append(keys, key)
+		}
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		values[key] = e.pairs[key]
+	}
+	e.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !fn(key, values[key]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (e *memoryEngine) Batch(ops []Op) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	// Nothing is applied unless every put can be
+	for _, op := range ops {
+		if op.Kind == OpPut {
+			if err := helper.ValidatePair(op.Key, op.Value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, op := range ops {
+		switch op.Kind {
+		case OpPut:
+			e.pairs[op.Key] = op.Value
+		case OpDelete:
+			delete(e.pairs, op.Key)
+		}
+	}
+	return nil
+}
+
+func (e *memoryEngine) DeleteRange(start, end string) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return 0, ErrClosed
+	}
+	var removed int64
+	for key := range e.pairs {
+		if key >= start && (end == "" || key < end) {
+			delete(e.pairs, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (e *memoryEngine) Stats() (Stats, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return Stats{}, ErrClosed
+	}
+	return Stats{Engine: Memory, Keys: int64(len(e.pairs))}, nil
+}
+
+func (e *memoryEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	e.closed = true
+	e.pairs = nil
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+// Defaults of the storage options.
+const (
+	DefaultSyncInterval = helper.DefaultSyncInterval
+	DefaultLockTimeout  = helper.DefaultLockTimeout
+	DefaultCacheSize    = helper.DefaultCacheSize
+)
+
+// Options configures how engines open their databases. Engines ignore the settings that
+// don't apply to them.
+type Options struct {
+	// Compression is the page codec of new databases (none|flate).
+	Compression string
+	// MasterKey encrypts new databases and opens encrypted ones, nil keeps them plaintext.
+	MasterKey []byte
+	Mmap      bool
+	CacheSize int
+	// Sync chooses when writes are flushed (always|interval|none).
+	Sync         string
+	SyncInterval time.Duration
+	LockTimeout  time.Duration
+}
+
+// DefaultOptions returns the options used when nothing else is configured.
+func DefaultOptions() Options {
+	return Options{
+		Compression:  helper.CodecNone.String(),
+		CacheSize:    DefaultCacheSize,
+		Sync:         helper.SyncNone.String(),
+		SyncInterval: DefaultSyncInterval,
+		LockTimeout:  DefaultLockTimeout,
+	}
+}
+
+// Validate checks the named settings, so mistakes surface at startup rather than when
+// the first database is opened.
+func (o Options) Validate() error {
+	_, err := o.helperOptions()
+	return err
+}
+
+// helperOptions translates the options for helper.Open.
+func (o Options) helperOptions() ([]helper.Option, error) {
+	codec, err := helper.ParseCodec(o.Compression)
+	if err != nil {
+		return nil, err
+	}
+	syncMode, err := helper.ParseSyncMode(o.Sync)
+	if err != nil {
+		return nil, err
+	}
+	opts := []helper.Option{
+		helper.WithCompression(codec),
+		helper.WithSync(syncMode, o.SyncInterval),
+		helper.WithLockTimeout(o.LockTimeout),
+		helper.WithCacheSize(o.CacheSize),
+	}
+	if o.MasterKey != nil {
+		opts = append(opts, helper.WithEncryptionKey(o.MasterKey))
+	}
+	if o.Mmap {
+		opts = append(opts, helper.WithMmap())
+	}
+	return opts, nil
+}
+
+// CompressionStats are the page compression counters of a database since it was opened.
+// Compressed pages keep their slot in the file, Ratio tells how well they compress rather
+// than how much disk space they save.
+type CompressionStats = helper.CompressionStats
+
+// compressor is implemented by the engines whose pages go through a codec.
+type compressor interface {
+	compression() *CompressionStats
+}
+
+// Compression returns the page compression counters of the database, ok is false when
+// its engine has no codec or the database was created without one.
+func Compression(e Engine) (stats CompressionStats, ok bool) {
+	c, ok := e.(compressor)
+	if !ok {
+		return CompressionStats{}, false
+	}
+	if counters := c.compression(); counters != nil {
+		return *counters, true
+	}
+	return CompressionStats{}, false
+}
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN IF EXISTS engine;
\ No newline at end of file
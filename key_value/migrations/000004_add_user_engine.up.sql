@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS engine text NOT NULL DEFAULT 'btree';
\ No newline at end of file
@@ -0,0 +1,21 @@
+package bitcask
+
+// Batch - Puts and deletes applied together by DB.Write
+type Batch struct {
+	records []record
+}
+
+// Put - Queue a key value pair to be inserted
+func (b *Batch) Put(key string, value string) {
+	b.records = append(b.records, record{key: key, value: value})
+}
+
+// Delete - Queue a key to be removed
+func (b *Batch) Delete(key string) {
+	b.records = append(b.records, record{key: key, flags: flagTombstone})
+}
+
+// Len - Number of queued operations
+func (b *Batch) Len() int {
+	return len(b.records)
+}
@@ -0,0 +1,422 @@
+// Package bitcask implements a log-structured hash storage engine for databases that are
+// only read by key. Every write is appended to a data file and an in-memory keydir maps
+// each key to the record holding its latest value, so a lookup costs a single read.
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+var (
+	ErrClosed      = helper.ErrClosed
+	ErrEmptyKey    = errors.New("key must not be empty")
+	ErrKeyTooLong  = fmt.Errorf("key must not be more than %d bytes", maxKeyLength)
+	ErrValueTooBig = fmt.Errorf("value must not be more than %d bytes", maxValueLength)
+)
+
+// location - Where the latest record of a key is
+type location struct {
+	fileID uint64
+	offset int64
+	size   uint32
+}
+
+type dataFile struct {
+	id   uint64
+	file *os.File
+	size int64
+}
+
+// DB - Handle of a bitcask database directory. It is safe for concurrent use, writes are
+// serialized while reads run in parallel.
+type DB struct {
+	dir  string
+	o    *options
+	lock *os.File
+
+	// writeMu - Serializes writes along with the merges they trigger. Only its holder
+	// appends to the active file and changes the keydir.
+	writeMu sync.Mutex
+
+	// mu - Guards what readers look at, the keydir and the files
+	mu     sync.RWMutex
+	keydir map[string]location
+	files  map[uint64]*dataFile
+	active *dataFile
+	syncer *helper.Syncer
+	nextID uint64
+	closed bool
+
+	// totalBytes - Size of every data file, liveBytes the part the keydir points to
+	totalBytes int64
+	liveBytes  int64
+	merges     uint64
+}
+
+func dataName(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.data", id))
+}
+
+func hintName(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.hint", id))
+}
+
+// mergeSuffix - Marks the files of a merge until they are complete
+const mergeSuffix = ".merge"
+
+/**
+OPENING A DATABASE
+	1. Lock the directory through its LOCK file and remove what an interrupted merge left
+	2. Rebuild the keydir from the data files, oldest first. A file with a hint file is
+	   loaded from it, any other file is read record by record.
+	3. A torn record at the end of the last file belongs to a write that was never
+	   acknowledged and is cut off, that file keeps taking the new writes
+*/
+
+// Open - Opens the database in the directory, creating it when needed
+func Open(dir string, opts ...Option) (*DB, error) {
+	o := buildOptions(opts)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, "LOCK"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := helper.LockFile(lock, true, o.lockTimeout); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	db := &DB{dir: dir, o: o, lock: lock, keydir: make(map[string]location), files: make(map[uint64]*dataFile)}
+	if err := db.recover(); err != nil {
+		db.closeFiles()
+		lock.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) recover() error {
+	entries, err := os.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, mergeSuffix) {
+			os.Remove(filepath.Join(db.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, ".data") {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, ".data"), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var hinted bool
+	for n, id := range ids {
+		file, err := os.OpenFile(dataName(db.dir, id), os.O_RDWR, 0666)
+		if err != nil {
+			return err
+		}
+		df := &dataFile{id: id, file: file}
+		db.files[id] = df
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		df.size = info.Size()
+
+		var hints []hint
+		hints, hinted = readHintFile(hintName(db.dir, id))
+		if hinted {
+			for _, h := range hints {
+				db.keydir[h.key] = location{fileID: id, offset: h.offset, size: h.size}
+			}
+		} else {
+			end, err := scanRecords(file, func(r record, offset int64) {
+				if r.deleted() {
+					delete(db.keydir, r.key)
+					return
+				}
+				db.keydir[r.key] = location{fileID: id, offset: offset, size: uint32(r.size())}
+			})
+			if err != nil {
+				return err
+			}
+			if end < df.size {
+				if n < len(ids)-1 {
+					return fmt.Errorf("%s: %w", dataName(db.dir, id), errCorruptRecord)
+				}
+				if err := file.Truncate(end); err != nil {
+					return err
+				}
+				df.size = end
+			}
+		}
+		db.totalBytes += df.size
+		db.nextID = id + 1
+	}
+	for _, loc := range db.keydir {
+		db.liveBytes += int64(loc.size)
+	}
+
+	// Keep appending to the last file unless a merge wrote it or it is full
+	if len(ids) > 0 && !hinted && db.files[ids[len(ids)-1]].size < db.o.maxFileSize {
+		db.active = db.files[ids[len(ids)-1]]
+		db.syncer = helper.NewSyncer(db.active.file, db.o.syncMode, db.o.syncInterval)
+		return nil
+	}
+	active, err := db.createDataFile()
+	if err != nil {
+		return err
+	}
+	db.files[active.id] = active
+	db.active = active
+	db.syncer = helper.NewSyncer(active.file, db.o.syncMode, db.o.syncInterval)
+	return nil
+}
+
+// createDataFile - Creates the next data file, which isn't added to the database yet
+func (db *DB) createDataFile() (*dataFile, error) {
+	id := db.nextID
+	file, err := os.OpenFile(dataName(db.dir, id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	db.nextID++
+	return &dataFile{id: id, file: file}, nil
+}
+
+func validateRecord(r record) error {
+	switch {
+	case r.key == "":
+		return ErrEmptyKey
+	case len(r.key) > maxKeyLength:
+		return ErrKeyTooLong
+	case len(r.value) > maxValueLength:
+		return ErrValueTooBig
+	}
+	return nil
+}
+
+// write - Appends the records to the active file and points the keydir at them
+func (db *DB) write(records []record) error {
+	for _, r := range records {
+		if err := validateRecord(r); err != nil {
+			return err
+		}
+	}
+	db.writeMu.Lock()
+	if db.closed {
+		db.writeMu.Unlock()
+		return ErrClosed
+	}
+	return db.apply(records)
+}
+
+// apply - The second half of write, must be called with writeMu held which it releases
+func (db *DB) apply(records []record) error {
+	var buffer []byte
+	for i, r := range records {
+		if i < len(records)-1 {
+			r.flags |= flagBatch
+		}
+		buffer = appendRecord(buffer, r)
+	}
+	active, syncer := db.active, db.syncer
+	if _, err := active.file.WriteAt(buffer, active.size); err != nil {
+		// Drop the partial write, the next records would end up behind it
+		active.file.Truncate(active.size)
+		db.writeMu.Unlock()
+		return err
+	}
+
+	db.mu.Lock()
+	offset := active.size
+	for _, r := range records {
+		if old, found := db.keydir[r.key]; found {
+			db.liveBytes -= int64(old.size)
+			delete(db.keydir, r.key)
+		}
+		if !r.deleted() {
+			db.keydir[r.key] = location{fileID: active.id, offset: offset, size: uint32(r.size())}
+			db.liveBytes += r.size()
+		}
+		offset += r.size()
+	}
+	active.size = offset
+	db.totalBytes += int64(len(buffer))
+	db.mu.Unlock()
+
+	var err error
+	if active.size >= db.o.maxFileSize {
+		if err = db.rotate(); err == nil && db.needsMerge() {
+			err = db.merge()
+		}
+	}
+	db.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	// Wait for durability outside the lock so concurrent writers share a group commit. A
+	// file sealed in the meantime was synced when it was sealed.
+	if err := syncer.Commit(); !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// rotate - Seals the active file and starts a new one, must be called with writeMu held
+func (db *DB) rotate() error {
+	active, err := db.createDataFile()
+	if err != nil {
+		return err
+	}
+	if err := db.syncer.Close(); err != nil {
+		active.file.Close()
+		os.Remove(dataName(db.dir, active.id))
+		return err
+	}
+	db.mu.Lock()
+	db.files[active.id] = active
+	db.active = active
+	db.syncer = helper.NewSyncer(active.file, db.o.syncMode, db.o.syncInterval)
+	db.mu.Unlock()
+	return nil
+}
+
+// Put - Insert or replace the value of the key
+func (db *DB) Put(key string, value string) error {
+	return db.write([]record{{key: key, value: value}})
+}
+
+// Delete - Remove the key, reporting whether it was stored. Keys that aren't stored don't
+// cost a tombstone.
+func (db *DB) Delete(key string) (bool, error) {
+	db.writeMu.Lock()
+	if db.closed {
+		db.writeMu.Unlock()
+		return false, ErrClosed
+	}
+	// Only the holder of writeMu changes the keydir
+	if _, found := db.keydir[key]; !found {
+		db.writeMu.Unlock()
+		return false, nil
+	}
+	return true, db.apply([]record{{key: key, flags: flagTombstone}})
+}
+
+// Write - Apply the puts and deletes of the batch in order. After a crash the batch is
+// replayed entirely or not at all.
+func (db *DB) Write(batch *Batch) error {
+	if len(batch.records) == 0 {
+		return nil
+	}
+	return db.write(batch.records)
+}
+
+// read - Reads the record at the location, must be called with mu held
+func (db *DB) read(key string, loc location) (record, error) {
+	df, found := db.files[loc.fileID]
+	if !found {
+		return record{}, fmt.Errorf("data file %d is missing", loc.fileID)
+	}
+	buffer := make([]byte, loc.size)
+	if _, err := df.file.ReadAt(buffer, loc.offset); err != nil {
+		return record{}, err
+	}
+	r, err := decodeRecord(buffer)
+	if err == nil && r.key != key {
+		err = errCorruptRecord
+	}
+	if err != nil {
+		return record{}, fmt.Errorf("%s at %d: %w", dataName(db.dir, loc.fileID), loc.offset, err)
+	}
+	return r, nil
+}
+
+// Get - Get the stored value of the key
+func (db *DB) Get(key string) (string, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return "", false, ErrClosed
+	}
+	loc, found := db.keydir[key]
+	if !found {
+		return "", false, nil
+	}
+	r, err := db.read(key, loc)
+	if err != nil {
+		return "", false, err
+	}
+	return r.value, true, nil
+}
+
+// Scan - Call fn with the pairs whose key is in [start, end) in key order until fn returns
+// false. An empty end scans to the last key. The keydir is unordered, so the keys in range
+// are sorted first. The database is read locked while the scan runs, fn must not write to it.
+func (db *DB) Scan(start string, end string, fn func(key string, value string) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrClosed
+	}
+	var keys []string
+	for key := range db.keydir {
+		if key >= start && (end == "" || key < end) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		r, err := db.read(key, db.keydir[key])
+		if err != nil {
+			return err
+		}
+		if !fn(key, r.value) {
+			break
+		}
+	}
+	return nil
+}
+
+func (db *DB) closeFiles() {
+	for _, df := range db.files {
+		df.file.Close()
+	}
+}
+
+// Close - Sync the active file and release the directory
+func (db *DB) Close() error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+	err := db.syncer.Close()
+	db.closeFiles()
+	if closeErr := db.lock.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
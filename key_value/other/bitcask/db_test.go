@@ -0,0 +1,221 @@
+package bitcask
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openSmall - Opens a database with tiny data files so a few thousand writes seal files
+func openSmall(t *testing.T, dir string, opts ...Option) *DB {
+	db, err := Open(dir, append([]Option{WithMaxFileSize(16 << 10)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPutGetDelete(t *testing.T) {
+	db := openSmall(t, t.TempDir())
+	defer db.Close()
+	random := rand.New(rand.NewSource(1))
+	total := 2000
+	for _, i := range random.Perm(total) {
+		if err := db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := make(map[int]bool)
+	for n, i := range random.Perm(total) {
+		if n%3 == 0 {
+			continue
+		}
+		found, err := db.Delete(fmt.Sprintf("key-%04d", i))
+		if err != nil || !found {
+			t.Fatal("Delete should find the key", i, err)
+		}
+		deleted[i] = true
+	}
+	if found, err := db.Delete("missing"); err != nil || found {
+		t.Error("Deleting a missing key should report it", err)
+	}
+	for i := 0; i < total; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key-%04d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found == deleted[i] {
+			t.Fatal("Get disagrees with the deletes", i, found)
+		}
+		if found && value != fmt.Sprintf("value-%d", i) {
+			t.Fatal("Get returned the wrong value", i, value)
+		}
+	}
+
+	var keys []string
+	db.Scan("key-0000", "key-0030", func(key string, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	for i := 1; i < len(keys); i++ {
+		if keys[i] <= keys[i-1] {
+			t.Fatal("Scan should return keys in order", keys[i-1], keys[i])
+		}
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != int64(total-len(deleted)) || len(keys) == 0 {
+		t.Error("Stats should count the live keys", stats.Keys, len(keys))
+	}
+	if stats.Merges == 0 {
+		t.Error("Deleting most keys should have started a merge")
+	}
+}
+
+func TestReopenUsesHintsAndLog(t *testing.T) {
+	dir := t.TempDir()
+	db := openSmall(t, dir, WithMergeThreshold(0))
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 500; i++ {
+			db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d-%d", round, i))
+		}
+	}
+	db.Delete("key-0007")
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ := db.Stats()
+	if stats.DeadBytes != 0 {
+		t.Error("A merge should leave no dead bytes", stats.DeadBytes)
+	}
+	hints, _ := filepath.Glob(filepath.Join(dir, "*.hint"))
+	if len(hints) == 0 {
+		t.Error("A merge should write hint files")
+	}
+	// Writes after the merge only live in the active file
+	db.Put("key-0001", "after-merge")
+	db.Delete("key-0002")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openSmall(t, dir)
+	defer db.Close()
+	for i := 0; i < 500; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key-%04d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch i {
+		case 1:
+			if value != "after-merge" {
+				t.Error("The write after the merge should win", value)
+			}
+		case 2, 7:
+			if found {
+				t.Error("The delete should survive a reopen", i)
+			}
+		default:
+			if value != fmt.Sprintf("value-2-%d", i) {
+				t.Fatal("Reopen lost a pair", i, value)
+			}
+		}
+	}
+}
+
+func TestTornTailIsDropped(t *testing.T) {
+	dir := t.TempDir()
+	db := openSmall(t, dir)
+	db.Put("a", "1")
+	batch := &Batch{}
+	batch.Put("b", "2")
+	batch.Put("c", "3")
+	if err := db.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Cut the last record of the batch short
+	names, _ := filepath.Glob(filepath.Join(dir, "*.data"))
+	last := names[len(names)-1]
+	info, _ := os.Stat(last)
+	if err := os.Truncate(last, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openSmall(t, dir)
+	defer db.Close()
+	if value, _, _ := db.Get("a"); value != "1" {
+		t.Error("Records before the torn one should survive", value)
+	}
+	if _, found, _ := db.Get("b"); found {
+		t.Error("A torn batch should be dropped entirely")
+	}
+	if err := db.Put("d", "4"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := db.Get("d"); value != "4" {
+		t.Error("Writes should go on after the torn tail", value)
+	}
+}
+
+func TestOpenLocksDirectory(t *testing.T) {
+	dir := t.TempDir()
+	db := openSmall(t, dir)
+	defer db.Close()
+	if _, err := Open(dir, WithLockTimeout(0)); err == nil {
+		t.Error("A second Open of the directory should fail")
+	}
+}
+
+func TestMergeInterruptedKeepsDeletes(t *testing.T) {
+	dir := t.TempDir()
+	db := openSmall(t, dir, WithMergeThreshold(0))
+	for i := 0; i < 2000; i++ {
+		db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i))
+	}
+	for i := 0; i < 2000; i += 2 {
+		db.Delete(fmt.Sprintf("key-%04d", i))
+	}
+	db.syncer.Commit()
+	old, err := filepath.Glob(filepath.Join(dir, "*.data"))
+	if err != nil || len(old) < 3 {
+		t.Fatal("The writes should span several files", old, err)
+	}
+	saved := make(map[string][]byte)
+	for _, name := range old {
+		if saved[name], err = os.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash while removing the old files, oldest first, leaves the newest of them
+	for cut := range old {
+		for i, name := range old {
+			if i < cut {
+				os.Remove(name)
+			} else if err := os.WriteFile(name, saved[name], 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db = openSmall(t, dir)
+		for i := 0; i < 2000; i++ {
+			if _, found, err := db.Get(fmt.Sprintf("key-%04d", i)); err != nil || found != (i%2 == 1) {
+				t.Fatal("Deleted keys should stay deleted", cut, i, found, err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
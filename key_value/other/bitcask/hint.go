@@ -0,0 +1,88 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+)
+
+/**
+HINT FILE FORMAT
+	Merges write a hint file next to every data file they produce, listing where each key
+	is so Open doesn't have to read the values. One entry per key:
+		0:4   key length
+		4:8   record size
+		8:16  record offset in the data file
+		16:   key
+	followed by the CRC-32 of everything before it. A hint file that fails its checksum is
+	ignored and the data file is scanned instead.
+*/
+
+const hintEntrySize = 16
+
+type hint struct {
+	key    string
+	size   uint32
+	offset int64
+}
+
+func writeHintFile(path string, hints []hint) error {
+	var buffer []byte
+	var entry [hintEntrySize]byte
+	for _, h := range hints {
+		binary.LittleEndian.PutUint32(entry[0:], uint32(len(h.key)))
+		binary.LittleEndian.PutUint32(entry[4:], h.size)
+		binary.LittleEndian.PutUint64(entry[8:], uint64(h.offset))
+		buffer = append(buffer, entry[:]...)
+		buffer = append(buffer, h.key...)
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buffer))
+	buffer = append(buffer, sum[:]...)
+	return writeFileSync(path, buffer)
+}
+
+// readHintFile - Returns the hints of the file, false when it is missing or damaged
+func readHintFile(path string) ([]hint, bool) {
+	buffer, err := os.ReadFile(path)
+	if err != nil || len(buffer) < 4 {
+		return nil, false
+	}
+	body := buffer[:len(buffer)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(buffer[len(body):]) {
+		return nil, false
+	}
+	var hints []hint
+	for len(body) > 0 {
+		if len(body) < hintEntrySize {
+			return nil, false
+		}
+		keyLen := int(binary.LittleEndian.Uint32(body[0:]))
+		if len(body) < hintEntrySize+keyLen {
+			return nil, false
+		}
+		hints = append(hints, hint{
+			key:    string(body[hintEntrySize : hintEntrySize+keyLen]),
+			size:   binary.LittleEndian.Uint32(body[4:]),
+			offset: int64(binary.LittleEndian.Uint64(body[8:])),
+		})
+		body = body[hintEntrySize+keyLen:]
+	}
+	return hints, true
+}
+
+func writeFileSync(path string, buffer []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buffer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,206 @@
+package bitcask
+
+import (
+	"os"
+	"sort"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+/**
+MERGE
+	Overwritten and deleted records stay in the data files until a merge rewrites them.
+	Writes wait for the merge, which reads every file including the active one:
+		1. Copy the record the keydir points to for every key into new data files, starting
+		   a new one every maxFileSize bytes, and write a hint file for each of them. They
+		   are written under a temporary name and renamed once synced.
+		2. Start a new active file numbered after the merged files
+		3. Point the keydir at the merged files, then remove the old files
+	The merged files are numbered after every file they replace, so a crash before the old
+	files are gone replays the old files first and the merged copies of the same records
+	after them. Tombstones aren't copied, every older record of their key is dropped too.
+	The old files are removed oldest first and the removal stops at the first failure, a
+	file holding a tombstone is never gone while an older file still holds the record it
+	deletes.
+*/
+
+// needsMerge - Whether the share of dead bytes reached the merge threshold
+func (db *DB) needsMerge() bool {
+	if db.o.mergeThreshold <= 0 || db.totalBytes == 0 {
+		return false
+	}
+	return float64(db.totalBytes-db.liveBytes)/float64(db.totalBytes) >= db.o.mergeThreshold
+}
+
+// Merge - Rewrite the data files without the overwritten and deleted records
+func (db *DB) Merge() error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	return db.merge()
+}
+
+// mergeOutput - A data file written by a merge
+type mergeOutput struct {
+	df    *dataFile
+	hints []hint
+}
+
+// merge - Must be called with writeMu held
+func (db *DB) merge() error {
+	// Copy in file order so the old files are read sequentially
+	keys := make([]string, 0, len(db.keydir))
+	for key := range db.keydir {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := db.keydir[keys[i]], db.keydir[keys[j]]
+		if a.fileID != b.fileID {
+			return a.fileID < b.fileID
+		}
+		return a.offset < b.offset
+	})
+
+	var outputs []*mergeOutput
+	abandon := func() {
+		for _, out := range outputs {
+			out.df.file.Close()
+			for _, name := range []string{dataName(db.dir, out.df.id), hintName(db.dir, out.df.id)} {
+				os.Remove(name)
+				os.Remove(name + mergeSuffix)
+			}
+		}
+	}
+	keydir := make(map[string]location, len(db.keydir))
+	var out *mergeOutput
+	var buffer []byte
+	flush := func() error {
+		_, err := out.df.file.Write(buffer)
+		buffer = buffer[:0]
+		return err
+	}
+	for _, key := range keys {
+		r, err := db.read(key, db.keydir[key])
+		if err != nil {
+			abandon()
+			return err
+		}
+		if out == nil || out.df.size >= db.o.maxFileSize {
+			if out != nil {
+				if err := flush(); err != nil {
+					abandon()
+					return err
+				}
+			}
+			id := db.nextID + uint64(len(outputs))
+			file, err := os.Create(dataName(db.dir, id) + mergeSuffix)
+			if err != nil {
+				abandon()
+				return err
+			}
+			out = &mergeOutput{df: &dataFile{id: id, file: file}}
+			outputs = append(outputs, out)
+		}
+		loc := location{fileID: out.df.id, offset: out.df.size, size: uint32(r.size())}
+		r.flags = 0
+		buffer = appendRecord(buffer, r)
+		if len(buffer) >= 1<<20 {
+			if err := flush(); err != nil {
+				abandon()
+				return err
+			}
+		}
+		out.df.size += r.size()
+		out.hints = append(out.hints, hint{key: key, size: loc.size, offset: loc.offset})
+		keydir[key] = loc
+	}
+	if out != nil {
+		if err := flush(); err != nil {
+			abandon()
+			return err
+		}
+	}
+	for _, out := range outputs {
+		name := dataName(db.dir, out.df.id)
+		err := out.df.file.Sync()
+		if err == nil {
+			err = writeHintFile(hintName(db.dir, out.df.id)+mergeSuffix, out.hints)
+		}
+		if err == nil {
+			err = os.Rename(name+mergeSuffix, name)
+		}
+		if err == nil {
+			err = os.Rename(hintName(db.dir, out.df.id)+mergeSuffix, hintName(db.dir, out.df.id))
+		}
+		if err != nil {
+			abandon()
+			return err
+		}
+	}
+	if err := syncDir(db.dir); err != nil {
+		abandon()
+		return err
+	}
+
+	db.nextID += uint64(len(outputs))
+	active, err := db.createDataFile()
+	if err != nil {
+		// New writes must not land in a file older than the merged ones
+		abandon()
+		return err
+	}
+	if err := db.syncer.Close(); err != nil {
+		active.file.Close()
+		os.Remove(dataName(db.dir, active.id))
+		abandon()
+		return err
+	}
+
+	db.mu.Lock()
+	old := db.files
+	db.files = map[uint64]*dataFile{active.id: active}
+	db.totalBytes = 0
+	for _, out := range outputs {
+		db.files[out.df.id] = out.df
+		db.totalBytes += out.df.size
+	}
+	db.keydir = keydir
+	db.liveBytes = db.totalBytes
+	db.active = active
+	db.syncer = helper.NewSyncer(active.file, db.o.syncMode, db.o.syncInterval)
+	db.merges++
+	db.mu.Unlock()
+
+	// No reader can still be using the old files, they read with mu held
+	ids := make([]uint64, 0, len(old))
+	for id, df := range old {
+		df.file.Close()
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		// The old files left behind are replayed before the merged ones by the next Open
+		if err := os.Remove(hintName(db.dir, id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(dataName(db.dir, id)); err != nil {
+			return err
+		}
+		// A crash must not keep a file once a newer one is gone
+		if err := syncDir(db.dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,69 @@
+package bitcask
+
+import (
+	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+// Option - Configures how Open prepares the database directory
+type Option func(*options)
+
+type options struct {
+	maxFileSize    int64
+	mergeThreshold float64
+
+	syncMode     helper.SyncMode
+	syncInterval time.Duration
+	lockTimeout  time.Duration
+}
+
+const (
+	DefaultMaxFileSize = 64 << 20
+	// DefaultMergeThreshold - Share of dead bytes that makes sealing a file start a merge
+	DefaultMergeThreshold = 0.5
+)
+
+func buildOptions(opts []Option) *options {
+	o := &options{
+		maxFileSize:    DefaultMaxFileSize,
+		mergeThreshold: DefaultMergeThreshold,
+		syncMode:       helper.SyncNone,
+		syncInterval:   helper.DefaultSyncInterval,
+		lockTimeout:    helper.DefaultLockTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithMaxFileSize - Size at which the data file being written is sealed and a new one started
+func WithMaxFileSize(bytes int64) Option {
+	return func(o *options) {
+		o.maxFileSize = bytes
+	}
+}
+
+// WithMergeThreshold - Share of the data files taken by overwritten and deleted records
+// above which sealing a file merges them, 0 disables automatic merges
+func WithMergeThreshold(ratio float64) Option {
+	return func(o *options) {
+		o.mergeThreshold = ratio
+	}
+}
+
+// WithSync - When appended records are flushed to stable storage, see helper.WithSync
+func WithSync(mode helper.SyncMode, interval time.Duration) Option {
+	return func(o *options) {
+		o.syncMode = mode
+		o.syncInterval = interval
+	}
+}
+
+// WithLockTimeout - How long Open waits for another process to release the directory
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = timeout
+	}
+}
@@ -0,0 +1,124 @@
+package bitcask
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+/**
+DATA FILE FORMAT
+	Data files are append only, every write adds one record per key.
+		0:4   CRC-32 of the rest of the record
+		4:5   flags, flagTombstone for deletes and flagBatch when more records of the same
+		      batch follow
+		5:9   key length
+		9:13  value length
+		13:   key, value
+	Only the last data file is written to. It is sealed once it reaches the file size limit
+	and a new one takes its place.
+*/
+
+const (
+	recordHeaderSize = 13
+
+	flagTombstone = 1 << 0
+	flagBatch     = 1 << 1
+
+	maxKeyLength   = 1 << 16
+	maxValueLength = 1 << 26
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+type record struct {
+	key   string
+	value string
+	flags byte
+}
+
+func (r record) deleted() bool {
+	return r.flags&flagTombstone != 0
+}
+
+func (r record) size() int64 {
+	return int64(recordHeaderSize + len(r.key) + len(r.value))
+}
+
+func appendRecord(buffer []byte, r record) []byte {
+	start := len(buffer)
+	var header [recordHeaderSize]byte
+	header[4] = r.flags
+	binary.LittleEndian.PutUint32(header[5:], uint32(len(r.key)))
+	binary.LittleEndian.PutUint32(header[9:], uint32(len(r.value)))
+	buffer = append(buffer, header[:]...)
+	buffer = append(buffer, r.key...)
+	buffer = append(buffer, r.value...)
+	binary.LittleEndian.PutUint32(buffer[start:], crc32.ChecksumIEEE(buffer[start+4:]))
+	return buffer
+}
+
+// decodeRecord - Decodes a whole record read from a data file
+func decodeRecord(buffer []byte) (record, error) {
+	if len(buffer) < recordHeaderSize {
+		return record{}, errCorruptRecord
+	}
+	keyLen := int(binary.LittleEndian.Uint32(buffer[5:]))
+	valueLen := int(binary.LittleEndian.Uint32(buffer[9:]))
+	if recordHeaderSize+keyLen+valueLen != len(buffer) {
+		return record{}, errCorruptRecord
+	}
+	if crc32.ChecksumIEEE(buffer[4:]) != binary.LittleEndian.Uint32(buffer) {
+		return record{}, errCorruptRecord
+	}
+	key := buffer[recordHeaderSize : recordHeaderSize+keyLen]
+	return record{key: string(key), value: string(buffer[recordHeaderSize+keyLen:]), flags: buffer[4]}, nil
+}
+
+// scanRecords - Calls fn with every intact record of the file and its offset, returning the
+// offset where the intact records end. A batch only reaches fn once its last record was read.
+func scanRecords(file *os.File, fn func(r record, offset int64)) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	type pendingRecord struct {
+		r      record
+		offset int64
+	}
+	var pending []pendingRecord
+	var offset, end int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return end, nil
+		}
+		keyLen := binary.LittleEndian.Uint32(header[5:])
+		valueLen := binary.LittleEndian.Uint32(header[9:])
+		if keyLen == 0 || keyLen > maxKeyLength || valueLen > maxValueLength {
+			return end, nil
+		}
+		buffer := make([]byte, recordHeaderSize+int(keyLen)+int(valueLen))
+		copy(buffer, header)
+		if _, err := io.ReadFull(reader, buffer[recordHeaderSize:]); err != nil {
+			return end, nil
+		}
+		r, err := decodeRecord(buffer)
+		if err != nil {
+			return end, nil
+		}
+		pending = append(pending, pendingRecord{r: r, offset: offset})
+		offset += int64(len(buffer))
+		if r.flags&flagBatch != 0 {
+			continue
+		}
+		for _, p := range pending {
+			fn(p.r, p.offset)
+		}
+		pending = pending[:0]
+		end = offset
+	}
+}
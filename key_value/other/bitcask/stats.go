@@ -0,0 +1,34 @@
+package bitcask
+
+// Stats - Figures about the content of a bitcask database. Dead bytes are taken by
+// overwritten and deleted records until a merge drops them.
+type Stats struct {
+	Keys      int64   `json:"keys"`
+	DataFiles int     `json:"data_files"`
+	DataBytes int64   `json:"data_bytes"`
+	LiveBytes int64   `json:"live_bytes"`
+	DeadBytes int64   `json:"dead_bytes"`
+	DeadRatio float64 `json:"dead_ratio"`
+	Merges    uint64  `json:"merges"`
+}
+
+// Stats - Reports the statistics of the database
+func (db *DB) Stats() (*Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	stats := &Stats{
+		Keys:      int64(len(db.keydir)),
+		DataFiles: len(db.files),
+		DataBytes: db.totalBytes,
+		LiveBytes: db.liveBytes,
+		DeadBytes: db.totalBytes - db.liveBytes,
+		Merges:    db.merges,
+	}
+	if db.totalBytes > 0 {
+		stats.DeadRatio = float64(stats.DeadBytes) / float64(db.totalBytes)
+	}
+	return stats, nil
+}
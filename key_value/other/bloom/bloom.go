@@ -0,0 +1,113 @@
+// Package bloom implements the bloom filters the storage engines keep next to their
+// data to skip lookups of keys they don't hold.
+package bloom
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+// DefaultBitsPerKey gives a false positive rate of about 1%.
+const DefaultBitsPerKey = 10
+
+var ErrCorrupt = errors.New("corrupt bloom filter")
+
+// Filter is a bloom filter over byte string keys. It is not safe for concurrent use while
+// keys are added.
+type Filter struct {
+	bits []byte
+	k    uint32
+}
+
+/**
+HASHING
+	Every key is hashed once with 64 bit FNV-1a, the two halves h1 and h2 of the hash give
+	the k probe positions h1 + i*h2 (double hashing), which behaves like k independent hash
+	functions for filters of this size.
+*/
+
+// New returns an empty filter sized for n keys at bitsPerKey bits each.
+func New(n int, bitsPerKey int) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if bitsPerKey < 1 {
+		bitsPerKey = DefaultBitsPerKey
+	}
+	// ln(2) * bits per key probes minimise the false positive rate
+	k := uint32(float64(bitsPerKey) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	if k > 30 {
+		k = 30
+	}
+	bytes := (n*bitsPerKey + 7) / 8
+	if bytes < 8 {
+		bytes = 8
+	}
+	return &Filter{bits: make([]byte, bytes), k: k}
+}
+
+func hash(key []byte) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	// An even step would only ever probe half of the bits
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+// Add inserts the key into the filter.
+func (f *Filter) Add(key []byte) {
+	h1, h2 := hash(key)
+	m := uint32(len(f.bits) * 8)
+	for i := uint32(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// MayContain reports whether the key may have been added. A false answer is certain.
+func (f *Filter) MayContain(key []byte) bool {
+	h1, h2 := hash(key)
+	m := uint32(len(f.bits) * 8)
+	for i := uint32(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % m
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FalsePositiveRate estimates how often MayContain answers true for a key that was never
+// added, once n keys have been.
+func (f *Filter) FalsePositiveRate(n int) float64 {
+	m := float64(len(f.bits) * 8)
+	k := float64(f.k)
+	return math.Pow(1-math.Exp(-k*float64(n)/m), k)
+}
+
+// Size returns the size of the encoded filter in bytes.
+func (f *Filter) Size() int {
+	return len(f.bits) + 1
+}
+
+// Encode returns the filter as bytes, the number of probes followed by the bit array.
+func (f *Filter) Encode() []byte {
+	buffer := make([]byte, 1+len(f.bits))
+	buffer[0] = byte(f.k)
+	copy(buffer[1:], f.bits)
+	return buffer
+}
+
+// Decode reads back a filter written by Encode.
+func Decode(buffer []byte) (*Filter, error) {
+	if len(buffer) < 2 || buffer[0] == 0 || buffer[0] > 30 {
+		return nil, ErrCorrupt
+	}
+	bits := make([]byte, len(buffer)-1)
+	copy(bits, buffer[1:])
+	return &Filter{bits: bits, k: uint32(buffer[0])}, nil
+}
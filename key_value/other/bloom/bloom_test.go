@@ -0,0 +1,53 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilterHasNoFalseNegatives(t *testing.T) {
+	f := New(1000, DefaultBitsPerKey)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.MayContain([]byte(fmt.Sprintf("key-%d", i))) {
+			t.Fatal("Added key reported missing", i)
+		}
+	}
+}
+
+func TestFilterFalsePositiveRate(t *testing.T) {
+	f := New(10000, DefaultBitsPerKey)
+	for i := 0; i < 10000; i++ {
+		f.Add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.MayContain([]byte(fmt.Sprintf("missing-%d", i))) {
+			falsePositives++
+		}
+	}
+	rate := float64(falsePositives) / 10000
+	if rate > 0.03 {
+		t.Error("False positive rate too high", rate)
+	}
+	if estimate := f.FalsePositiveRate(10000); estimate < 0.005 || estimate > 0.02 {
+		t.Error("Unexpected estimate", estimate)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	f := New(10, DefaultBitsPerKey)
+	f.Add([]byte("hola"))
+	decoded, err := Decode(f.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.MayContain([]byte("hola")) || decoded.Size() != f.Size() {
+		t.Error("Decoded filter should match")
+	}
+	if _, err := Decode([]byte{0}); err != ErrCorrupt {
+		t.Error("Short buffer should be rejected", err)
+	}
+}
@@ -0,0 +1,39 @@
+package helper
+
+// Batch - Puts and deletes applied together by DB.Write
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	pair   *Pairs
+	delete bool
+}
+
+// Put - Queue a key value pair to be inserted
+func (b *Batch) Put(key string, value string) {
+	b.ops = append(b.ops, batchOp{pair: NewPair(key, value)})
+}
+
+// Delete - Queue a key to be removed
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{pair: NewPair(key, ""), delete: true})
+}
+
+// Len - Number of queued operations
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// validate - Checks every queued pair before any of them is applied
+func (b *Batch) validate(check func(pair *Pairs) error) error {
+	for _, op := range b.ops {
+		if op.delete {
+			continue
+		}
+		if err := check(op.pair); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package helper
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
@@ -17,6 +20,9 @@ type DiskBlock struct {
 	CurrentChildrenSize uint64   // 8
 	ChildrenBlocksIds   []uint64 // its in range (8id * 30 Sub-id)
 	DataSet             []*Pairs // 3810 = 127*30
+	// Count - Pairs in the subtree of the block, stored after the children ids. A full
+	// page has no room left for a count per child.
+	Count uint64 // 8
 	// 3810+8+8+8 = 3834
 	// 4096-3834 = 262
 	// 262-(8*30) = 22
@@ -47,6 +53,27 @@ func Uint64FromBytes(b []byte) uint64 {
 
 type BlockService struct {
 	file *os.File
+	// dataOffset - Where block 0 starts, files with a header keep it in front of the blocks
+	dataOffset int64
+	format     pageFormat
+	// mapping - Read only mapping of the file used for reads when opened WithMmap
+	mapping  *mmapReader
+	syncer   *Syncer
+	readOnly bool
+	// cache - Recently used blocks, nil when the service was not opened through Open
+	cache *blockCache
+	// header - Header of the file, nil for a legacy file without one
+	header *fileHeader
+	// filter - Bloom filter over the keys of every tree of the file, nil when it has none
+	filter *keyFilter
+	// vlog - Log of the values too long for the pages, nil for a legacy file
+	vlog *valueLog
+	// splits - Nodes split since the open, sequentialSplits of them by appends
+	splits, sequentialSplits uint64
+	// compression - Pages written through the codec since the open
+	compression CompressionStats
+	// dropped - Blocks the write in progress no longer uses, freed once it is done
+	dropped []uint64
 }
 
 func (bs BlockService) GetLatestBlockID() (int64, error) {
@@ -55,13 +82,17 @@ func (bs BlockService) GetLatestBlockID() (int64, error) {
 		return -1, err
 	}
 
-	length := fi.Size()
-	if length == 0 {
+	length := fi.Size() - bs.dataOffset
+	if length <= 0 {
 		return -1, nil
 	}
 
 	// Calculate page number required to  be fetched from disk
-	return (int64(fi.Size()) / int64(BlockSize)) - 1, nil
+	return (length / int64(BlockSize)) - 1, nil
+}
+
+func (bs *BlockService) blockOffset(index int64) int64 {
+	return bs.dataOffset + index*BlockSize
 }
 
 func (bs *BlockService) RootBlockExists() bool {
@@ -100,24 +131,118 @@ func (bs *BlockService) GetBufferFromBlock(block *DiskBlock) []byte {
 		copy(blockBufer[blockOffset:], Uint64ToBytes(block.ChildrenBlocksIds[i]))
 		blockOffset += 8
 	}
+	copy(blockBufer[blockOffset:], Uint64ToBytes(block.Count))
 	return blockBufer
 
 }
 
+// encodeBlock - The raw page of the block in the layout of the file
+func (bs *BlockService) encodeBlock(block *DiskBlock) ([]byte, error) {
+	if bs.prefixed() {
+		return encodePrefixedBlock(block)
+	}
+	return bs.GetBufferFromBlock(block), nil
+}
+
 func (bs *BlockService) WriteBlockToDisk(block *DiskBlock) error {
-	seekOffset := BlockSize * block.Id
-	blockBuffer := bs.GetBufferFromBlock(block)
-	_, err := bs.file.Seek(int64(seekOffset), 0)
+	page, err := bs.encodeBlock(block)
 	if err != nil {
 		return err
 	}
-	_, err = bs.file.Write(blockBuffer)
+	err = bs.writePage(block.Id, page)
 	if err != nil {
 		return err
 	}
+	if bs.cache != nil {
+		bs.cache.put(block)
+	}
 	return nil
 }
 
+// writePage - Writes a raw page into the slot of the block, applying the page format
+func (bs *BlockService) writePage(blockID uint64, page []byte) error {
+	if bs.readOnly {
+		return ErrReadOnly
+	}
+	if bs.cache != nil {
+		bs.cache.invalidate(blockID)
+	}
+	blockBuffer, err := bs.format.encodePage(blockID, page)
+	if err != nil {
+		return err
+	}
+	_, err = bs.file.WriteAt(blockBuffer, bs.blockOffset(int64(blockID)))
+	if err != nil {
+		return err
+	}
+	if bs.format.codec != CodecNone {
+		bs.compression.record(page, blockBuffer)
+	}
+	return nil
+}
+
+// commit - Makes the blocks written so far durable according to the sync mode of the file
+func (bs *BlockService) commit() error {
+	if bs.syncer == nil {
+		return nil
+	}
+	return bs.syncer.Commit()
+}
+
+// close - Syncs pending writes and releases the file, along with its lock
+func (bs *BlockService) close() error {
+	var err error
+	if bs.syncer != nil {
+		err = bs.syncer.Close()
+	}
+	if bs.mapping != nil {
+		if mapErr := bs.mapping.close(); err == nil {
+			err = mapErr
+		}
+	}
+	if bs.vlog != nil {
+		if logErr := bs.vlog.close(); err == nil {
+			err = logErr
+		}
+	}
+	if closeErr := bs.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// withPage - Calls fn with the raw page stored in the slot of the block. When the file is
+// mapped the page may point straight into the mapping and is only valid while fn runs.
+func (bs *BlockService) withPage(index int64, fn func(page []byte) error) error {
+	decode := func(slot []byte) error {
+		page, err := bs.format.decodePage(uint64(index), slot)
+		if err != nil {
+			return err
+		}
+		return fn(page)
+	}
+	if bs.mapping != nil {
+		return bs.mapping.read(bs.blockOffset(index), BlockSize, decode)
+	}
+	blockBuffer := make([]byte, BlockSize)
+	_, err := bs.file.ReadAt(blockBuffer, bs.blockOffset(index))
+	if err != nil {
+		return err
+	}
+	return decode(blockBuffer)
+}
+
+// readPage - Returns a copy of the raw page stored in the slot of the block
+func (bs *BlockService) readPage(index int64) ([]byte, error) {
+	var page []byte
+	err := bs.withPage(index, func(p []byte) error {
+		page = make([]byte, len(p))
+		copy(page, p)
+		return nil
+	})
+	return page, err
+}
+
 func (bs *BlockService) NewBlock() (*DiskBlock, error) {
 	latestBlockID, err := bs.GetLatestBlockID()
 	block := &DiskBlock{}
@@ -160,26 +285,63 @@ func (bs *BlockService) GetBlockFromBuffer(blockBuffer []byte) *DiskBlock {
 		block.ChildrenBlocksIds[i] = Uint64FromBytes(blockBuffer[blockOffset:])
 		blockOffset += 8
 	}
+	block.Count = Uint64FromBytes(blockBuffer[blockOffset:])
 	return block
 }
 
+var errCorruptBlock = errors.New("corrupt block")
+
+// decodeBlock - Like GetBlockFromBuffer, but checks the sizes recorded in the page first so
+// a damaged page is reported instead of decoded into garbage or a panic
+func (bs *BlockService) decodeBlock(page []byte) (*DiskBlock, error) {
+	if bs.prefixed() {
+		p, err := readPrefixedPage(page)
+		if err != nil {
+			return nil, err
+		}
+		return p.decode()
+	}
+	if len(page) < 24 {
+		return nil, errCorruptBlock
+	}
+	leafSize := Uint64FromBytes(page[8:])
+	childrenSize := Uint64FromBytes(page[16:])
+	if leafSize > BlockSize/PairSize || childrenSize > BlockSize/8 ||
+		24+leafSize*PairSize+childrenSize*8+8 > uint64(len(page)) {
+		return nil, fmt.Errorf("%w: %d pairs and %d children don't fit in a block", errCorruptBlock, leafSize, childrenSize)
+	}
+	for i := uint64(0); i < leafSize; i++ {
+		offset := 24 + i*PairSize
+		keyLen := uint64(binary.LittleEndian.Uint16(page[offset:]))
+		valueLen := uint64(binary.LittleEndian.Uint16(page[offset+2:]) &^ valueLogged)
+		if keyLen > maxKeyLength || valueLen > maxValueLength || offset+4+keyLen+valueLen > uint64(len(page)) {
+			return nil, fmt.Errorf("%w: pair %d has invalid lengths", errCorruptBlock, i)
+		}
+	}
+	return bs.GetBlockFromBuffer(page), nil
+}
+
 func (bs *BlockService) GetBlockFromDiskByBlockNumber(index int64) (*DiskBlock, error) {
 	if index < 0 {
 		panic("Index less than 0 asked")
 	}
-
-	offset := index * BlockSize
-	_, err := bs.file.Seek(offset, 0)
-	if err != nil {
-		return nil, err
+	if bs.cache != nil {
+		if block, found := bs.cache.get(uint64(index)); found {
+			return block, nil
+		}
 	}
 
-	blockBuffer := make([]byte, BlockSize)
-	_, err = bs.file.Read(blockBuffer)
+	var block *DiskBlock
+	err := bs.withPage(index, func(blockBuffer []byte) (err error) {
+		block, err = bs.decodeBlock(blockBuffer)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	block := bs.GetBlockFromBuffer(blockBuffer)
+	if bs.cache != nil {
+		bs.cache.put(block)
+	}
 	return block, nil
 }
 
@@ -198,7 +360,7 @@ func (bs *BlockService) GetRootBlock() (*DiskBlock, error) {
 }
 
 func (bs *BlockService) ConvertDiskNodeToBlock(node *DiskNode) *DiskBlock {
-	block := &DiskBlock{Id: node.blockID}
+	block := &DiskBlock{Id: node.blockID, Count: node.count}
 	tempElements := make([]*Pairs, len(node.getElements()))
 	for index, element := range node.getElements() {
 		tempElements[index] = element
@@ -215,6 +377,7 @@ func (bs *BlockService) ConvertDiskNodeToBlock(node *DiskNode) *DiskBlock {
 
 func (bs *BlockService) ConvertBlockToDiskNode(block *DiskBlock) *DiskNode {
 	node := &DiskNode{
+		count:        block.Count,
 		blockID:      block.Id,
 		blockService: bs,
 		keys:         make([]*Pairs, block.CurenLeafSize),
@@ -239,12 +402,12 @@ func (bs *BlockService) GetNodeAtBlockID(blockID uint64) (*DiskNode, error) {
 }
 
 func (bs *BlockService) SaveNewNodeToDisk(n *DiskNode) error {
-	// Get block ID to be assigned to this block
-	lastestBlockID, err := bs.GetLatestBlockID()
+	// Get block ID to be assigned to this block, a free one first
+	blockID, err := bs.allocateBlockID()
 	if err != nil {
 		return err
 	}
-	n.blockID = uint64(lastestBlockID) + 1
+	n.blockID = blockID
 	block := bs.ConvertDiskNodeToBlock(n)
 	return bs.WriteBlockToDisk(block)
 }
@@ -260,7 +423,94 @@ func (bs *BlockService) UpdateRootNode(n *DiskNode) error {
 }
 
 func NewBlockService(file *os.File) *BlockService {
-	return &BlockService{file}
+	return &BlockService{file: file}
+}
+
+// openBlockService - Prepares the block service for a file opened by Open. A new file gets
+// a header describing its format, an existing one is read back with the format recorded
+// in its header, or as a legacy headerless file.
+func openBlockService(file *os.File, o *options) (*BlockService, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		if o.readOnly {
+			return nil, errors.New("cannot open an empty database file read-only")
+		}
+		return initializeHeader(file, o)
+	}
+
+	buffer := make([]byte, BlockSize)
+	if _, err := file.ReadAt(buffer, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !hasHeader(buffer) {
+		return NewBlockService(file), nil
+	}
+	header, err := headerFromBuffer(buffer)
+	if err != nil {
+		return nil, err
+	}
+	format, err := header.pageFormat(o.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockService{file: file, dataOffset: BlockSize, format: format, header: header}, nil
+}
+
+// initializeHeader - Writes the header of a new file, generating its data key when the
+// options ask for encryption
+func initializeHeader(file *os.File, o *options) (*BlockService, error) {
+	header := newFileHeader(o)
+	header.flags |= headerCounted | headerPrefixed
+	format := pageFormat{codec: header.codec}
+	if o.masterKey != nil {
+		dataKey, wrappedKey, err := newDataKey(o.masterKey)
+		if err != nil {
+			return nil, err
+		}
+		header.flags |= headerEncrypted
+		header.wrappedKey = wrappedKey
+		format.cipher, err = newCipher(dataKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := file.WriteAt(header.toBuffer(), 0); err != nil {
+		return nil, err
+	}
+	return &BlockService{file: file, dataOffset: BlockSize, format: format, header: header}, nil
+}
+
+// counted - Whether the pages record the size of their subtree, see counts.go
+func (bs *BlockService) counted() bool {
+	return bs.header != nil && bs.header.flags&headerCounted != 0
+}
+
+func (bs *BlockService) writeHeader() error {
+	if bs.header == nil {
+		return ErrLegacyFile
+	}
+	_, err := bs.file.WriteAt(bs.header.toBuffer(), 0)
+	return err
+}
+
+// catalogRoot - Root block of the bucket catalog, 0 when the file has no buckets
+func (bs *BlockService) catalogRoot() uint64 {
+	if bs.header == nil {
+		return 0
+	}
+	return bs.header.catalogRoot
+}
+
+// setCatalogRoot - Records the root block of the bucket catalog in the header
+func (bs *BlockService) setCatalogRoot(blockID uint64) error {
+	if bs.header == nil {
+		return ErrLegacyFile
+	}
+	bs.header.catalogRoot = blockID
+	return bs.writeHeader()
 }
 
 /**
@@ -1,16 +1,40 @@
 package helper
 
-import "os"
+import (
+	"os"
+	"sync/atomic"
+)
 
 // btree - Our inmemory btree struct
 type btree struct {
 	root node
+	// blockService - Block service of the file backing the tree, nil for a tree of
+	// MemoryNode kept in memory only
+	blockService *BlockService
+	// rootID - Block the root is kept in, 0 for the main tree of a file
+	rootID uint64
+
+	// catalog - Tree of the main tree mapping bucket names to the root block of their tree,
+	// nil until the first bucket is created and for trees kept in memory
+	catalog *btree
+	// buckets - Trees of the buckets, all loaded when the tree is opened
+	buckets map[string]*btree
 }
 
 type node interface {
 	insertPair(value *Pairs, bt *btree) error
 	getValue(key string) (string, error)
-	printTree(level int)
+	deletePair(key string, bt *btree) (bool, error)
+	scan(start string, end string, fn func(pair *Pairs) bool) error
+	printTree(level int) error
+	// Order statistics, see counts.go
+	rank(key string) (int64, error)
+	selectPair(position int64) (*Pairs, error)
+	size() int64
+	// Nearest key lookups, see nearest.go
+	floor(key string) (*Pairs, error)
+	ceiling(key string) (*Pairs, error)
+	last() (*Pairs, error)
 }
 
 func (bt *btree) isRootNode(n node) bool {
@@ -29,30 +53,184 @@ func initializeBtree(path ...string) (*btree, error) {
 		path[0] = "/home/rozz/go/src/KeyValueStore/other/helper/db/freedom.db"
 	}
 
-	file, err := os.OpenFile(path[0], os.O_RDWR|os.O_CREATE, 0666)
+	return openBtree(path[0], defaultOptions())
+}
+
+// openBtree - Open the file at path and load its root node
+func openBtree(path string, o *options) (*btree, error) {
+	flag := os.O_RDWR
+	if !o.mustExist {
+		flag |= os.O_CREATE
+	}
+	if o.readOnly {
+		flag = os.O_RDONLY
+	}
+	file, err := openLocked(path, flag, !o.readOnly, o.lockTimeout)
 	if err != nil {
 		return nil, err
 	}
-	dns := newDiskNodeService(file)
+	if err := finishRotation(path); err != nil {
+		file.Close()
+		return nil, err
+	}
+	bs, err := openBlockService(file, o)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if o.mmap {
+		bs.mapping, err = newMmapReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	bs.readOnly = o.readOnly
+	if o.cacheSize > 0 {
+		bs.cache = newBlockCache(o.cacheSize)
+	}
+	if !o.readOnly {
+		bs.syncer = NewSyncer(file, o.syncMode, o.syncInterval)
+	}
+	if !o.readOnly && bs.header != nil && !bs.counted() {
+		// Written before pages counted their subtree
+		if err := bs.rebuildCounts(); err != nil {
+			bs.close()
+			return nil, err
+		}
+	}
+	if bs.header != nil {
+		if bs.vlog, err = openValueLog(path, o, bs.format); err != nil {
+			bs.close()
+			return nil, err
+		}
+	}
+	dns := newDiskNodeService(bs)
 
 	root, err := dns.getRootNodeFromDisk()
 	if err != nil {
-		panic(err)
+		bs.close()
+		return nil, err
+	}
+	bt := &btree{root: root, blockService: bs, buckets: make(map[string]*btree)}
+	if err := bt.loadBuckets(); err != nil {
+		bs.close()
+		return nil, err
+	}
+	if bs.header != nil {
+		if err := bt.openFilter(path, o.bloomBitsPerKey); err != nil {
+			bs.close()
+			return nil, err
+		}
+	}
+	return bt, nil
+}
+
+// newMemoryBtree - A tree without a file behind it
+func newMemoryBtree() *btree {
+	return &btree{root: &MemoryNode{}, buckets: make(map[string]*btree)}
+}
+
+func (bt *btree) inMemory() bool {
+	return bt.blockService == nil
+}
+
+func (bt *btree) readOnly() bool {
+	return !bt.inMemory() && bt.blockService.readOnly
+}
+
+// commit - Makes the writes done so far as durable as the sync mode promises
+func (bt *btree) commit() error {
+	if bt.inMemory() {
+		return nil
+	}
+	// A committed pair must find its value in the log
+	if log := bt.valueLog(); log != nil {
+		if err := log.commit(); err != nil {
+			return err
+		}
 	}
-	return &btree{root: root}, nil
+	return bt.blockService.commit()
+}
+
+// close - Releases the file backing the tree
+func (bt *btree) close() error {
+	bt.root = nil
+	if bt.inMemory() {
+		return nil
+	}
+	bs := bt.blockService
+	if bs.filter != nil && !bs.readOnly {
+		if err := bs.saveFilter(bs.file.Name()); err != nil {
+			bs.close()
+			return err
+		}
+	}
+	return bs.close()
 }
 
 func (bt *btree) insert(value *Pairs) error {
-	return bt.root.insertPair(value, bt)
+	value, err := bt.logValue(value)
+	if err != nil {
+		return err
+	}
+	filter := bt.filter()
+	if filter == nil {
+		return bt.freeDropped(bt.root.insertPair(value, bt))
+	}
+	size := bt.root.size()
+	if err := bt.freeDropped(bt.root.insertPair(value, bt)); err != nil {
+		return err
+	}
+	filter.add(bt.rootID, value.Key, bt.root.size() > size)
+	return nil
+}
+
+// freeDropped - Frees the blocks the write that returned err dropped, see freelist.go
+func (bt *btree) freeDropped(err error) error {
+	if bt.inMemory() {
+		return err
+	}
+	return bt.blockService.freeDropped(err)
 }
 
 func (bt *btree) get(key string) (string, bool, error) {
-	value, err := bt.root.getValue(key)
+	filter := bt.filter()
+	if filter != nil && !filter.mayContain(bt.rootID, key) {
+		return "", false, nil
+	}
+	pair, err := bt.root.floor(key)
 	if err != nil {
 		return "", false, err
 	}
-	if value == "" {
+	if pair == nil || pair.Key != key || pair.Value == "" {
+		if filter != nil {
+			atomic.AddUint64(&filter.falsePositives, 1)
+		}
 		return "", false, nil
 	}
-	return value, true, nil
+	if pair, err = bt.resolve(pair); err != nil {
+		return "", false, err
+	}
+	return pair.Value, true, nil
+}
+
+func (bt *btree) delete(key string) (bool, error) {
+	found, err := bt.root.deletePair(key, bt)
+	return found, bt.freeDropped(err)
+}
+
+// scan - Calls fn with the pairs in [start, end), values in the value log read back
+func (bt *btree) scan(start string, end string, fn func(pair *Pairs) bool) error {
+	var resolveErr error
+	err := bt.root.scan(start, end, func(pair *Pairs) bool {
+		if pair, resolveErr = bt.resolve(pair); resolveErr != nil {
+			return false
+		}
+		return fn(pair)
+	})
+	if err != nil {
+		return err
+	}
+	return resolveErr
 }
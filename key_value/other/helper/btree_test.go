@@ -18,6 +18,18 @@ func clearDB() string {
 	return path
 }
 
+// clearNamedDB - Like clearDB, for tests that need a file of their own
+func clearNamedDB(name string) string {
+	path := fmt.Sprintf("/home/rozz/go/src/github.com/abdulmajid18/keyVal/key_value/other/helper/db/%s", name)
+	if _, err := os.Stat(path); err == nil {
+		err := os.Remove(path)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return path
+}
+
 func TestBtreeInsert(t *testing.T) {
 	tree, err := initializeBtree(clearDB())
 	if err != nil {
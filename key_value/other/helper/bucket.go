@@ -0,0 +1,268 @@
+package helper
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+/**
+BUCKETS
+	A bucket is a keyspace of its own inside a database file, stored as a separate tree
+	whose root stays in the block it was created in. The bucket catalog is one more tree,
+	mapping every bucket name to the root block of its tree (as a decimal string), and the
+	file header records the root block of the catalog once the first bucket is created.
+		1. Creating a bucket writes an empty root leaf and adds it to the catalog
+		2. Dropping a bucket removes it from the catalog, then puts every block of its tree
+		   on the free list
+	Every bucket tree is loaded when the file is opened. Trees kept in memory have no
+	catalog, their buckets only live in the map of bucket trees.
+*/
+
+var (
+	ErrBucketExists   = errors.New("bucket already exists")
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrBucketName     = errors.New("bucket name must not be empty")
+	// ErrLegacyFile - Buckets are recorded in the file header, which files created before it
+	// existed lack. RotateKey rewrites such a file with a header.
+	ErrLegacyFile = errors.New("database file has no header")
+)
+
+// subtree - Loads the tree rooted at rootID from the file of bt
+func (bt *btree) subtree(rootID uint64) (*btree, error) {
+	root, err := bt.blockService.GetNodeAtBlockID(rootID)
+	if err != nil {
+		return nil, err
+	}
+	return &btree{root: root, blockService: bt.blockService, rootID: rootID}, nil
+}
+
+// newSubtree - Creates an empty tree in a new block of the file of bt
+func (bt *btree) newSubtree() (*btree, error) {
+	root, err := newLeafNode(nil, bt.blockService)
+	if err != nil {
+		return nil, err
+	}
+	return &btree{root: root, blockService: bt.blockService, rootID: root.blockID}, nil
+}
+
+// loadBuckets - Loads the catalog and the tree of every bucket it lists
+func (bt *btree) loadBuckets() error {
+	catalogRoot := bt.blockService.catalogRoot()
+	if catalogRoot == 0 {
+		return nil
+	}
+	catalog, err := bt.subtree(catalogRoot)
+	if err != nil {
+		return err
+	}
+	var entries []*Pairs
+	err = catalog.scan("", "", func(pair *Pairs) bool {
+		entries = append(entries, pair)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		rootID, err := strconv.ParseUint(entry.Value, 10, 64)
+		if err != nil {
+			return err
+		}
+		tree, err := bt.subtree(rootID)
+		if err != nil {
+			return err
+		}
+		bt.buckets[entry.Key] = tree
+	}
+	bt.catalog = catalog
+	return nil
+}
+
+func (bt *btree) bucket(name string) (*btree, error) {
+	tree, found := bt.buckets[name]
+	if !found {
+		return nil, ErrBucketNotFound
+	}
+	return tree, nil
+}
+
+func (bt *btree) createBucket(name string) error {
+	if _, found := bt.buckets[name]; found {
+		return ErrBucketExists
+	}
+	if bt.inMemory() {
+		bt.buckets[name] = newMemoryBtree()
+		return nil
+	}
+	if bt.blockService.header == nil {
+		return ErrLegacyFile
+	}
+	if bt.catalog == nil {
+		catalog, err := bt.newSubtree()
+		if err != nil {
+			return err
+		}
+		if err := bt.blockService.setCatalogRoot(catalog.rootID); err != nil {
+			return err
+		}
+		bt.catalog = catalog
+	}
+	tree, err := bt.newSubtree()
+	if err != nil {
+		return err
+	}
+	if err := bt.catalog.insert(NewPair(name, strconv.FormatUint(tree.rootID, 10))); err != nil {
+		return err
+	}
+	bt.buckets[name] = tree
+	return nil
+}
+
+func (bt *btree) dropBucket(name string) error {
+	tree, found := bt.buckets[name]
+	if !found {
+		return ErrBucketNotFound
+	}
+	if !bt.inMemory() {
+		blockIDs, err := tree.pageIDs()
+		if err != nil {
+			return err
+		}
+		if _, err := bt.catalog.delete(name); err != nil {
+			return err
+		}
+		// Freed once the catalog no longer points to the tree, a crash in between leaks them
+		if err := bt.blockService.freeBlocks(append(blockIDs, tree.rootID)); err != nil {
+			return err
+		}
+	}
+	delete(bt.buckets, name)
+	return nil
+}
+
+// bucketNames - Names of the buckets in alphabetical order
+func (bt *btree) bucketNames() []string {
+	names := make([]string, 0, len(bt.buckets))
+	for name := range bt.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bucket - Keyspace of its own inside a database, created with DB.CreateBucket. Its keys
+// don't clash with the keys of the database or of other buckets.
+type Bucket struct {
+	db   *DB
+	name string
+}
+
+// CreateBucket - Create an empty bucket. Bucket names follow the rules of keys.
+func (db *DB) CreateBucket(name string) error {
+	if name == "" {
+		return ErrBucketName
+	}
+	if err := NewPair(name, "").Validate(); err != nil {
+		return err
+	}
+	return db.update(func() error {
+		return db.storage.createBucket(name)
+	})
+}
+
+// DropBucket - Remove the bucket along with its content
+func (db *DB) DropBucket(name string) error {
+	return db.update(func() error {
+		return db.storage.dropBucket(name)
+	})
+}
+
+// ListBuckets - Names of the buckets of the database in alphabetical order
+func (db *DB) ListBuckets() ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	return db.storage.bucketNames(), nil
+}
+
+// Bucket - Handle of an existing bucket. Once the bucket is dropped its handle returns
+// ErrBucketNotFound.
+func (db *DB) Bucket(name string) (*Bucket, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if _, err := db.storage.bucket(name); err != nil {
+		return nil, err
+	}
+	return &Bucket{db: db, name: name}, nil
+}
+
+// Name - Name of the bucket
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// Put - Insert a key value pair in the bucket, see DB.Put
+func (b *Bucket) Put(key string, value string) error {
+	return b.db.put(b.name, key, value)
+}
+
+// Get - Get the stored value of the key in the bucket
+func (b *Bucket) Get(key string) (string, bool, error) {
+	return b.db.get(b.name, key)
+}
+
+// Delete - Remove the key from the bucket, reporting whether it was stored
+func (b *Bucket) Delete(key string) (bool, error) {
+	return b.db.delete(b.name, key)
+}
+
+// Scan - Call fn with the pairs of the bucket whose key is in [start, end), see DB.Scan
+func (b *Bucket) Scan(start string, end string, fn func(key string, value string) bool) error {
+	return b.db.scan(b.name, start, end, fn)
+}
+
+// DeleteRange - Removes the keys of the bucket in [start, end), see DB.DeleteRange
+func (b *Bucket) DeleteRange(start string, end string) (int64, error) {
+	return b.db.deleteRange(b.name, start, end)
+}
+
+// Count - Number of keys of the bucket in [start, end), see DB.Count
+func (b *Bucket) Count(start string, end string) (int64, error) {
+	return b.db.count(b.name, start, end)
+}
+
+// Rank - Number of keys of the bucket that sort before key
+func (b *Bucket) Rank(key string) (int64, error) {
+	return b.db.rank(b.name, key)
+}
+
+// Select - The pair of the bucket at position n in key order, see DB.Select
+func (b *Bucket) Select(n int64) (string, string, bool, error) {
+	return b.db.selectPair(b.name, n)
+}
+
+// Floor - The pair of the bucket with the largest key at or before key
+func (b *Bucket) Floor(key string) (string, string, bool, error) {
+	return b.db.nearest(b.name, func(tree *btree) (*Pairs, error) { return tree.root.floor(key) })
+}
+
+// Ceiling - The pair of the bucket with the smallest key at or after key
+func (b *Bucket) Ceiling(key string) (string, string, bool, error) {
+	return b.db.nearest(b.name, func(tree *btree) (*Pairs, error) { return tree.root.ceiling(key) })
+}
+
+// Min - The pair of the bucket with the smallest key
+func (b *Bucket) Min() (string, string, bool, error) {
+	return b.db.nearest(b.name, func(tree *btree) (*Pairs, error) { return tree.root.ceiling("") })
+}
+
+// Max - The pair of the bucket with the largest key
+func (b *Bucket) Max() (string, string, bool, error) {
+	return b.db.nearest(b.name, func(tree *btree) (*Pairs, error) { return tree.root.last() })
+}
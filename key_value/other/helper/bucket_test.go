@@ -0,0 +1,206 @@
+package helper
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuckets(t *testing.T) {
+	path := clearNamedDB("buckets.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateBucket("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateBucket("orders"); err != ErrBucketExists {
+		t.Error("A bucket name should only be used once", err)
+	}
+	if err := db.CreateBucket("users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Bucket("missing"); err != ErrBucketNotFound {
+		t.Error("Unknown bucket should be reported", err)
+	}
+
+	orders, err := db.Bucket("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, _ := db.Bucket("users")
+	// Enough keys for the bucket trees to split their root
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%04d", i)
+		if err := orders.Put(key, "order"); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			users.Put(key, "user")
+		}
+	}
+	db.Put("key-0001", "main")
+	for i := 0; i < 1000; i += 3 {
+		if found, err := orders.Delete(fmt.Sprintf("key-%04d", i)); err != nil || !found {
+			t.Fatal("Delete should find the key in the bucket", i, err)
+		}
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	names, _ := db.ListBuckets()
+	if fmt.Sprint(names) != "[orders users]" {
+		t.Error("Buckets should survive a reopen", names)
+	}
+	orders, _ = db.Bucket("orders")
+	users, _ = db.Bucket("users")
+	if value, _, _ := db.Get("key-0001"); value != "main" {
+		t.Error("Keys of the database and of buckets should not clash", value)
+	}
+	if value, _, _ := orders.Get("key-0001"); value != "order" {
+		t.Error("Bucket lost its value", value)
+	}
+	if _, found, _ := orders.Get("key-0003"); found {
+		t.Error("Deleted key should be gone from the bucket")
+	}
+	count := 0
+	users.Scan("", "", func(key string, value string) bool {
+		count++
+		return value == "user"
+	})
+	if count != 500 {
+		t.Error("Scan should stay within the bucket", count)
+	}
+
+	report, err := db.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || report.Buckets != 2 || report.Keys != 1+666+500 {
+		t.Fatal("Check should walk every bucket", report.Keys, report.Buckets, report.Problems)
+	}
+	stats, _ := db.Stats()
+	if stats.Buckets != 2 || stats.Keys != report.Keys {
+		t.Error("Stats should count the buckets", stats)
+	}
+
+	if err := db.DropBucket("users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := users.Get("key-0000"); err != ErrBucketNotFound {
+		t.Error("Handle of a dropped bucket should fail", err)
+	}
+	if err := db.DropBucket("users"); err != ErrBucketNotFound {
+		t.Error("Dropping twice should fail", err)
+	}
+	if names, _ := db.ListBuckets(); fmt.Sprint(names) != "[orders]" {
+		t.Error("Dropped bucket should not be listed", names)
+	}
+}
+
+func TestRepairKeepsBuckets(t *testing.T) {
+	src := clearNamedDB("buckets-src.db")
+	dst := clearNamedDB("buckets-dst.db")
+	db, err := Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.CreateBucket("orders")
+	orders, _ := db.Bucket("orders")
+	for i := 0; i < 200; i++ {
+		db.Put(fmt.Sprintf("key-%03d", i), "main")
+		orders.Put(fmt.Sprintf("key-%03d", i), "order")
+	}
+	db.Close()
+
+	report, err := Repair(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RecoveredBuckets != 1 || report.RecoveredPairs != 400 {
+		t.Error("Repair should recover the bucket", report)
+	}
+	repaired, err := Open(dst, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repaired.Close()
+	orders, err = repaired.Bucket("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := orders.Get("key-150"); value != "order" {
+		t.Error("Repaired bucket lost its value", value)
+	}
+	if value, _, _ := repaired.Get("key-150"); value != "main" {
+		t.Error("Repaired database lost its value", value)
+	}
+}
+
+func TestMemoryBucketsSnapshot(t *testing.T) {
+	db := OpenMemory()
+	db.CreateBucket("orders")
+	orders, _ := db.Bucket("orders")
+	for i := 0; i < 100; i++ {
+		orders.Put(fmt.Sprintf("key-%03d", i), "order")
+	}
+	path := clearNamedDB("buckets-snapshot.db")
+	if err := db.Snapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	disk, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	orders, err = disk.Bucket("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := orders.Get("key-042"); value != "order" {
+		t.Error("Snapshot should copy the buckets", value)
+	}
+}
+
+func TestDropBucketFreesBlocks(t *testing.T) {
+	db, err := Open(clearNamedDB("buckets_drop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fill := func(name string) {
+		t.Helper()
+		if err := db.CreateBucket(name); err != nil {
+			t.Fatal(err)
+		}
+		bucket, _ := db.Bucket(name)
+		for i := 0; i < 500; i++ {
+			if err := bucket.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%040d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fill("first")
+	before, err := db.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropBucket("first"); err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := db.Check()
+	if err != nil || !dropped.OK || len(dropped.Unreachable) != 0 || dropped.FreeBlocks < before.ReachableCount-2 {
+		t.Fatal("The blocks of a dropped bucket should go to the free list", before, dropped, err)
+	}
+	fill("second")
+	after, err := db.Check()
+	if err != nil || after.TotalBlocks != before.TotalBlocks {
+		t.Error("A new bucket should reuse the blocks of the dropped one", before.TotalBlocks, after, err)
+	}
+}
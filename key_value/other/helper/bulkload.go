@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"errors"
+	"sort"
+)
+
+/**
+BULK LOADING
+	Builds a tree bottom up from sorted pairs instead of inserting them one by one.
+		1. Split the pairs into runs of at most bulkLoadFill pairs, keeping one pair between
+		   every two runs as their separator. Each run becomes a node, the first level has no
+		   children, higher levels take the next len(run)+1 nodes of the level below.
+		2. The separators are the pairs of the next level up, repeat until they fit in one node
+		3. That last node is the root and is written into the root block of the tree, block 0
+		   for the main tree, which was reserved up front
+	Nodes are left partly empty so the first inserts after loading don't split right away.
+	With prefix compressed pages the pairs of a level are packed by their average size
+	(levelFill), fewer per node when some run of them would not fit in a page.
+*/
+
+// bulkLoadFill - Pairs packed into each node by the bulk loader, whatever their size
+func (bs *BlockService) bulkLoadFill() int {
+	if bs.prefixed() {
+		return prefixedMaxKeys * 3 / 4
+	}
+	return bs.GetMaxLeafSize() * 3 / 4
+}
+
+// levelFill - Pairs packed into each node of a level holding the given pairs
+func (bs *BlockService) levelFill(pairs []*Pairs, internal bool) int {
+	fill := bs.bulkLoadFill()
+	if !bs.prefixed() {
+		return fill
+	}
+	average := (prefixedSize(pairs, internal) - prefixedHeaderSize) / len(pairs)
+	best := (prefixedPageSize*3/4 - prefixedHeaderSize) / average
+	for ; best > fill; best -= best/8 + 1 {
+		if bs.levelFits(pairs, internal, best) {
+			return best
+		}
+	}
+	return fill
+}
+
+// levelFits - Whether every node of the level fits in a page when packed with fill pairs
+func (bs *BlockService) levelFits(pairs []*Pairs, internal bool, fill int) bool {
+	next := 0
+	for _, size := range bulkRuns(len(pairs), fill) {
+		if !bs.nodeFits(pairs[next:next+size], internal) {
+			return false
+		}
+		next += size + 1
+	}
+	return true
+}
+
+// bulkRuns - Sizes of the runs of a level of the given number of pairs, one pair between
+// every two runs is left out as their separator. The pairs are spread evenly, the first
+// runs take one extra when they don't divide.
+func bulkRuns(pairs int, fill int) []int {
+	nodes := (pairs + 1 + fill) / (fill + 1)
+	packed := pairs - (nodes - 1)
+	runs := make([]int, nodes)
+	for i := range runs {
+		runs[i] = packed / nodes
+		if i < packed%nodes {
+			runs[i]++
+		}
+	}
+	return runs
+}
+
+// bulkLoad - Replaces the content of an empty tree with the given pairs, sorted by key
+func (bt *btree) bulkLoad(pairs []*Pairs) error {
+	bs := bt.blockService
+	if root, ok := bt.root.(*DiskNode); !ok || !root.isLeaf() || len(root.keys) > 0 {
+		return errors.New("bulk loading needs an empty tree")
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	for i, pair := range pairs {
+		var err error
+		if pairs[i], err = bt.logValue(pair); err != nil {
+			return err
+		}
+	}
+	if bs.filter != nil {
+		for _, pair := range pairs {
+			bs.filter.add(bt.rootID, pair.Key, true)
+		}
+	}
+
+	var children []uint64
+	// counts - Pairs under each of the children, so parents know the size of their subtree
+	var counts []uint64
+	for !bs.nodeFits(pairs, children != nil) {
+		runs := bulkRuns(len(pairs), bs.levelFill(pairs, children != nil))
+
+		var separators []*Pairs
+		var parents, parentCounts []uint64
+		next := 0
+		for i, size := range runs {
+			node := &DiskNode{keys: pairs[next : next+size], count: uint64(size), blockService: bs}
+			next += size
+			if children != nil {
+				node.childrenBlockIDs, children = children[:size+1], children[size+1:]
+				node.count += sumCounts(counts[:size+1])
+				counts = counts[size+1:]
+			}
+			if err := bs.SaveNewNodeToDisk(node); err != nil {
+				return err
+			}
+			parents = append(parents, node.blockID)
+			parentCounts = append(parentCounts, node.count)
+			if i < len(runs)-1 {
+				separators = append(separators, pairs[next])
+				next++
+			}
+		}
+		pairs, children, counts = separators, parents, parentCounts
+	}
+
+	root := &DiskNode{keys: pairs, childrenBlockIDs: children, blockID: bt.rootID,
+		count: uint64(len(pairs)) + sumCounts(counts), blockService: bs}
+	if err := bs.UpdateNodeToDisk(root); err != nil {
+		return err
+	}
+	bt.setRootNode(root)
+	return nil
+}
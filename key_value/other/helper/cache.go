@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize - Number of decoded blocks kept in memory by a database opened with Open
+const DefaultCacheSize = 64
+
+// blockCache - Least recently used cache of decoded blocks. Blocks are copied on the way in
+// and out so callers are free to modify the blocks they are handed.
+type blockCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[uint64]*list.Element
+	lru      *list.List
+	hits     uint64
+	misses   uint64
+}
+
+func newBlockCache(capacity int) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		entries:  make(map[uint64]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func copyBlock(block *DiskBlock) *DiskBlock {
+	clone := *block
+	clone.DataSet = append([]*Pairs(nil), block.DataSet...)
+	clone.ChildrenBlocksIds = append([]uint64(nil), block.ChildrenBlocksIds...)
+	return &clone
+}
+
+func (c *blockCache) get(blockID uint64) (*DiskBlock, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, found := c.entries[blockID]
+	if !found {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return copyBlock(elem.Value.(*DiskBlock)), true
+}
+
+func (c *blockCache) put(block *DiskBlock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[block.Id]; found {
+		elem.Value = copyBlock(block)
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[block.Id] = c.lru.PushFront(copyBlock(block))
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*DiskBlock).Id)
+	}
+}
+
+func (c *blockCache) invalidate(blockID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[blockID]; found {
+		c.lru.Remove(elem)
+		delete(c.entries, blockID)
+	}
+}
+
+// counters - Returns the number of lookups served from the cache and from the file
+func (c *blockCache) counters() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
@@ -0,0 +1,268 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Kinds of problems reported by Check
+const (
+	ProblemUnreadable  = "unreadable"
+	ProblemBlockID     = "block_id_mismatch"
+	ProblemOutOfRange  = "child_out_of_range"
+	ProblemReferenced  = "referenced_twice"
+	ProblemKeyOrder    = "key_order"
+	ProblemChildCount  = "child_count"
+	ProblemLeafDepth   = "leaf_depth"
+	ProblemUnreachable = "unreachable"
+	ProblemBucket      = "bad_bucket"
+	ProblemCount       = "subtree_count"
+	ProblemFreeList    = "bad_free_list"
+	ProblemFreeInUse   = "free_block_in_use"
+	ProblemValueLog    = "bad_value_pointer"
+)
+
+// CheckProblem - One inconsistency found in a block
+type CheckProblem struct {
+	BlockID uint64 `json:"block_id"`
+	Kind    string `json:"kind"`
+	Detail  string `json:"detail"`
+}
+
+// CheckReport - Outcome of checking a database file. Unreachable blocks are listed but
+// don't make the file unhealthy, a write interrupted before freeing the blocks it dropped
+// leaves them behind, so do splits in legacy files.
+type CheckReport struct {
+	OK             bool  `json:"ok"`
+	TotalBlocks    int64 `json:"total_blocks"`
+	ReachableCount int64 `json:"reachable_blocks"`
+	// Keys - Pairs of the main tree and of every bucket
+	Keys int64 `json:"keys"`
+	// LeafDepth - Depth of the leaves of the main tree
+	LeafDepth int `json:"leaf_depth"`
+	Buckets   int `json:"buckets"`
+	// FreeBlocks - Blocks on the free list, they are not listed as unreachable
+	FreeBlocks  int64          `json:"free_blocks"`
+	Unreachable []uint64       `json:"unreachable_blocks"`
+	Problems    []CheckProblem `json:"problems"`
+}
+
+func (r *CheckReport) problem(blockID uint64, kind string, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, CheckProblem{BlockID: blockID, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// keyBounds - Range the keys of a subtree must fall in, an empty side is unbounded
+type keyBounds struct {
+	low, high       string
+	hasLow, hasHigh bool
+}
+
+/**
+CHECK ALGORITHM
+	Walk every block reachable from the root depth first, carrying the key range the
+	subtree has to respect (the separators of its parent) and its depth.
+		1. The block must decode and record its own id
+		2. Keys are strictly increasing inside the block and fall strictly within the range
+		   given by the parent, a separator is a pair of its block and can't appear again
+		   in either of its subtrees
+		3. An internal block has exactly one child more than it has keys
+		4. Every leaf sits at the depth of the first leaf of its tree
+		5. No block is reached twice, a second reference is reported and not followed
+		6. The count recorded by a block is the number of pairs in its subtree, unless the
+		   file was written before pages counted their subtree
+	The bucket catalog is walked the same way after the main tree, then the tree of every
+	bucket it lists. The blocks of the free list must be empty and reached by none of the
+	walks. Finally every other slot of the file the walks never reached is reported as
+	unreachable.
+*/
+
+// treeWalk - State of the check of one tree
+type treeWalk struct {
+	leafDepth int
+	// catalog - Set for the catalog, whose pairs are collected instead of counted
+	catalog bool
+	entries []*Pairs
+}
+
+// check - Verifies the structure of the tree
+func (bt *btree) check() (*CheckReport, error) {
+	if bt.inMemory() {
+		return nil, ErrInMemory
+	}
+	bs := bt.blockService
+	report := &CheckReport{Unreachable: []uint64{}, Problems: []CheckProblem{}, LeafDepth: -1}
+	latestBlockID, err := bs.GetLatestBlockID()
+	if err != nil {
+		return nil, err
+	}
+	report.TotalBlocks = latestBlockID + 1
+
+	visited := make(map[uint64]bool)
+	// walk - Checks the subtree of the block and returns the number of pairs found in it
+	var walk func(blockID uint64, bounds keyBounds, depth int, tree *treeWalk) uint64
+	walk = func(blockID uint64, bounds keyBounds, depth int, tree *treeWalk) uint64 {
+		if visited[blockID] {
+			report.problem(blockID, ProblemReferenced, "block is referenced more than once")
+			return 0
+		}
+		visited[blockID] = true
+		block, err := bs.readBlock(int64(blockID))
+		if err != nil {
+			report.problem(blockID, ProblemUnreadable, "%v", err)
+			return 0
+		}
+		count := uint64(len(block.DataSet))
+		defer func() {
+			if bs.counted() && block.Count != count {
+				report.problem(blockID, ProblemCount, "block counts %d pairs, its subtree holds %d", block.Count, count)
+			}
+		}()
+		if block.Id != blockID {
+			report.problem(blockID, ProblemBlockID, "block records id %d", block.Id)
+		}
+		if tree.catalog {
+			tree.entries = append(tree.entries, block.DataSet...)
+		} else {
+			report.Keys += int64(len(block.DataSet))
+		}
+
+		for i, pair := range block.DataSet {
+			if i > 0 && pair.Key <= block.DataSet[i-1].Key {
+				report.problem(blockID, ProblemKeyOrder, "key %q doesn't sort after its predecessor %q", pair.Key, block.DataSet[i-1].Key)
+			}
+			if pair.logged() {
+				if _, err := bt.resolve(pair); err != nil {
+					report.problem(blockID, ProblemValueLog, "value of key %q: %v", pair.Key, err)
+				}
+			}
+			if bounds.hasLow && pair.Key <= bounds.low {
+				report.problem(blockID, ProblemKeyOrder, "key %q doesn't sort after the parent separator %q", pair.Key, bounds.low)
+			}
+			if bounds.hasHigh && pair.Key >= bounds.high {
+				report.problem(blockID, ProblemKeyOrder, "key %q doesn't sort before the parent separator %q", pair.Key, bounds.high)
+			}
+		}
+
+		if block.CurrentChildrenSize == 0 {
+			if tree.leafDepth == -1 {
+				tree.leafDepth = depth
+			} else if depth != tree.leafDepth {
+				report.problem(blockID, ProblemLeafDepth, "leaf at depth %d, expected %d", depth, tree.leafDepth)
+			}
+			return count
+		}
+		if block.CurrentChildrenSize != block.CurenLeafSize+1 {
+			report.problem(blockID, ProblemChildCount, "%d children for %d keys", block.CurrentChildrenSize, block.CurenLeafSize)
+			return count
+		}
+		for i, childID := range block.ChildrenBlocksIds {
+			if int64(childID) > latestBlockID {
+				report.problem(blockID, ProblemOutOfRange, "child %d points past the end of the file", childID)
+				continue
+			}
+			childBounds := bounds
+			if i > 0 {
+				childBounds.low, childBounds.hasLow = block.DataSet[i-1].Key, true
+			}
+			if i < len(block.DataSet) {
+				childBounds.high, childBounds.hasHigh = block.DataSet[i].Key, true
+			}
+			count += walk(childID, childBounds, depth+1, tree)
+		}
+		return count
+	}
+	if report.TotalBlocks > 0 {
+		main := &treeWalk{leafDepth: -1}
+		walk(0, keyBounds{}, 0, main)
+		report.LeafDepth = main.leafDepth
+	}
+
+	if catalogRoot := bs.catalogRoot(); catalogRoot != 0 {
+		catalog := &treeWalk{leafDepth: -1, catalog: true}
+		if int64(catalogRoot) > latestBlockID {
+			report.problem(catalogRoot, ProblemOutOfRange, "bucket catalog points past the end of the file")
+		} else {
+			walk(catalogRoot, keyBounds{}, 0, catalog)
+		}
+		for _, entry := range catalog.entries {
+			rootID, err := strconv.ParseUint(entry.Value, 10, 64)
+			if err != nil || int64(rootID) > latestBlockID {
+				report.problem(catalogRoot, ProblemBucket, "bucket %q has no valid root block (%q)", entry.Key, entry.Value)
+				continue
+			}
+			report.Buckets++
+			walk(rootID, keyBounds{}, 0, &treeWalk{leafDepth: -1})
+		}
+	}
+
+	report.ReachableCount = int64(len(visited))
+	free := make(map[uint64]bool)
+	freeIDs, err := bs.freeBlockIDs()
+	if err != nil {
+		report.problem(bs.header.freeList, ProblemFreeList, "%v after %d blocks", err, len(freeIDs))
+	}
+	for _, blockID := range freeIDs {
+		if visited[blockID] {
+			report.problem(blockID, ProblemFreeInUse, "block is on the free list and in a tree")
+		}
+		free[blockID] = true
+	}
+	report.FreeBlocks = int64(len(free))
+	for id := int64(0); id < report.TotalBlocks; id++ {
+		if !visited[uint64(id)] && !free[uint64(id)] {
+			report.Unreachable = append(report.Unreachable, uint64(id))
+		}
+	}
+	report.OK = len(report.Problems) == 0
+	return report, nil
+}
+
+// Check - Verify the structure of the open database
+func (db *DB) Check() (*CheckReport, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	return db.storage.check()
+}
+
+// Check - Reads the file at path block by block and verifies its structure. The trees
+// aren't loaded, a file whose root is damaged is reported on instead of failing to open.
+// The options are the ones the file is normally opened with, an encrypted file needs its
+// key.
+func Check(path string, opts ...Option) (*CheckReport, error) {
+	bs, err := openInspected(path, buildOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	defer bs.close()
+	return (&btree{blockService: bs}).check()
+}
+
+// openInspected - Opens the file at path read-only along with its value log, without
+// reading any of its blocks
+func openInspected(path string, o *options) (*BlockService, error) {
+	file, err := openLocked(path, os.O_RDONLY, false, o.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := finishRotation(path); err != nil {
+		file.Close()
+		return nil, err
+	}
+	bs, err := openBlockService(file, &options{masterKey: o.masterKey, readOnly: true})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	bs.readOnly = true
+	if bs.header != nil {
+		if bs.vlog, err = openValueLog(path, &options{readOnly: true}, bs.format); err != nil {
+			bs.close()
+			return nil, err
+		}
+	}
+	return bs, nil
+}
@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func fillCheckDB(t *testing.T, path string) {
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 200; i++ {
+		if err := db.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%040d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckHealthyFile(t *testing.T) {
+	path := clearNamedDB("check.db")
+	fillCheckDB(t, path)
+
+	report, err := Check(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || len(report.Problems) != 0 {
+		t.Error("Fresh file should be healthy", report.Problems)
+	}
+	if report.Keys != 200 || report.LeafDepth < 1 {
+		t.Error("Unexpected report", report)
+	}
+	if report.ReachableCount+report.FreeBlocks+int64(len(report.Unreachable)) != report.TotalBlocks {
+		t.Error("Every block should be reachable, free or reported", report)
+	}
+}
+
+func TestCheckReportsDamage(t *testing.T) {
+	path := clearNamedDB("check.db")
+	fillCheckDB(t, path)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := db.storage.blockService
+	root, err := bs.GetRootBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Swap the keys of the first leaf and point the last child at the first one
+	leaf, err := bs.GetBlockFromDiskByBlockNumber(int64(root.ChildrenBlocksIds[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf.DataSet[0], leaf.DataSet[1] = leaf.DataSet[1], leaf.DataSet[0]
+	if err := bs.WriteBlockToDisk(leaf); err != nil {
+		t.Fatal(err)
+	}
+	root.ChildrenBlocksIds[len(root.ChildrenBlocksIds)-1] = root.ChildrenBlocksIds[0]
+	if err := bs.WriteBlockToDisk(root); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	report, err := Check(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK {
+		t.Fatal("Damaged file should not be healthy")
+	}
+	kinds := make(map[string]bool)
+	for _, problem := range report.Problems {
+		kinds[problem.Kind] = true
+	}
+	if !kinds[ProblemKeyOrder] || !kinds[ProblemReferenced] {
+		t.Error("Expected key order and double reference problems", report.Problems)
+	}
+	if len(report.Unreachable) == 0 {
+		t.Error("The dropped leaf should be unreachable", report)
+	}
+}
+
+func TestCheckReportsDuplicateKeys(t *testing.T) {
+	path := clearNamedDB("check_duplicate.db")
+	fillCheckDB(t, path)
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := db.storage.blockService
+	root, err := bs.GetRootBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repeat a key inside the first leaf, and the first separator of the root at the start
+	// of the child right of it
+	first, err := bs.GetBlockFromDiskByBlockNumber(int64(root.ChildrenBlocksIds[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.DataSet[1] = NewPair(first.DataSet[0].Key, first.DataSet[1].Value)
+	if err := bs.WriteBlockToDisk(first); err != nil {
+		t.Fatal(err)
+	}
+	second, err := bs.GetBlockFromDiskByBlockNumber(int64(root.ChildrenBlocksIds[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.DataSet[0] = NewPair(root.DataSet[0].Key, second.DataSet[0].Value)
+	if err := bs.WriteBlockToDisk(second); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	report, err := Check(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := make(map[uint64]bool)
+	for _, problem := range report.Problems {
+		if problem.Kind != ProblemKeyOrder {
+			t.Error("Only the key order should be reported", problem)
+		}
+		damaged[problem.BlockID] = true
+	}
+	if report.OK || !damaged[first.Id] || !damaged[second.Id] || len(damaged) != 2 {
+		t.Error("Both duplicate keys should be reported", report.Problems)
+	}
+}
+
+func TestCheckWithoutOpening(t *testing.T) {
+	path := clearNamedDB("check_root.db")
+	fillCheckDB(t, path)
+
+	// A root that doesn't decode keeps the file from opening, Check still reports on it
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, BlockSize+8)
+	file.Close()
+	if _, err := Open(path, WithReadOnly()); err == nil {
+		t.Fatal("Damaged root should not open")
+	}
+	report, err := Check(path)
+	if err != nil {
+		t.Fatal("Check should report on a damaged root", err)
+	}
+	if report.OK || len(report.Problems) == 0 || report.Problems[0].BlockID != 0 || report.Problems[0].Kind != ProblemUnreadable {
+		t.Error("The root should be reported unreadable", report.Problems)
+	}
+
+	// A file with only its header holds no blocks to check
+	file, err = os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := initializeHeader(file, &options{}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if report, err := Check(path); err != nil || !report.OK || report.TotalBlocks != 0 {
+		t.Error("A file with only its header should be healthy", report, err)
+	}
+}
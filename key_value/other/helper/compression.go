@@ -0,0 +1,124 @@
+package helper
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Codec - Compression applied to pages before they are written to disk. A compressed page
+// still takes a whole block slot, compression doesn't make the file smaller.
+type Codec uint8
+
+const (
+	CodecNone Codec = iota
+	CodecFlate
+)
+
+var codecNames = map[Codec]string{
+	CodecNone:  "none",
+	CodecFlate: "flate",
+}
+
+func (c Codec) String() string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("codec(%d)", uint8(c))
+}
+
+func (c Codec) valid() bool {
+	_, ok := codecNames[c]
+	return ok
+}
+
+// ParseCodec - Returns the codec with the given name (none|flate)
+func ParseCodec(name string) (Codec, error) {
+	for codec, codecName := range codecNames {
+		if codecName == name {
+			return codec, nil
+		}
+	}
+	return CodecNone, fmt.Errorf("unknown compression codec %q", name)
+}
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// CompressionStats - Pages written through the codec of a file. The slots keep BlockSize
+// whatever the pages compress to, the counters tell how compressible they are, not how
+// much disk space was saved.
+type CompressionStats struct {
+	PagesWritten uint64 `json:"pages_written"`
+	// PageBytes - Bytes of the pages without their trailing zeros, the part the codec is
+	// given
+	PageBytes uint64 `json:"page_bytes"`
+	// CompressedBytes - Bytes of the payloads the codec turned them into, pages that
+	// didn't shrink are stored as they are and sealed ones count their nonce and tag
+	CompressedBytes uint64 `json:"compressed_bytes"`
+	// Ratio - CompressedBytes over PageBytes, below 1 when the pages compress
+	Ratio float64 `json:"ratio"`
+}
+
+// record - Counts the page written in the slot
+func (c *CompressionStats) record(page []byte, slot []byte) {
+	c.PagesWritten++
+	c.PageBytes += uint64(len(bytes.TrimRight(page, "\x00")))
+	c.CompressedBytes += uint64(binary.LittleEndian.Uint32(slot[1:]))
+	if c.PageBytes > 0 {
+		c.Ratio = float64(c.CompressedBytes) / float64(c.PageBytes)
+	}
+}
+
+// Compression - Pages written through the codec since the open, nil without a codec or
+// once closed. Unlike Stats it doesn't walk the tree.
+func (db *DB) Compression() *CompressionStats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed || db.storage.inMemory() || db.storage.blockService.format.codec == CodecNone {
+		return nil
+	}
+	compression := db.storage.blockService.compression
+	return &compression
+}
+
+func compress(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inflate - Decompresses a payload into a BlockSize page
+func inflate(payload []byte) ([]byte, error) {
+	page := make([]byte, BlockSize)
+	r := flate.NewReader(bytes.NewReader(payload))
+	defer r.Close()
+	n, err := io.ReadFull(r, page)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%w: %v", errCorruptPage, err)
+	}
+	if n == len(page) {
+		// A valid page never inflates past BlockSize
+		var extra [1]byte
+		if m, _ := r.Read(extra[:]); m > 0 {
+			return nil, errCorruptPage
+		}
+	}
+	return page, nil
+}
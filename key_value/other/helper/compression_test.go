@@ -0,0 +1,147 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestShouldEncodeAndDecodePage(t *testing.T) {
+	bs := initBlockService()
+	block := &DiskBlock{Id: 7}
+	block.SetData([]*Pairs{NewPair("hola", "amigos"), NewPair("foo", "bar")})
+	block.SetChildren([]uint64{1, 2, 3})
+	page := bs.GetBufferFromBlock(block)
+
+	format := pageFormat{codec: CodecFlate}
+	slot, err := format.encodePage(block.Id, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slot) != BlockSize {
+		t.Error("Encoded slot should keep the block size", len(slot))
+	}
+	if slot[0]&pageCompressed == 0 {
+		t.Error("Page should have been compressed")
+	}
+	decoded, err := format.decodePage(block.Id, slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, page) {
+		t.Error("Decoded page does not match the original page")
+	}
+}
+
+func TestShouldRejectCorruptPage(t *testing.T) {
+	slot := make([]byte, BlockSize)
+	slot[0] = pageCompressed
+	slot[1] = 0xff
+	slot[2] = 0xff
+	if _, err := (pageFormat{codec: CodecFlate}).decodePage(0, slot); err == nil {
+		t.Error("Should fail on a payload longer than the slot")
+	}
+}
+
+func TestOpenWithCompression(t *testing.T) {
+	path := clearNamedDB("compressed.db")
+	db, err := Open(path, WithCompression(CodecFlate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 200; i++ {
+		if err := db.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf(`{"value":%d}`, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Compression == nil || stats.Compression.PagesWritten == 0 {
+		t.Fatal("Compressed pages should be counted", stats.Compression)
+	}
+	if stats.Compression.CompressedBytes >= stats.Compression.PageBytes || stats.Compression.Ratio >= 1 || stats.Compression.Ratio <= 0 {
+		t.Error("Pages should compress", stats.Compression)
+	}
+	if compression := db.Compression(); compression == nil || *compression != *stats.Compression {
+		t.Error("The counters should be read without a walk", compression)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The codec comes from the header, not from the options of later opens
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 200; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || value != fmt.Sprintf(`{"value":%d}`, i) {
+			t.Error("Value should be found ", i)
+		}
+	}
+	db.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	buffer := make([]byte, BlockSize)
+	if _, err := file.ReadAt(buffer, 0); err != nil {
+		t.Fatal(err)
+	}
+	header, err := headerFromBuffer(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.codec != CodecFlate {
+		t.Error("Header should record the flate codec", header.codec)
+	}
+}
+
+func TestOpenLegacyFile(t *testing.T) {
+	path := clearNamedDB("legacy.db")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := newDiskNodeService(NewBlockService(file)).getRootNodeFromDisk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := &btree{root: root}
+	if err := tree.insert(NewPair("hola", "amigos")); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	db, err := Open(path, WithCompression(CodecFlate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, found, err := db.Get("hola")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || value != "amigos" {
+		t.Error("Should read files written without a header", value)
+	}
+}
+
+func TestParseCodec(t *testing.T) {
+	codec, err := ParseCodec("flate")
+	if err != nil || codec != CodecFlate {
+		t.Error("Should parse flate", codec, err)
+	}
+	if _, err := ParseCodec("zip"); err == nil {
+		t.Error("Should reject unknown codecs")
+	}
+}
@@ -0,0 +1,362 @@
+package helper
+
+import (
+	"fmt"
+	"strconv"
+)
+
+/**
+ORDER STATISTICS
+	Every page records the number of pairs in its subtree after its children ids, a full
+	page has no room left for a count per child. The counts of the children of a node are
+	read from the children themselves, which are usually in the cache.
+		1. Rank of a key: in every node on the path to the key add the elements before it
+		   and the counts of the children on their left, then descend into the next child.
+		   A key found in an internal node also has its whole left child before it.
+		2. Select the n-th pair: skip children and elements while n is past them, descend
+		   into the child n falls in or return the element n lands on.
+		3. The pairs in [start, end) are Rank(end) - Rank(start).
+	Insertion and deletion adjust the count of every node on their path, splits, rotations
+	and merges recompute the counts of the nodes they rebuild. Files written before the
+	counts existed have them rebuilt by a post order walk the first time they are opened
+	for writing, until then a read-only open or a legacy file without a header answers
+	from a scan.
+*/
+
+// childCount - Pairs in the subtree rooted at the block
+func (bs *BlockService) childCount(blockID uint64) (uint64, error) {
+	block, err := bs.GetBlockFromDiskByBlockNumber(int64(blockID))
+	if err != nil {
+		return 0, err
+	}
+	return block.Count, nil
+}
+
+// subtreeCount - Pairs in a subtree made of the elements and the children
+func (bs *BlockService) subtreeCount(elements []*Pairs, children []uint64) (uint64, error) {
+	count := uint64(len(elements))
+	for _, childID := range children {
+		childCount, err := bs.childCount(childID)
+		if err != nil {
+			return 0, err
+		}
+		count += childCount
+	}
+	return count, nil
+}
+
+func sumCounts(counts []uint64) uint64 {
+	var sum uint64
+	for _, count := range counts {
+		sum += count
+	}
+	return sum
+}
+
+// rebuildCounts - Writes the subtree count into every page of the main tree, the catalog
+// and the buckets, then records in the header that the counts can be trusted
+func (bs *BlockService) rebuildCounts() error {
+	latestBlockID, err := bs.GetLatestBlockID()
+	if err != nil {
+		return err
+	}
+	visited := make(map[uint64]bool)
+	// recount - Counts the subtree of the block, refusing to follow a block twice or past the
+	// end of the file so a corrupt file can't send the walk around a cycle
+	var recount func(blockID uint64) (uint64, error)
+	recount = func(blockID uint64) (uint64, error) {
+		if visited[blockID] || int64(blockID) > latestBlockID {
+			return 0, fmt.Errorf("block %d is referenced more than once or past the end of the file", blockID)
+		}
+		visited[blockID] = true
+		block, err := bs.readBlock(int64(blockID))
+		if err != nil {
+			return 0, fmt.Errorf("reading block %d: %w", blockID, err)
+		}
+		count := uint64(len(block.DataSet))
+		for _, childID := range block.ChildrenBlocksIds {
+			childCount, err := recount(childID)
+			if err != nil {
+				return 0, err
+			}
+			count += childCount
+		}
+		block.Count = count
+		return count, bs.WriteBlockToDisk(block)
+	}
+
+	if latestBlockID >= 0 {
+		if _, err := recount(0); err != nil {
+			return err
+		}
+	}
+	if catalogRoot := bs.catalogRoot(); catalogRoot != 0 {
+		var entries []*Pairs
+		var collect func(blockID uint64) error
+		collect = func(blockID uint64) error {
+			block, err := bs.readBlock(int64(blockID))
+			if err != nil {
+				return err
+			}
+			entries = append(entries, block.DataSet...)
+			for _, childID := range block.ChildrenBlocksIds {
+				if err := collect(childID); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if _, err := recount(catalogRoot); err != nil {
+			return err
+		}
+		if err := collect(catalogRoot); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			rootID, err := strconv.ParseUint(entry.Value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("bucket %q has no valid root block (%q)", entry.Key, entry.Value)
+			}
+			if _, err := recount(rootID); err != nil {
+				return err
+			}
+		}
+	}
+	// The pages must be on disk before the header vouches for them
+	if err := bs.file.Sync(); err != nil {
+		return err
+	}
+	bs.header.flags |= headerCounted
+	if err := bs.writeHeader(); err != nil {
+		return err
+	}
+	return bs.file.Sync()
+}
+
+// rank - Number of pairs of the subtree with a key before the given one
+func (n *DiskNode) rank(key string) (int64, error) {
+	var rank uint64
+	for {
+		i := n.childIndexForKey(key)
+		_, found := n.indexOfKey(key)
+		if found {
+			// childIndexForKey steps past an element equal to the key
+			i--
+		}
+		rank += uint64(i)
+		if n.isLeaf() {
+			return int64(rank), nil
+		}
+		before, err := n.blockService.subtreeCount(nil, n.childrenBlockIDs[:i])
+		if err != nil {
+			return 0, err
+		}
+		rank += before
+		if found {
+			count, err := n.blockService.childCount(n.childrenBlockIDs[i])
+			return int64(rank + count), err
+		}
+		if n, err = n.getChildAtIndex(i); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// selectPair - The pair at the 0 based position in the subtree, nil when out of range
+func (n *DiskNode) selectPair(position int64) (*Pairs, error) {
+	if position < 0 || uint64(position) >= n.count {
+		return nil, nil
+	}
+	index := uint64(position)
+	for {
+		if n.isLeaf() {
+			return n.keys[index], nil
+		}
+		next := -1
+		for i, childID := range n.childrenBlockIDs {
+			count, err := n.blockService.childCount(childID)
+			if err != nil {
+				return nil, err
+			}
+			if index < count {
+				next = i
+				break
+			}
+			index -= count
+			if i == len(n.keys) {
+				break
+			}
+			if index == 0 {
+				return n.keys[i], nil
+			}
+			index--
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("block %d counts more pairs than its subtree holds", n.blockID)
+		}
+		child, err := n.getChildAtIndex(next)
+		if err != nil {
+			return nil, err
+		}
+		n = child
+	}
+}
+
+func (n *DiskNode) size() int64 {
+	return int64(n.count)
+}
+
+func (n *MemoryNode) rank(key string) (int64, error) {
+	rank := 0
+	for {
+		i, found := n.search(key)
+		rank += i
+		if n.isLeaf() {
+			return int64(rank), nil
+		}
+		for _, child := range n.children[:i] {
+			rank += child.count
+		}
+		if found {
+			return int64(rank + n.children[i].count), nil
+		}
+		n = n.children[i]
+	}
+}
+
+func (n *MemoryNode) selectPair(position int64) (*Pairs, error) {
+	if position < 0 || position >= int64(n.count) {
+		return nil, nil
+	}
+	index := int(position)
+	for !n.isLeaf() {
+		i := 0
+		for ; index >= n.children[i].count; i++ {
+			index -= n.children[i].count
+			if index == 0 {
+				return n.keys[i], nil
+			}
+			index--
+		}
+		n = n.children[i]
+	}
+	return n.keys[index], nil
+}
+
+func (n *MemoryNode) size() int64 {
+	return int64(n.count)
+}
+
+// counted - Whether the nodes of the tree hold counts that can be trusted
+func (bt *btree) counted() bool {
+	return bt.inMemory() || bt.blockService.counted()
+}
+
+// size - Number of pairs in the tree
+func (bt *btree) size() (int64, error) {
+	if bt.counted() {
+		return bt.root.size(), nil
+	}
+	var size int64
+	err := bt.root.scan("", "", func(pair *Pairs) bool {
+		size++
+		return true
+	})
+	return size, err
+}
+
+// rank - Number of pairs of the tree with a key before the given one
+func (bt *btree) rank(key string) (int64, error) {
+	if bt.counted() {
+		return bt.root.rank(key)
+	}
+	if key == "" {
+		// An empty end would scan to the last key
+		return 0, nil
+	}
+	var rank int64
+	err := bt.root.scan("", key, func(pair *Pairs) bool {
+		rank++
+		return true
+	})
+	return rank, err
+}
+
+// selectPair - The pair at the 0 based position in key order, nil when out of range
+func (bt *btree) selectPair(position int64) (*Pairs, error) {
+	if bt.counted() {
+		return bt.root.selectPair(position)
+	}
+	if position < 0 {
+		return nil, nil
+	}
+	var selected *Pairs
+	err := bt.root.scan("", "", func(pair *Pairs) bool {
+		if position == 0 {
+			selected = pair
+			return false
+		}
+		position--
+		return true
+	})
+	return selected, err
+}
+
+// Count - Number of keys in [start, end), an empty end counts to the last key
+func (db *DB) Count(start string, end string) (int64, error) {
+	return db.count("", start, end)
+}
+
+func (db *DB) count(bucket string, start string, end string) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return 0, ErrClosed
+	}
+	tree, err := db.tree(bucket)
+	if err != nil {
+		return 0, err
+	}
+	var high int64
+	if end == "" {
+		high, err = tree.size()
+	} else {
+		high, err = tree.rank(end)
+	}
+	if err != nil {
+		return 0, err
+	}
+	low, err := tree.rank(start)
+	if err != nil || low > high {
+		return 0, err
+	}
+	return high - low, nil
+}
+
+// Rank - Number of keys that sort before key, whether key is stored or not
+func (db *DB) Rank(key string) (int64, error) {
+	return db.rank("", key)
+}
+
+func (db *DB) rank(bucket string, key string) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return 0, ErrClosed
+	}
+	tree, err := db.tree(bucket)
+	if err != nil {
+		return 0, err
+	}
+	return tree.rank(key)
+}
+
+// Select - The pair at position n in key order, counting from 0. found is false when n is
+// negative or not below the number of keys.
+func (db *DB) Select(n int64) (string, string, bool, error) {
+	return db.selectPair("", n)
+}
+
+func (db *DB) selectPair(bucket string, n int64) (string, string, bool, error) {
+	return db.nearest(bucket, func(tree *btree) (*Pairs, error) { return tree.selectPair(n) })
+}
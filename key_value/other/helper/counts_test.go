@@ -0,0 +1,161 @@
+package helper
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// checkOrderStatistics - Compares Rank, Select and Count of the database with the sorted keys
+func checkOrderStatistics(t *testing.T, db *DB, keys []string) {
+	t.Helper()
+	sort.Strings(keys)
+	if total, err := db.Count("", ""); err != nil || total != int64(len(keys)) {
+		t.Fatal("Count should cover every key", total, len(keys), err)
+	}
+	for i := 0; i < len(keys); i += 37 {
+		rank, err := db.Rank(keys[i])
+		if err != nil || rank != int64(i) {
+			t.Fatal("Rank of a stored key is its position", keys[i], rank, i, err)
+		}
+		if rank, _ := db.Rank(keys[i] + "~"); rank != int64(i+1) {
+			t.Fatal("Rank of a missing key counts the keys before it", keys[i], rank)
+		}
+		key, _, found, err := db.Select(int64(i))
+		if err != nil || !found || key != keys[i] {
+			t.Fatal("Select should return the key at the position", i, key, keys[i], err)
+		}
+		if j := i + 250; j < len(keys) {
+			if count, _ := db.Count(keys[i], keys[j]); count != int64(j-i) {
+				t.Fatal("Count of a range", keys[i], keys[j], count)
+			}
+		}
+	}
+	if _, _, found, _ := db.Select(int64(len(keys))); found {
+		t.Error("Select past the last key should find nothing")
+	}
+	if _, _, found, _ := db.Select(-1); found {
+		t.Error("Select of a negative position should find nothing")
+	}
+}
+
+func TestOrderStatistics(t *testing.T) {
+	path := clearNamedDB("counts.db")
+	for _, db := range []*DB{OpenMemory(), nil} {
+		if db == nil {
+			var err error
+			if db, err = Open(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		random := rand.New(rand.NewSource(11))
+		stored := make(map[string]bool)
+		for _, i := range random.Perm(3000) {
+			key := fmt.Sprintf("key-%05d", i)
+			if err := db.Put(key, "value"); err != nil {
+				t.Fatal(err)
+			}
+			stored[key] = true
+		}
+		// Replacing pairs must leave the counts alone
+		for i := 0; i < 3000; i += 7 {
+			db.Put(fmt.Sprintf("key-%05d", i), "replaced")
+		}
+		for n, i := range random.Perm(3000) {
+			if n%3 == 0 {
+				key := fmt.Sprintf("key-%05d", i)
+				if _, err := db.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+				delete(stored, key)
+			}
+		}
+		var keys []string
+		for key := range stored {
+			keys = append(keys, key)
+		}
+		checkOrderStatistics(t, db, keys)
+		if db.storage.inMemory() {
+			db.Close()
+			continue
+		}
+		report, err := db.Check()
+		if err != nil || !report.OK {
+			t.Fatal("Counts of every page should add up", report, err)
+		}
+		db.Close()
+
+		reopened, err := Open(path, WithReadOnly())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkOrderStatistics(t, reopened, keys)
+		reopened.Close()
+	}
+}
+
+func TestCountsRebuiltForOldFiles(t *testing.T) {
+	path := clearNamedDB("uncounted.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for i := 0; i < 2000; i++ {
+		keys = append(keys, fmt.Sprintf("key-%05d", i))
+		db.Put(keys[i], "value")
+	}
+	if err := db.CreateBucket("things"); err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := db.Bucket("things")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		bucket.Put(fmt.Sprintf("thing-%03d", i), "value")
+	}
+	// Make the file look like one written before pages counted their subtree
+	bs := db.storage.blockService
+	latestBlockID, _ := bs.GetLatestBlockID()
+	for id := int64(0); id <= latestBlockID; id++ {
+		block, err := bs.readBlock(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Count = 0
+		bs.WriteBlockToDisk(block)
+	}
+	bs.header.flags &^= headerCounted
+	bs.writeHeader()
+	db.Close()
+
+	readOnly, err := Open(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without trusted counts the answers come from a scan
+	checkOrderStatistics(t, readOnly, keys)
+	readOnly.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.storage.blockService.counted() {
+		t.Fatal("Opening for writing should rebuild the counts")
+	}
+	checkOrderStatistics(t, db, keys)
+	if bucket, err = db.Bucket("things"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := bucket.Count("", ""); err != nil || count != 500 {
+		t.Error("Bucket counts should be rebuilt too", count, err)
+	}
+	report, err := db.Check()
+	if err != nil || !report.OK {
+		t.Error("Rebuilt counts should pass the check", report, err)
+	}
+}
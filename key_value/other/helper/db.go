@@ -1,29 +1,232 @@
 package helper
 
-//DB - Handle exported by the package
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+var (
+	ErrClosed   = errors.New("database is closed")
+	ErrInMemory = errors.New("not available for an in-memory database")
+	// ErrEmptyValue - A pair with an empty value reads as missing, it can't be stored
+	ErrEmptyValue = errors.New("value must not be empty")
+)
+
+//DB - Handle exported by the package. It is safe for concurrent use, writes are
+//serialized while reads run in parallel.
 type DB struct {
+	mu      sync.RWMutex
 	storage *btree
+	// indexes - Secondary indexes of the main tree by name, see CreateIndex
+	indexes map[string]*index
+	// history - Earlier values of the keys of the main tree, nil unless it is versioned
+	history *history
+	closed  bool
 }
 
-//Open - Opens a new db connection at the file path
-func Open(filePath string) (*DB, error) {
-	storage, err := initializeBtree(filePath)
+//Open - Opens a new db connection at the file path. The handle holds the file and its
+//lock until Close is called.
+func Open(filePath string, opts ...Option) (*DB, error) {
+	o := buildOptions(opts)
+	storage, err := openBtree(filePath, o)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{storage}, nil
+	history, err := openHistory(filePath, o, storage.blockService.format)
+	if err != nil {
+		storage.close()
+		return nil, err
+	}
+	return &DB{storage: storage, history: history}, nil
+}
+
+//OpenMemory - Opens an empty database kept in memory only. Its content is lost on Close
+//unless it was saved with Snapshot first.
+func OpenMemory() *DB {
+	return &DB{storage: newMemoryBtree()}
 }
 
-//Put - Insert a key value pair in the database
+//Put - Insert a key value pair in the database. It returns once the write is as durable
+//as the sync mode of the database promises.
 func (db *DB) Put(key string, value string) error {
+	return db.put("", key, value)
+}
+
+//Delete - Remove the key from the database, reporting whether it was stored
+func (db *DB) Delete(key string) (bool, error) {
+	return db.delete("", key)
+}
+
+// tree - The main tree for an empty bucket name, else the tree of the bucket. Must be
+// called with mu held.
+func (db *DB) tree(bucket string) (*btree, error) {
+	if bucket == "" {
+		return db.storage, nil
+	}
+	return db.storage.bucket(bucket)
+}
+
+// update - Runs fn under the write lock, then waits until its writes are durable
+func (db *DB) update(fn func() error) error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	if db.storage.readOnly() {
+		db.mu.Unlock()
+		return ErrReadOnly
+	}
+	err := fn()
+	if err == nil {
+		err = db.storage.growFilter()
+	}
+	history := db.history
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// Wait for durability outside the lock so concurrent writers share a group commit
+	err = db.storage.commit()
+	if err == nil && history != nil {
+		err = history.commit()
+	}
+	if errors.Is(err, os.ErrClosed) {
+		return ErrClosed
+	}
+	return err
+}
+
+func (db *DB) put(bucket string, key string, value string) error {
 	pair := NewPair(key, value)
-	if err := pair.Validate(); err != nil {
+	if err := db.validate(pair); err != nil {
 		return err
 	}
-	return db.storage.insert(pair)
+	return db.update(func() error {
+		tree, err := db.tree(bucket)
+		if err != nil {
+			return err
+		}
+		if tree == db.storage {
+			if err := db.checkIndexKeys(key, value); err != nil {
+				return err
+			}
+		}
+		return db.insertPair(tree, pair)
+	})
+}
+
+func (db *DB) delete(bucket string, key string) (bool, error) {
+	var found bool
+	err := db.update(func() error {
+		tree, err := db.tree(bucket)
+		if err != nil {
+			return err
+		}
+		found, err = db.deletePair(tree, key)
+		return err
+	})
+	return found, err
+}
+
+//Write - Apply the puts and deletes of the batch in order. Readers never see part of a
+//batch and the whole batch shares one sync, but a crash halfway through can leave the
+//first operations of the batch applied.
+func (db *DB) Write(batch *Batch) error {
+	if err := batch.validate(db.validate); err != nil {
+		return err
+	}
+	return db.update(func() error {
+		for _, op := range batch.ops {
+			if op.delete {
+				continue
+			}
+			if err := db.checkIndexKeys(op.pair.Key, op.pair.Value); err != nil {
+				return err
+			}
+		}
+		for _, op := range batch.ops {
+			var err error
+			if op.delete {
+				_, err = db.deletePair(db.storage, op.pair.Key)
+			} else {
+				err = db.insertPair(db.storage, op.pair)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 //Get - Get the stored value from the database for the respective key
 func (db *DB) Get(key string) (string, bool, error) {
-	return db.storage.get(key)
+	return db.get("", key)
+}
+
+func (db *DB) get(bucket string, key string) (string, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return "", false, ErrClosed
+	}
+	tree, err := db.tree(bucket)
+	if err != nil {
+		return "", false, err
+	}
+	return tree.get(key)
+}
+
+//Scan - Call fn with the pairs whose key is in [start, end) in key order until fn returns
+//false. An empty end scans to the last key. The database is read locked while the scan
+//runs, fn must not write to it.
+func (db *DB) Scan(start string, end string, fn func(key string, value string) bool) error {
+	return db.scan("", start, end, fn)
+}
+
+func (db *DB) scan(bucket string, start string, end string, fn func(key string, value string) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrClosed
+	}
+	tree, err := db.tree(bucket)
+	if err != nil {
+		return err
+	}
+	return tree.scan(start, end, func(pair *Pairs) bool {
+		return fn(pair.Key, pair.Value)
+	})
+}
+
+//Close - Flush pending writes and release the database file. Pages are written through
+//to the file, so flushing syncs whatever the sync mode left pending, then the mapping,
+//the file lock and the file itself are released. Every later call returns ErrClosed.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+	db.indexes = nil
+	if db.history != nil {
+		if err := db.history.close(); err != nil {
+			db.storage.close()
+			return err
+		}
+	}
+	return db.storage.close()
+}
+
+//Stats - Walk the tree and report its shape, page usage and cache efficiency
+func (db *DB) Stats() (Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return Stats{}, ErrClosed
+	}
+	return db.storage.stats()
 }
@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestShouldRejectCallsAfterClose(t *testing.T) {
+	db, err := Open(clearNamedDB("lifecycle.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("hola", "amigos"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Put("foo", "bar"); !errors.Is(err, ErrClosed) {
+		t.Error("Put after close should fail", err)
+	}
+	if _, _, err := db.Get("hola"); !errors.Is(err, ErrClosed) {
+		t.Error("Get after close should fail", err)
+	}
+	if err := db.Close(); !errors.Is(err, ErrClosed) {
+		t.Error("Second close should fail", err)
+	}
+}
+
+func TestShouldFlushPendingWritesOnClose(t *testing.T) {
+	path := clearNamedDB("lifecycle.db")
+	db, err := Open(path, WithSync(SyncNone, 0), WithMmap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("hola", "amigos"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(path, WithReadOnly(), WithLockTimeout(0))
+	if err != nil {
+		t.Fatal("Close should release the lock", err)
+	}
+	defer db.Close()
+	value, found, err := db.Get("hola")
+	if err != nil || !found || value != "amigos" {
+		t.Error("Value should survive close", value, err)
+	}
+}
+
+func TestOpenMustExist(t *testing.T) {
+	path := clearNamedDB("lifecycle.db")
+	if _, err := Open(path, WithMustExist()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Should not create a missing file", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("File should not have been created")
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = Open(path, WithMustExist())
+	if err != nil {
+		t.Error("Should open an existing file", err)
+	}
+	db.Close()
+}
@@ -0,0 +1,248 @@
+package helper
+
+/**
+DELETION ALGORITHM
+	Every node but the root keeps at least minKeys elements, the result of splitting an
+	overflown node. Deletion walks down to the node holding the key:
+		1. In a leaf the element is simply removed
+		2. In an internal node the element is replaced by its predecessor, the largest element
+		   of the child on its left, which is removed from that subtree instead
+	On the way back up every child that dropped below minKeys is rebalanced by its parent:
+		1. Borrow through the parent from the left sibling if it can spare an element
+		2. Otherwise borrow through the parent from the right sibling
+		3. Otherwise merge the child, the separator and a sibling into one node, the parent
+		   loses the separator and the block of the merged away node is dropped
+	When the root loses its last element it only has a single child left, the child is
+	copied into the root block, its own block is dropped and the tree gets one level
+	shorter. Dropped blocks go to the free list once the delete is done.
+	With prefix compressed pages an internal node can overflow instead, when a separator
+	is replaced by a longer pair. It is left unwritten and split by its parent like on
+	insert, the root is split in place.
+	Every node on the path counts one pair less, a rotation moves the separator and the
+	subtree of the child that changes sides, see counts.go.
+*/
+
+// minKeys - Fewest elements a node other than the root may hold
+func (bs *BlockService) minKeys() int {
+	if bs.prefixed() {
+		return prefixedMinKeys
+	}
+	return bs.GetMaxLeafSize() / 2
+}
+
+func (n *DiskNode) hasUnderflown() bool {
+	return len(n.getElements()) < n.blockService.minKeys()
+}
+
+func (n *DiskNode) removeElementAtIndex(index int) *Pairs {
+	element := n.keys[index]
+	n.keys = append(n.keys[:index], n.keys[index+1:]...)
+	return element
+}
+
+func (n *DiskNode) removeChildAtIndex(index int) uint64 {
+	childID := n.childrenBlockIDs[index]
+	n.childrenBlockIDs = append(n.childrenBlockIDs[:index], n.childrenBlockIDs[index+1:]...)
+	return childID
+}
+
+// childIndexForKey - Index of the child whose subtree may hold the key
+func (n *DiskNode) childIndexForKey(key string) int {
+	for i := 0; i < len(n.getElements()); i++ {
+		if key < n.getElementAtIndex(i).Key {
+			return i
+		}
+	}
+	return len(n.getElements())
+}
+
+// deletePair - Removes the key from the subtree, reporting whether it was there
+func (n *DiskNode) deletePair(key string, bt *btree) (bool, error) {
+	found, err := n.delete(key)
+	if err != nil || !found {
+		return found, err
+	}
+	if bt.isRootNode(n) && n.hasOverFlown() {
+		_, _, _, err := n.splitOverflown(bt)
+		return true, err
+	}
+	if !bt.isRootNode(n) || n.isLeaf() || len(n.getElements()) > 0 {
+		return true, nil
+	}
+	// The root has a single child left, pull it up into block 0
+	child, err := n.getChildAtIndex(0)
+	if err != nil {
+		return true, err
+	}
+	n.setElements(child.getElements())
+	n.childrenBlockIDs = child.childrenBlockIDs
+	n.count = child.count
+	n.blockService.drop(child.blockID)
+	return true, n.blockService.UpdateNodeToDisk(n)
+}
+
+func (n *DiskNode) delete(key string) (bool, error) {
+	index, found := n.indexOfKey(key)
+	if found && n.isLeaf() {
+		n.removeElementAtIndex(index)
+		n.count--
+		return true, n.blockService.UpdateNodeToDisk(n)
+	}
+	if n.isLeaf() {
+		return false, nil
+	}
+
+	childIndex := index
+	if !found {
+		childIndex = n.childIndexForKey(key)
+	}
+	child, err := n.getChildAtIndex(childIndex)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		predecessor, err := child.removeMax()
+		if err != nil {
+			return false, err
+		}
+		n.keys[index] = predecessor
+	} else {
+		found, err = child.delete(key)
+		if err != nil || !found {
+			return found, err
+		}
+	}
+	n.count--
+	if err := n.fixChild(childIndex, child); err != nil {
+		return false, err
+	}
+	return true, n.saveUnlessOverflown()
+}
+
+// removeMax - Removes and returns the largest element of the subtree
+func (n *DiskNode) removeMax() (*Pairs, error) {
+	if n.isLeaf() {
+		element := n.removeElementAtIndex(len(n.getElements()) - 1)
+		n.count--
+		return element, n.blockService.UpdateNodeToDisk(n)
+	}
+	childIndex := len(n.childrenBlockIDs) - 1
+	child, err := n.getChildAtIndex(childIndex)
+	if err != nil {
+		return nil, err
+	}
+	element, err := child.removeMax()
+	if err != nil {
+		return nil, err
+	}
+	n.count--
+	if err := n.fixChild(childIndex, child); err != nil {
+		return nil, err
+	}
+	return element, n.saveUnlessOverflown()
+}
+
+// fixChild - Rebalances the child at index when it has underflown, or splits it when it
+// has overflown
+func (n *DiskNode) fixChild(index int, child *DiskNode) error {
+	if child.hasUnderflown() {
+		return n.rebalanceChild(index, child)
+	}
+	if !child.hasOverFlown() {
+		return nil
+	}
+	middle, leftNode, rightNode, err := child.split(false)
+	if err != nil {
+		return err
+	}
+	n.blockService.drop(child.blockID)
+	n.addPoppedUpElementIntoCurrentNodeAndUpdateWithNewChildren(middle, leftNode, rightNode)
+	return nil
+}
+
+// saveUnlessOverflown - Writes the node unless it has overflown, its parent splits it then
+func (n *DiskNode) saveUnlessOverflown() error {
+	if n.hasOverFlown() {
+		return nil
+	}
+	return n.blockService.UpdateNodeToDisk(n)
+}
+
+// rebalanceChild - Brings the child at index back to minKeys elements. The children are
+// written to disk, the caller writes the current node.
+func (n *DiskNode) rebalanceChild(index int, child *DiskNode) error {
+	bs := n.blockService
+	var left, right *DiskNode
+	var err error
+	if index > 0 {
+		if left, err = n.getChildAtIndex(index - 1); err != nil {
+			return err
+		}
+		if len(left.getElements()) > bs.minKeys() {
+			// Rotate right: the separator moves down into the child, the last element of
+			// the left sibling takes its place
+			child.keys = append([]*Pairs{n.keys[index-1]}, child.keys...)
+			n.keys[index-1] = left.removeElementAtIndex(len(left.keys) - 1)
+			moved := uint64(1)
+			if !left.isLeaf() {
+				childID := left.removeChildAtIndex(len(left.childrenBlockIDs) - 1)
+				child.childrenBlockIDs = append([]uint64{childID}, child.childrenBlockIDs...)
+				movedChild, err := bs.childCount(childID)
+				if err != nil {
+					return err
+				}
+				moved += movedChild
+			}
+			left.count -= moved
+			child.count += moved
+			if err := bs.UpdateNodeToDisk(left); err != nil {
+				return err
+			}
+			return bs.UpdateNodeToDisk(child)
+		}
+	}
+	if index < len(n.childrenBlockIDs)-1 {
+		if right, err = n.getChildAtIndex(index + 1); err != nil {
+			return err
+		}
+		if len(right.getElements()) > bs.minKeys() {
+			// Rotate left, the mirror image of the above
+			child.keys = append(child.keys, n.keys[index])
+			n.keys[index] = right.removeElementAtIndex(0)
+			moved := uint64(1)
+			if !right.isLeaf() {
+				childID := right.removeChildAtIndex(0)
+				child.childrenBlockIDs = append(child.childrenBlockIDs, childID)
+				movedChild, err := bs.childCount(childID)
+				if err != nil {
+					return err
+				}
+				moved += movedChild
+			}
+			right.count -= moved
+			child.count += moved
+			if err := bs.UpdateNodeToDisk(right); err != nil {
+				return err
+			}
+			return bs.UpdateNodeToDisk(child)
+		}
+	}
+
+	// Neither sibling can spare an element, merge with one of them
+	if left != nil {
+		return n.mergeChildren(index-1, left, child)
+	}
+	return n.mergeChildren(index, child, right)
+}
+
+// mergeChildren - Merges the child at index, the separator after it and the next child
+// into the first one
+func (n *DiskNode) mergeChildren(index int, left *DiskNode, right *DiskNode) error {
+	separator := n.removeElementAtIndex(index)
+	n.removeChildAtIndex(index + 1)
+	left.keys = append(append(left.keys, separator), right.keys...)
+	left.childrenBlockIDs = append(left.childrenBlockIDs, right.childrenBlockIDs...)
+	left.count += 1 + right.count
+	n.blockService.drop(right.blockID)
+	return n.blockService.UpdateNodeToDisk(left)
+}
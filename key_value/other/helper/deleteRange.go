@@ -0,0 +1,177 @@
+package helper
+
+/**
+RANGE DELETION
+	The pairs in [start, end) are counted first from the subtree counts, then removed one
+	of two ways, whichever writes fewer pages:
+		1. Key by key, every delete rewrites the pages on its path, about removed * height
+		2. By rebuilding the tree from the pairs outside the range, about kept / bulkLoadFill
+		   pages. The new tree is bulk loaded into fresh pages while the old one stays
+		   intact, the root block is rewritten last, then every page of the old tree below
+		   the root goes to the free list. Only internal pages are read to find them, whole
+		   subtrees inside the range are dropped without reading their leaves.
+	Trees kept in memory always go key by key.
+*/
+
+// deleteRange - Removes the pairs in [start, end) from the tree, an empty end removes to
+// the last key. Returns the number of pairs removed and, when asked to report them or when
+// they went key by key, the pairs removed. A failed key by key removal reports the pairs
+// removed before it failed.
+func (bt *btree) deleteRange(start string, end string, report bool) (int64, []*Pairs, error) {
+	low, err := bt.rank(start)
+	if err != nil {
+		return 0, nil, err
+	}
+	var high, total int64
+	if total, err = bt.size(); err != nil {
+		return 0, nil, err
+	}
+	high = total
+	if end != "" {
+		if high, err = bt.rank(end); err != nil {
+			return 0, nil, err
+		}
+	}
+	removed := high - low
+	if removed <= 0 {
+		return 0, nil, nil
+	}
+
+	rebuild := false
+	if !bt.inMemory() {
+		height, err := bt.height()
+		if err != nil {
+			return 0, nil, err
+		}
+		rebuild = removed*int64(height) >= (total-removed)/int64(bt.blockService.bulkLoadFill())
+	}
+	var pairs []*Pairs
+	if report || !rebuild {
+		err = bt.scan(start, end, func(pair *Pairs) bool {
+			pairs = append(pairs, pair)
+			return true
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	if rebuild {
+		rebuilt, err := bt.rebuildWithout(start, end)
+		if !rebuilt {
+			return 0, nil, err
+		}
+		return removed, pairs, err
+	}
+	for i, pair := range pairs {
+		if _, err := bt.delete(pair.Key); err != nil {
+			return int64(i), pairs[:i], err
+		}
+	}
+	return removed, pairs, nil
+}
+
+// height - Number of levels of a tree backed by a file, found down its first children
+func (bt *btree) height() (int, error) {
+	bs := bt.blockService
+	height := 1
+	for n := bt.root.(*DiskNode); !n.isLeaf(); height++ {
+		block, err := bs.GetBlockFromDiskByBlockNumber(int64(n.childrenBlockIDs[0]))
+		if err != nil {
+			return 0, err
+		}
+		n = bs.ConvertBlockToDiskNode(block)
+	}
+	return height, nil
+}
+
+// pageIDs - Blocks of the tree below its root, the leaves are listed by their parents
+// without being read
+func (bt *btree) pageIDs() ([]uint64, error) {
+	height, err := bt.height()
+	if err != nil {
+		return nil, err
+	}
+	var blockIDs []uint64
+	level := []uint64{bt.rootID}
+	for depth := 1; depth < height; depth++ {
+		var next []uint64
+		for _, blockID := range level {
+			block, err := bt.blockService.readBlock(int64(blockID))
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, block.ChildrenBlocksIds...)
+		}
+		blockIDs = append(blockIDs, next...)
+		level = next
+	}
+	return blockIDs, nil
+}
+
+// rebuildWithout - Bulk loads the tree again with only the pairs outside [start, end),
+// rebuilt tells whether the pairs are gone when an error is returned
+func (bt *btree) rebuildWithout(start string, end string) (rebuilt bool, err error) {
+	var kept []*Pairs
+	keep := func(pair *Pairs) bool {
+		kept = append(kept, pair)
+		return true
+	}
+	// Pairs are kept as they are stored, values in the log stay there
+	if err := bt.root.scan("", start, keep); err != nil {
+		return false, err
+	}
+	if end != "" {
+		if err := bt.root.scan(end, "", keep); err != nil {
+			return false, err
+		}
+	}
+	oldPages, err := bt.pageIDs()
+	if err != nil {
+		return false, err
+	}
+
+	// The old root stays on disk until bulkLoad writes the new one over it
+	oldRoot := bt.root
+	bt.setRootNode(&DiskNode{blockID: bt.rootID, blockService: bt.blockService})
+	if err := bt.bulkLoad(kept); err != nil {
+		bt.setRootNode(oldRoot)
+		return false, err
+	}
+	return true, bt.blockService.freeBlocks(oldPages)
+}
+
+// DeleteRange - Removes the keys in [start, end), an empty end removes every key from
+// start on. Returns the number of keys removed.
+func (db *DB) DeleteRange(start string, end string) (int64, error) {
+	return db.deleteRange("", start, end)
+}
+
+func (db *DB) deleteRange(bucket string, start string, end string) (int64, error) {
+	var removed int64
+	err := db.update(func() error {
+		tree, err := db.tree(bucket)
+		if err != nil {
+			return err
+		}
+		// The indexes and the history need the pairs, the tree reports the ones it removed
+		var pairs []*Pairs
+		removed, pairs, err = tree.deleteRange(start, end, db.tracked(tree))
+		if db.tracked(tree) {
+			// Logged once the tree no longer holds them, also those removed before a failure
+			for _, pair := range pairs {
+				for _, idx := range db.indexes {
+					if indexErr := idx.remove(pair.Key, pair.Value); indexErr != nil && err == nil {
+						err = indexErr
+					}
+				}
+				if db.history != nil {
+					if historyErr := db.history.write(pair.Key, pair.Value, true, "", true); historyErr != nil && err == nil {
+						err = historyErr
+					}
+				}
+			}
+		}
+		return err
+	})
+	return removed, err
+}
@@ -0,0 +1,107 @@
+package helper
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDeleteRange(t *testing.T) {
+	path := clearNamedDB("deleterange.db")
+	for _, db := range []*DB{OpenMemory(), nil} {
+		if db == nil {
+			var err error
+			if db, err = Open(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 3000; i++ {
+			if err := db.Put(fmt.Sprintf("customer-%04d", i), "value"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// A narrow range goes key by key, a wide one rebuilds the tree
+		if removed, err := db.DeleteRange("customer-0100", "customer-0110"); err != nil || removed != 10 {
+			t.Fatal("Narrow range should remove its keys", removed, err)
+		}
+		if removed, err := db.DeleteRange("customer-0500", ""); err != nil || removed != 2500 {
+			t.Fatal("Open ended range should remove to the last key", removed, err)
+		}
+		if removed, _ := db.DeleteRange("customer-0200", "customer-0100"); removed != 0 {
+			t.Error("An empty range removes nothing", removed)
+		}
+		if count, _ := db.Count("", ""); count != 490 {
+			t.Error("Keys outside the ranges should remain", count)
+		}
+		for _, key := range []string{"customer-0099", "customer-0110", "customer-0499"} {
+			if _, found, _ := db.Get(key); !found {
+				t.Error("Key outside the ranges should remain", key)
+			}
+		}
+		for _, key := range []string{"customer-0100", "customer-0109", "customer-0500", "customer-2999"} {
+			if _, found, _ := db.Get(key); found {
+				t.Error("Key inside a range should be gone", key)
+			}
+		}
+		if db.storage.inMemory() {
+			db.Close()
+			continue
+		}
+
+		report, err := db.Check()
+		if err != nil || !report.OK || report.FreeBlocks == 0 {
+			t.Fatal("Rebuilt tree should be healthy with its old pages on the free list", report, err)
+		}
+		// New pages come off the free list before the file grows
+		for i := 0; i < 500; i++ {
+			db.Put(fmt.Sprintf("tenant-%04d", i), "value")
+		}
+		after, err := db.Check()
+		if err != nil || !after.OK || after.TotalBlocks != report.TotalBlocks || after.FreeBlocks >= report.FreeBlocks {
+			t.Error("Inserts should reuse free pages", report.TotalBlocks, after, err)
+		}
+		db.Close()
+		reopened, err := Check(path)
+		if err != nil || reopened.FreeBlocks != after.FreeBlocks {
+			t.Error("Free list should be kept in the header", reopened, err)
+		}
+	}
+}
+
+func TestDeleteRangeIndexesAndBuckets(t *testing.T) {
+	db, err := Open(clearNamedDB("deleterange_index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.CreateIndex("plan", func(key string, value string) (string, bool) { return value, true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateBucket("archive"); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := db.Bucket("archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("plan-%d", i%2))
+		archive.Put(fmt.Sprintf("key-%04d", i), "value")
+	}
+	if _, err := db.DeleteRange("key-0000", "key-0900"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := db.LookupIndex("plan", "plan-0")
+	if err != nil || len(keys) != 50 {
+		t.Error("Index should only list the remaining keys", len(keys), err)
+	}
+	if removed, err := archive.DeleteRange("key-0990", ""); err != nil || removed != 10 {
+		t.Error("Bucket range should be removed", removed, err)
+	}
+	if count, _ := archive.Count("", ""); count != 990 {
+		t.Error("Bucket should keep the other keys", count)
+	}
+	if report, err := db.Check(); err != nil || !report.OK {
+		t.Error("Tree should stay healthy", report, err)
+	}
+}
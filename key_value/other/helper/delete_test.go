@@ -0,0 +1,185 @@
+package helper
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestPutReplacesExistingKey(t *testing.T) {
+	db, err := Open(clearNamedDB("delete.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		db.Put(fmt.Sprintf("key-%03d", i), "old")
+	}
+	for i := 0; i < 100; i++ {
+		db.Put(fmt.Sprintf("key-%03d", i), "new")
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 100 {
+		t.Error("Put should replace the stored pair", stats.Keys)
+	}
+	if value, _, _ := db.Get("key-042"); value != "new" {
+		t.Error("Get should return the latest value", value)
+	}
+}
+
+func TestDeleteKeepsTreeBalanced(t *testing.T) {
+	db, err := Open(clearNamedDB("delete.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	random := rand.New(rand.NewSource(1))
+	total := 2000
+	for _, i := range random.Perm(total) {
+		if err := db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted := make(map[int]bool)
+	for n, i := range random.Perm(total) {
+		if n%3 == 0 {
+			continue
+		}
+		found, err := db.Delete(fmt.Sprintf("key-%04d", i))
+		if err != nil || !found {
+			t.Fatal("Delete should find the key", i, err)
+		}
+		deleted[i] = true
+	}
+	if found, err := db.Delete("missing"); err != nil || found {
+		t.Error("Deleting a missing key should report it", err)
+	}
+
+	report, err := db.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || report.Keys != int64(total-len(deleted)) {
+		t.Fatal("Tree should stay healthy", report.Keys, report.Problems)
+	}
+	for i := 0; i < total; i++ {
+		_, found, err := db.Get(fmt.Sprintf("key-%04d", i))
+		if err != nil || found == deleted[i] {
+			t.Error("Unexpected lookup", i, found, err)
+		}
+	}
+
+	for i := 0; i < total; i++ {
+		db.Delete(fmt.Sprintf("key-%04d", i))
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 0 || stats.Height != 1 {
+		t.Error("Emptied tree should shrink back to a leaf", stats)
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	db, err := Open(clearNamedDB("scan.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, i := range rand.New(rand.NewSource(2)).Perm(500) {
+		db.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%d", i))
+	}
+
+	var keys []string
+	err = db.Scan("key-100", "key-200", func(key string, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 100 || keys[0] != "key-100" || keys[99] != "key-199" {
+		t.Error("Unexpected range", len(keys), keys)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatal("Scan should return keys in order", keys)
+		}
+	}
+
+	count := 0
+	db.Scan("", "", func(key string, value string) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 {
+		t.Error("Scan should stop when asked", count)
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	db, err := Open(clearNamedDB("batch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put("gone", "soon")
+
+	batch := &Batch{}
+	batch.Put("hola", "amigos")
+	batch.Put("foo", "bar")
+	batch.Delete("gone")
+	if err := db.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	if value, found, _ := db.Get("hola"); !found || value != "amigos" {
+		t.Error("Batch put should be applied", value)
+	}
+	if _, found, _ := db.Get("gone"); found {
+		t.Error("Batch delete should be applied")
+	}
+
+	invalid := &Batch{}
+	invalid.Put("fine", "value")
+	invalid.Put("this key is far too long to be stored in a page", "value")
+	if err := db.Write(invalid); err == nil {
+		t.Error("Invalid batch should be rejected")
+	}
+	if _, found, _ := db.Get("fine"); found {
+		t.Error("Nothing of a rejected batch should be applied")
+	}
+}
+
+func TestChurnReusesDroppedBlocks(t *testing.T) {
+	db, err := Open(clearNamedDB("churn.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var totals []int64
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 2000; i++ {
+			if err := db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%040d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 2000; i++ {
+			if _, err := db.Delete(fmt.Sprintf("key-%04d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		report, err := db.Check()
+		if err != nil || !report.OK || len(report.Unreachable) != 0 {
+			t.Fatal("Dropped blocks should go to the free list", report, err)
+		}
+		totals = append(totals, report.TotalBlocks)
+	}
+	if totals[len(totals)-1] != totals[0] {
+		t.Error("The file should stop growing once the free list is in use", totals)
+	}
+}
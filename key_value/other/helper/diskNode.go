@@ -6,7 +6,9 @@ type DiskNode struct {
 	keys             []*Pairs
 	childrenBlockIDs []uint64
 	blockID          uint64
-	blockService     *BlockService
+	// count - Pairs in the subtree of the node
+	count        uint64
+	blockService *BlockService
 }
 
 func (n *DiskNode) printNode() {
@@ -18,8 +20,8 @@ func (n *DiskNode) printNode() {
 	fmt.Println("**********************")
 }
 
-// PrintTree - Traverse and print the entire tree
-func (n *DiskNode) printTree(level int) {
+// PrintTree - Traverse and print the entire tree, stopping at the first block that can't be read
+func (n *DiskNode) printTree(level int) error {
 	currentLevel := level
 	if level == 0 {
 		currentLevel = 1
@@ -30,10 +32,13 @@ func (n *DiskNode) printTree(level int) {
 		fmt.Println("Printing ", i+1, " th child of level : ", currentLevel)
 		childNode, err := n.getChildAtIndex(i)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if err := childNode.printTree(currentLevel + 1); err != nil {
+			return err
 		}
-		childNode.printTree(currentLevel + 1)
 	}
+	return nil
 }
 
 func (n *DiskNode) isLeaf() bool {
@@ -53,12 +58,44 @@ func (n *DiskNode) setElements(newElements []*Pairs) {
 }
 
 func (n *DiskNode) hasOverFlown() bool {
-	return len(n.getElements()) > n.blockService.GetMaxLeafSize()
+	return !n.blockService.nodeFits(n.getElements(), !n.isLeaf())
+}
+
+// sequentialSplitShare - Share of the elements the left node keeps when a node overflows
+// with an append
+const sequentialSplitShare = 0.9
+
+// splitIndex - Index of the middle element of a split, prefix compressed pages split
+// where the halves take about as many bytes. A node overflown by appending after every
+// key of the tree is split 90/10 instead: appends never come back to the left node, a
+// half full one would stay half full, and they go on filling the right one.
+func (n *DiskNode) splitIndex(appending bool) int {
+	if appending {
+		index := int(float64(len(n.getElements())) * sequentialSplitShare)
+		if index < len(n.getElements())-1 && n.blockService.nodeFits(n.getElements()[:index], !n.isLeaf()) {
+			return index
+		}
+	}
+	if n.blockService.prefixed() {
+		return prefixedSplitIndex(n.getElements(), !n.isLeaf())
+	}
+	return len(n.getElements()) / 2
+}
+
+func (bs *BlockService) countSplit(appending bool) {
+	bs.splits++
+	if appending {
+		bs.sequentialSplits++
+	}
 }
 
 func newNodeWithChildren(elements []*Pairs, childrenBlocksID []uint64, bs *BlockService) (*DiskNode, error) {
-	node := &DiskNode{keys: elements, childrenBlockIDs: childrenBlocksID, blockService: bs}
-	err := bs.SaveNewNodeToDisk(node)
+	count, err := bs.subtreeCount(elements, childrenBlocksID)
+	if err != nil {
+		return nil, err
+	}
+	node := &DiskNode{keys: elements, childrenBlockIDs: childrenBlocksID, count: count, blockService: bs}
+	err = bs.SaveNewNodeToDisk(node)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +104,7 @@ func newNodeWithChildren(elements []*Pairs, childrenBlocksID []uint64, bs *Block
 
 // newLeafNode - Create a new leaf node without children
 func newLeafNode(elements []*Pairs, bs *BlockService) (*DiskNode, error) {
-	node := &DiskNode{keys: elements, blockService: bs}
+	node := &DiskNode{keys: elements, count: uint64(len(elements)), blockService: bs}
 	//persist the node to disk
 	err := bs.SaveNewNodeToDisk(node)
 	if err != nil {
@@ -77,18 +114,19 @@ func newLeafNode(elements []*Pairs, bs *BlockService) (*DiskNode, error) {
 }
 
 // splitLeafNode - Split leaf node
-func (n *DiskNode) splitLeafNode() (*Pairs, *DiskNode, *DiskNode, error) {
+func (n *DiskNode) splitLeafNode(appending bool) (*Pairs, *DiskNode, *DiskNode, error) {
 	/**
 		LEAF SPLITTING WITHOUT CHILDREN ALGORITHM
 				If its full, then  make two new child nodes without the middle node ( NODE CREATION WILL TAKE PLACE HERE)
 	    		Take out the middle element along with the two child nodes,  Leaf Splitting no children Algorithm:
-	        	1. Pick middle element by using length of array/2, lets say its index i
+	        	1. Pick middle element by using length of array/2 (see splitIndex), lets say its index i
 	        	2. Club all elements from 0 to i-1, and i+1 to len(array) and create new seperate nodes by inserting these 2 arrays into the respective keys[] of respective nodes
 	        	3. Since the current node is a leaf node, we do not need to worry about its children and we can leave them to be null for both
 	        	4. return middle,leftNode,rightNode
 	*/
 	elements := n.getElements()
-	midIndex := len(elements) / 2
+	midIndex := n.splitIndex(appending)
+	n.blockService.countSplit(appending)
 	middle := elements[midIndex]
 
 	// Now lets split elements array into 2 as we are splitting this node
@@ -108,11 +146,11 @@ func (n *DiskNode) splitLeafNode() (*Pairs, *DiskNode, *DiskNode, error) {
 }
 
 //splitNonLeafNode - Split non leaf node
-func (n *DiskNode) splitNonLeafNode() (*Pairs, *DiskNode, *DiskNode, error) {
+func (n *DiskNode) splitNonLeafNode(appending bool) (*Pairs, *DiskNode, *DiskNode, error) {
 	/**
 		NON-LEAF NODE SPLITTING ALGORITHM WITH CHILDREN MANIPULATION
 		If its full, sort it and make two new child nodes, Leaf Splitting with children Algorithm:
-	        1. Pick middle element by using length of array/2, lets say its index i (Same as 3.4.1)
+	        1. Pick middle element by using length of array/2 (see splitIndex), lets say its index i (Same as 3.4.1)
 			2. Club all elements from 0 to i-1, and i+1 to len(lkeys array) and create new seperate nodes
 			   by inserting these 2 arrays into the respective keys[] of respective nodes (Same as 3.4.2)
 			3. For children[], split the current node's children array into 2 parts, part1 will be
@@ -122,7 +160,8 @@ func (n *DiskNode) splitNonLeafNode() (*Pairs, *DiskNode, *DiskNode, error) {
 		NOTE : NODE CREATION WILL TAKE PLACE HERE
 	*/
 	elements := n.getElements()
-	midIndex := len(elements) / 2
+	midIndex := n.splitIndex(appending)
+	n.blockService.countSplit(appending)
 	middle := elements[midIndex]
 
 	// Now lets split elements array into 2 as we are splitting this node
@@ -148,12 +187,17 @@ func (n *DiskNode) splitNonLeafNode() (*Pairs, *DiskNode, *DiskNode, error) {
 }
 
 func newRootNodeWithSingleElementAndTwoChildren(element *Pairs, leftChildBlockID uint64,
-	rightChildBlockID uint64, bs *BlockService) (*DiskNode, error) {
+	rightChildBlockID uint64, rootID uint64, bs *BlockService) (*DiskNode, error) {
 	elements := []*Pairs{element}
 	childremBlockIDs := []uint64{leftChildBlockID, rightChildBlockID}
-	node := &DiskNode{keys: elements, childrenBlockIDs: childremBlockIDs, blockService: bs}
+	count, err := bs.subtreeCount(elements, childremBlockIDs)
+	if err != nil {
+		return nil, err
+	}
+	// The new root takes the block of the old one, trees keep their root in place
+	node := &DiskNode{keys: elements, childrenBlockIDs: childremBlockIDs, blockID: rootID, count: count, blockService: bs}
 	// Persist the node to disk
-	err := bs.UpdateRootNode(node)
+	err = bs.UpdateNodeToDisk(node)
 	if err != nil {
 		return nil, err
 	}
@@ -249,9 +293,23 @@ func (n *DiskNode) addPoppedUpElementIntoCurrentNodeAndUpdateWithNewChildren(ele
 	n.setChildAtIndex(insertionIndex+1, rightNode)
 }
 
-func (n *DiskNode) insert(value *Pairs, bt *btree) (*Pairs, *DiskNode, *DiskNode, error) {
+// insert - Inserts or replaces the pair in the subtree, added tells whether the key is new
+// so every node on the path counts one pair more, appending whether it goes after every
+// key of the tree so the nodes it overflows are split sequentially (see splitIndex)
+func (n *DiskNode) insert(value *Pairs, bt *btree, added bool, appending bool) (*Pairs, *DiskNode, *DiskNode, error) {
+	// A key already stored in this node is replaced in place, keys stay unique
+	if index, found := n.indexOfKey(value.Key); found {
+		n.keys[index] = value
+		if !n.hasOverFlown() {
+			err := n.blockService.UpdateNodeToDisk(n)
+			return nil, nil, nil, err
+		}
+		// A longer value can overflow a prefix compressed page
+		return n.splitOverflown(bt)
+	}
 	if n.isLeaf() {
 		n.addElement(value)
+		n.count++
 		if !n.hasOverFlown() {
 			// So lets store this updated node on disk
 			err := n.blockService.UpdateNodeToDisk(n)
@@ -261,13 +319,13 @@ func (n *DiskNode) insert(value *Pairs, bt *btree) (*Pairs, *DiskNode, *DiskNode
 			return nil, nil, nil, nil
 		}
 		if bt.isRootNode(n) {
-			poppedMiddleElement, leftNode, rightNode, err := n.splitLeafNode()
+			poppedMiddleElement, leftNode, rightNode, err := n.splitLeafNode(appending)
 			if err != nil {
 				return nil, nil, nil, err
 			}
 			//NOTE : NODE CREATION WILL TAKE PLACE HERE
 			newRootNode, err := newRootNodeWithSingleElementAndTwoChildren(poppedMiddleElement,
-				leftNode.blockID, rightNode.blockID, n.blockService)
+				leftNode.blockID, rightNode.blockID, bt.rootID, n.blockService)
 			if err != nil {
 				return nil, nil, nil, err
 			}
@@ -276,7 +334,8 @@ func (n *DiskNode) insert(value *Pairs, bt *btree) (*Pairs, *DiskNode, *DiskNode
 
 		}
 		// Split the node and return to parent function with pooped up element and left,right nodes
-		return n.splitLeafNode()
+		n.blockService.drop(n.blockID)
+		return n.splitLeafNode(appending)
 
 	}
 	// Get the child Node for insertion
@@ -284,13 +343,19 @@ func (n *DiskNode) insert(value *Pairs, bt *btree) (*Pairs, *DiskNode, *DiskNode
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	poppedMiddleElement, leftNode, rightNode, err := childNodeToBeInserted.insert(value, bt)
+	poppedMiddleElement, leftNode, rightNode, err := childNodeToBeInserted.insert(value, bt, added, appending)
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	if added {
+		n.count++
+	}
 	if poppedMiddleElement == nil {
-		// this means element has been inserted into the child and hence we do nothing
-		return poppedMiddleElement, leftNode, rightNode, nil
+		// this means element has been inserted into the child, only the count changed
+		if !added {
+			return nil, nil, nil, nil
+		}
+		return nil, nil, nil, n.blockService.UpdateNodeToDisk(n)
 	}
 	// Insert popped up element into current node along with updating the child pointers
 	// with new left and right nodes returned
@@ -308,7 +373,7 @@ func (n *DiskNode) insert(value *Pairs, bt *btree) (*Pairs, *DiskNode, *DiskNode
 	}
 	// this means that the current parent node has overflown, we need to split this up
 	// and move the popped up element upwards if this is not the root
-	poppedMiddleElement, leftNode, rightNode, err = n.splitNonLeafNode()
+	poppedMiddleElement, leftNode, rightNode, err = n.splitNonLeafNode(appending)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -322,10 +387,11 @@ func (n *DiskNode) insert(value *Pairs, bt *btree) (*Pairs, *DiskNode, *DiskNode
 	*/
 
 	if !bt.isRootNode(n) {
+		n.blockService.drop(n.blockID)
 		return poppedMiddleElement, leftNode, rightNode, nil
 	}
 	newRootNode, err := newRootNodeWithSingleElementAndTwoChildren(poppedMiddleElement,
-		leftNode.blockID, rightNode.blockID, n.blockService)
+		leftNode.blockID, rightNode.blockID, bt.rootID, n.blockService)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -336,6 +402,64 @@ func (n *DiskNode) insert(value *Pairs, bt *btree) (*Pairs, *DiskNode, *DiskNode
 	return nil, nil, nil, nil
 }
 
+// split - Splits the node whether it is a leaf or not
+func (n *DiskNode) split(appending bool) (*Pairs, *DiskNode, *DiskNode, error) {
+	if n.isLeaf() {
+		return n.splitLeafNode(appending)
+	}
+	return n.splitNonLeafNode(appending)
+}
+
+// splitOverflown - Splits the overflown node, a root is replaced in its block by a root
+// over the two halves, other nodes hand the middle element and the halves to their parent
+func (n *DiskNode) splitOverflown(bt *btree) (*Pairs, *DiskNode, *DiskNode, error) {
+	middle, leftNode, rightNode, err := n.split(false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !bt.isRootNode(n) {
+		n.blockService.drop(n.blockID)
+		return middle, leftNode, rightNode, nil
+	}
+	newRootNode, err := newRootNodeWithSingleElementAndTwoChildren(middle,
+		leftNode.blockID, rightNode.blockID, bt.rootID, n.blockService)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	bt.setRootNode(newRootNode)
+	return nil, nil, nil, nil
+}
+
+// indexOfKey - Position of the key among the elements of the node
+func (n *DiskNode) indexOfKey(key string) (int, bool) {
+	for i := 0; i < len(n.getElements()); i++ {
+		if n.getElementAtIndex(i).Key == key {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// locate - Reports whether the key is stored in the subtree, and if not whether it goes
+// after every key of the subtree, at the end of its rightmost leaf
+func (n *DiskNode) locate(key string) (found bool, appending bool, err error) {
+	appending = true
+	for {
+		if _, found := n.indexOfKey(key); found {
+			return true, false, nil
+		}
+		// Only the last child of a node comes after all of its keys
+		childIndex := n.childIndexForKey(key)
+		appending = appending && childIndex == len(n.getElements())
+		if n.isLeaf() {
+			return false, appending, nil
+		}
+		if n, err = n.getChildAtIndex(childIndex); err != nil {
+			return false, false, err
+		}
+	}
+}
+
 func (n *DiskNode) searchElementInNode(key string) (string, bool) {
 	for i := 0; i < len(n.getElements()); i++ {
 		if (n.getElementAtIndex(i)).Key == key {
@@ -370,7 +494,12 @@ func (n *DiskNode) search(key string) (string, error) {
 
 // Insert - Insert value into Node
 func (n *DiskNode) insertPair(value *Pairs, bt *btree) error {
-	_, _, _, err := n.insert(value, bt)
+	// Look the key up first, a replaced pair doesn't change the counts along the path
+	found, appending, err := n.locate(value.Key)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = n.insert(value, bt, !found, appending)
 	if err != nil {
 		return err
 	}
@@ -1,16 +1,14 @@
 package helper
 
-import "os"
-
 type diskNodeService struct {
-	file *os.File
+	blockService *BlockService
 }
 
-func newDiskNodeService(file *os.File) *diskNodeService {
-	return &diskNodeService{file: file}
+func newDiskNodeService(bs *BlockService) *diskNodeService {
+	return &diskNodeService{blockService: bs}
 }
 func (dns *diskNodeService) getRootNodeFromDisk() (*DiskNode, error) {
-	bs := NewBlockService(dns.file)
+	bs := dns.blockService
 	rootBlock, err := bs.GetRootBlock()
 	if err != nil {
 		return nil, err
@@ -153,7 +153,7 @@ func TestSplitLeafNode(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	poppedUpMiddleElement, leftChild, rightChild, err := n.splitLeafNode()
+	poppedUpMiddleElement, leftChild, rightChild, err := n.splitLeafNode(false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -202,7 +202,7 @@ func TestSplitNonLeafNode(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	poppedUpMiddleElement, leftChild, rightChild, err := n.splitNonLeafNode()
+	poppedUpMiddleElement, leftChild, rightChild, err := n.splitNonLeafNode(false)
 	if err != nil {
 		t.Error(err)
 	}
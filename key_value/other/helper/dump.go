@@ -0,0 +1,116 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpNode - One block of the tree as exported by Dump
+type DumpNode struct {
+	BlockID uint64   `json:"block_id"`
+	Keys    []string `json:"keys"`
+	// Fill - Share of the block in use, see BlockService.fill
+	Fill     float64     `json:"fill"`
+	ChildIDs []uint64    `json:"child_ids,omitempty"`
+	Children []*DumpNode `json:"children,omitempty"`
+}
+
+// dump - Reads the subtree rooted at blockID, refusing to follow a block twice so a
+// corrupt file can't send the walk around a cycle
+func (bt *btree) dump(blockID uint64, visited map[uint64]bool) (*DumpNode, error) {
+	if visited[blockID] {
+		return nil, fmt.Errorf("block %d is referenced more than once", blockID)
+	}
+	visited[blockID] = true
+	bs := bt.blockService
+	block, err := bs.readBlock(int64(blockID))
+	if err != nil {
+		return nil, fmt.Errorf("reading block %d: %w", blockID, err)
+	}
+	n := &DumpNode{
+		BlockID:  blockID,
+		Keys:     make([]string, len(block.DataSet)),
+		Fill:     bs.fill(block),
+		ChildIDs: block.ChildrenBlocksIds,
+	}
+	for i, pair := range block.DataSet {
+		n.Keys[i] = pair.Key
+	}
+	for _, childID := range block.ChildrenBlocksIds {
+		child, err := bt.dump(childID, visited)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, child)
+	}
+	return n, nil
+}
+
+//Dump - Export the whole tree, starting from the root block
+func (db *DB) Dump() (*DumpNode, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.storage.inMemory() {
+		return nil, ErrInMemory
+	}
+	return db.storage.dump(0, make(map[uint64]bool))
+}
+
+//DumpJSON - Write the tree to w as indented JSON
+func (db *DB) DumpJSON(w io.Writer) error {
+	root, err := db.Dump()
+	if err != nil {
+		return err
+	}
+	return WriteJSON(w, root)
+}
+
+//DumpDOT - Write the tree to w as a Graphviz digraph
+func (db *DB) DumpDOT(w io.Writer) error {
+	root, err := db.Dump()
+	if err != nil {
+		return err
+	}
+	return WriteDOT(w, root)
+}
+
+// WriteJSON - Write a dumped tree to w as indented JSON
+func WriteJSON(w io.Writer, root *DumpNode) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(root)
+}
+
+// dotEscape - Escapes a string for use inside a quoted DOT label
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// WriteDOT - Write a dumped tree to w as a Graphviz digraph, one box per block labelled
+// with its id, fill level and keys, and an edge per child pointer
+func WriteDOT(w io.Writer, root *DumpNode) error {
+	var b strings.Builder
+	b.WriteString("digraph btree {\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	var walk func(n *DumpNode)
+	walk = func(n *DumpNode) {
+		label := fmt.Sprintf("block %d (%.0f%%)\\n", n.BlockID, n.Fill*100)
+		for _, key := range n.Keys {
+			label += dotEscape(key) + `\l`
+		}
+		fmt.Fprintf(&b, "\tb%d [label=\"%s\"];\n", n.BlockID, label)
+		for i, child := range n.Children {
+			fmt.Fprintf(&b, "\tb%d -> b%d [label=\"%d\"];\n", n.BlockID, child.BlockID, i)
+			walk(child)
+		}
+	}
+	walk(root)
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,64 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDumpTree(t *testing.T) {
+	db, err := Open(clearNamedDB("dump.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		if err := db.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%040d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := db.DumpJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	var root DumpNode
+	if err := json.Unmarshal(out.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.BlockID != 0 || len(root.Children) != len(root.ChildIDs) || len(root.Children) != len(root.Keys)+1 {
+		t.Error("Root should be block 0 with a child on each side of its keys", root)
+	}
+	var count func(n *DumpNode) int
+	count = func(n *DumpNode) int {
+		total := len(n.Keys)
+		for _, child := range n.Children {
+			total += count(child)
+		}
+		return total
+	}
+	if count(&root) != 100 {
+		t.Error("Dump should hold every key", count(&root))
+	}
+
+	out.Reset()
+	if err := db.DumpDOT(&out); err != nil {
+		t.Fatal(err)
+	}
+	dot := out.String()
+	if !strings.HasPrefix(dot, "digraph btree {") || !strings.Contains(dot, fmt.Sprintf("b0 -> b%d", root.ChildIDs[0])) {
+		t.Error("Unexpected DOT output", dot)
+	}
+}
+
+func TestWriteDOTEscapesKeys(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteDOT(&out, &DumpNode{Keys: []string{`say "hi"`}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `say \"hi\"`) {
+		t.Error("Quotes should be escaped", out.String())
+	}
+}
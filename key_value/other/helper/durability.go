@@ -0,0 +1,172 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SyncMode - When writes are flushed to stable storage
+type SyncMode int
+
+const (
+	// SyncNone - Leave flushing to the operating system, acknowledged writes can be lost
+	// on power failure
+	SyncNone SyncMode = iota
+	// SyncAlways - Sync the file before every write is acknowledged
+	SyncAlways
+	// SyncInterval - Group commit, writes wait for a shared sync issued every interval
+	SyncInterval
+)
+
+const DefaultSyncInterval = 10 * time.Millisecond
+
+var syncModeNames = map[SyncMode]string{
+	SyncNone:     "none",
+	SyncAlways:   "always",
+	SyncInterval: "interval",
+}
+
+func (m SyncMode) String() string {
+	if name, ok := syncModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("syncmode(%d)", int(m))
+}
+
+// ParseSyncMode - Returns the sync mode with the given name (always|interval|none)
+func ParseSyncMode(name string) (SyncMode, error) {
+	for mode, modeName := range syncModeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return SyncNone, fmt.Errorf("unknown sync mode %q", name)
+}
+
+/**
+GROUP COMMIT
+	Every acknowledged write takes a ticket (pending). A background goroutine wakes up every
+	interval, syncs the file once if there is anything pending and marks all tickets taken
+	before the sync as synced, waking up the writers waiting on them. A failed sync is
+	sticky, once the file could not be synced later writes can't be trusted either.
+*/
+
+// Syncer - Applies a sync mode to a file written by appends or in place, shared with the
+// engines that keep their data in other files than a B-tree
+type Syncer struct {
+	file     *os.File
+	mode     SyncMode
+	interval time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending uint64
+	synced  uint64
+	err     error
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewSyncer(file *os.File, mode SyncMode, interval time.Duration) *Syncer {
+	s := &Syncer{file: file, mode: mode, interval: interval}
+	s.cond = sync.NewCond(&s.mu)
+	if mode == SyncInterval {
+		if s.interval <= 0 {
+			s.interval = DefaultSyncInterval
+		}
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.run()
+	}
+	return s
+}
+
+func (s *Syncer) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.syncPending()
+		case <-s.stop:
+			s.syncPending()
+			return
+		}
+	}
+}
+
+// syncPending - Syncs the file once for every ticket taken so far
+func (s *Syncer) syncPending() {
+	s.mu.Lock()
+	target := s.pending
+	if s.synced >= target {
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	err := s.file.Sync()
+
+	s.mu.Lock()
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	s.synced = target
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// Commit - Makes the writes done so far durable according to the sync mode
+func (s *Syncer) Commit() error {
+	switch s.mode {
+	case SyncAlways:
+		return s.file.Sync()
+	case SyncInterval:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.closed {
+			return os.ErrClosed
+		}
+		s.pending++
+		ticket := s.pending
+		for s.synced < ticket && s.err == nil {
+			s.cond.Wait()
+		}
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close - Stops the group commit goroutine and syncs the file one last time, covering
+// writes whose commit had not been requested yet
+func (s *Syncer) Close() error {
+	if s.mode == SyncInterval {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.stop)
+		<-s.done
+	}
+	err := s.file.Sync()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
+
+// syncDir - Makes the creations, renames and removals of files in the directory durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,114 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSyncMode(t *testing.T) {
+	for _, mode := range []SyncMode{SyncNone, SyncAlways, SyncInterval} {
+		parsed, err := ParseSyncMode(mode.String())
+		if err != nil || parsed != mode {
+			t.Error("Should parse its own name", mode, err)
+		}
+	}
+	if _, err := ParseSyncMode("sometimes"); err == nil {
+		t.Error("Should reject unknown sync modes")
+	}
+}
+
+func TestGroupCommitWaitsForSync(t *testing.T) {
+	file, err := os.OpenFile(clearNamedDB("sync.db"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	s := NewSyncer(file, SyncInterval, 5*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Commit(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	if s.synced != s.pending || s.pending != 20 {
+		t.Error("Every commit should be covered by a sync", s.synced, s.pending)
+	}
+	s.mu.Unlock()
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(); !errors.Is(err, os.ErrClosed) {
+		t.Error("Commit after close should fail", err)
+	}
+}
+
+func TestOpenWithSyncModes(t *testing.T) {
+	for _, mode := range []SyncMode{SyncNone, SyncAlways, SyncInterval} {
+		path := clearNamedDB("sync.db")
+		db, err := Open(path, WithSync(mode, time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i <= 50; i++ {
+			if err := db.Put(fmt.Sprintf("key-%d", i), "value"); err != nil {
+				t.Fatal(mode, err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(mode, err)
+		}
+
+		db, err = Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, found, err := db.Get("key-50")
+		if err != nil || !found {
+			t.Error("Value should be found after reopening", mode, err)
+		}
+		db.Close()
+	}
+}
+
+func TestConcurrentPutsShareGroupCommits(t *testing.T) {
+	db, err := Open(clearNamedDB("sync.db"), WithSync(SyncInterval, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if err := db.Put(fmt.Sprintf("key-%d-%d", w, i), "value"); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < 8; w++ {
+		for i := 0; i < 25; i++ {
+			if _, found, err := db.Get(fmt.Sprintf("key-%d-%d", w, i)); err != nil || !found {
+				t.Error("Value should be found", w, i, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package helper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ENCRYPTION AT REST
+	Every encrypted file has its own random data key, pages are sealed with it using AES-GCM.
+	The data key itself is stored in the header wrapped (AES-GCM sealed) by the master key
+	supplied to Open, so rotating the master key only needs the header and the pages to be
+	rewritten, see RotateKey.
+*/
+
+const dataKeySize = 32
+
+var (
+	ErrEncryptionKeyRequired = errors.New("database is encrypted, a master key is required")
+	ErrInvalidMasterKey      = errors.New("master key does not match the database")
+)
+
+// wrappedKeyData - Additional data binding a wrapped key to its purpose
+var wrappedKeyData = []byte("KVDB data key")
+
+func newCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealPayload - Encrypts the payload, returning nonce followed by the ciphertext
+func sealPayload(aead cipher.AEAD, payload []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(payload)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, payload, additionalData), nil
+}
+
+// openPayload - Decrypts a payload produced by sealPayload
+func openPayload(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed payload too short")
+	}
+	nonce := sealed[:aead.NonceSize()]
+	return aead.Open(nil, nonce, sealed[aead.NonceSize():], additionalData)
+}
+
+// newDataKey - Generates a data key, returning it along with its wrapped form
+func newDataKey(masterKey []byte) ([]byte, []byte, error) {
+	master, err := newCipher(masterKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := sealPayload(master, dataKey, wrappedKeyData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, wrapped, nil
+}
+
+func unwrapDataKey(masterKey []byte, wrapped []byte) ([]byte, error) {
+	master, err := newCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := openPayload(master, wrapped, wrappedKeyData)
+	if err != nil {
+		return nil, ErrInvalidMasterKey
+	}
+	return dataKey, nil
+}
+
+// rotateSuffix - Suffix of the files RotateKey writes before renaming them into place
+const rotateSuffix = ".rotate"
+
+/**
+KEY ROTATION
+	Every file sealed with the data key is rewritten under a temporary name first, the
+	database file, the segments of its value log and its history log. Renaming the database
+	file into place commits the rotation, the rewritten side files are renamed after it.
+		1. Write the side files as <name>.rotate, then write and sync path.rotate. Adding
+		   or removing encryption changes the length of the value log records, the
+		   pairs of the pages copied to path.rotate are pointed at their new place
+		2. Sync the directory, rename path.rotate over path and sync the directory again
+		3. Rename every side file into place
+	A rotation interrupted before step 2 leaves path.rotate behind, the next open removes it
+	along with the side files. One interrupted after it leaves side files alone, they are
+	sealed with the data key of the file now in place and the next open renames them (see
+	finishRotation). A failed rotation removes its side files before path.rotate, so the
+	two cases can't be mistaken for each other.
+*/
+
+// RotateKey - Re-encrypts the database file at path with a fresh data key wrapped by
+// newKey. oldKey opens the current file and may be nil for a plaintext file, a nil
+// newKey writes the file back as plaintext. The value log and the history log of the file
+// are rewritten along with it, a crash leaves either the original files or the rotated
+// ones.
+func RotateKey(path string, oldKey []byte, newKey []byte) error {
+	// Nobody may write the file while it is copied, the rename would drop their writes
+	src, err := openLocked(path, os.O_RDONLY, true, DefaultLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := finishRotation(path); err != nil {
+		return err
+	}
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 {
+		return fmt.Errorf("%s is empty, nothing to rotate", path)
+	}
+	srcBS, err := openBlockService(src, &options{masterKey: oldKey})
+	if err != nil {
+		return err
+	}
+	latestBlockID, err := srcBS.GetLatestBlockID()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + rotateSuffix
+	dst, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	var sideFiles []string
+	committed := false
+	defer func() {
+		if !committed {
+			for _, name := range sideFiles {
+				os.Remove(name)
+			}
+			os.Remove(tmpPath)
+		}
+	}()
+	// Openers of the rotated file wait until its side files are in place
+	if err := LockFile(dst, true, DefaultLockTimeout); err != nil {
+		return err
+	}
+
+	dstBS, err := initializeHeader(dst, &options{codec: srcBS.format.codec, masterKey: newKey})
+	if err != nil {
+		return err
+	}
+	// The pages are copied as they are, but for pointers to moved records of the value log,
+	// so are the catalog root, the free list and whether they are counted or prefix
+	// compressed. The bloom filter is sealed with the old data key, it is rebuilt by the
+	// next open.
+	dstBS.header.catalogRoot = srcBS.catalogRoot()
+	if srcBS.header != nil {
+		dstBS.header.freeList = srcBS.header.freeList
+	}
+	if !srcBS.counted() {
+		dstBS.header.flags &^= headerCounted
+	}
+	if !srcBS.prefixed() {
+		dstBS.header.flags &^= headerPrefixed
+	}
+	if err := dstBS.writeHeader(); err != nil {
+		return err
+	}
+	sealed, moved, err := resealValueLog(path, srcBS.format.cipher, dstBS.format.cipher)
+	sideFiles = append(sideFiles, sealed...)
+	if err != nil {
+		return err
+	}
+	for id := int64(0); id <= latestBlockID; id++ {
+		page, err := srcBS.readPage(id)
+		if err != nil {
+			return fmt.Errorf("reading block %d: %w", id, err)
+		}
+		if len(moved) > 0 {
+			// Pairs point at records that grew or shrank with the encryption
+			if page, err = srcBS.moveValueRefs(page, moved); err != nil {
+				return fmt.Errorf("reading block %d: %w", id, err)
+			}
+		}
+		if err := dstBS.writePage(uint64(id), page); err != nil {
+			return err
+		}
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+
+	log, err := loadHistory(historyPath(path), srcBS.format.cipher, true)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		defer log.file.Close()
+		tmpHistoryPath := historyPath(path) + rotateSuffix
+		file, err := os.OpenFile(tmpHistoryPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return err
+		}
+		sideFiles = append(sideFiles, tmpHistoryPath)
+		_, _, err = log.save(file, dstBS.format.cipher)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Dir(path)
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	committed = true
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	for _, name := range sideFiles {
+		if err := os.Rename(name, strings.TrimSuffix(name, rotateSuffix)); err != nil {
+			return err
+		}
+	}
+	return syncDir(dir)
+}
+
+// finishRotation - Completes the rotation of the file at path a crash interrupted once it
+// was committed, or discards the one interrupted before. Must be called with the file
+// locked.
+func finishRotation(path string) error {
+	sideFiles, err := filepath.Glob(path + valueLogSuffix + "*" + rotateSuffix)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(historyPath(path) + rotateSuffix); err == nil {
+		sideFiles = append(sideFiles, historyPath(path)+rotateSuffix)
+	}
+	_, err = os.Stat(path + rotateSuffix)
+	committed := errors.Is(err, os.ErrNotExist)
+	if err != nil && !committed {
+		return err
+	}
+	if committed && len(sideFiles) == 0 {
+		return nil
+	}
+	for _, name := range sideFiles {
+		if committed {
+			err = os.Rename(name, strings.TrimSuffix(name, rotateSuffix))
+		} else {
+			err = os.Remove(name)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if !committed {
+		if err := os.Remove(path + rotateSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return syncDir(filepath.Dir(path))
+}
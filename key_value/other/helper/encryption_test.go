@@ -0,0 +1,207 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var (
+	testMasterKey  = []byte("0123456789abcdef0123456789abcdef")
+	otherMasterKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func fillEncryptedDB(t *testing.T, path string) {
+	db, err := Open(path, WithEncryptionKey(testMasterKey), WithCompression(CodecFlate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 100; i++ {
+		if err := db.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("secret-value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShouldEncryptPagesOnDisk(t *testing.T) {
+	path := clearNamedDB("encrypted.db")
+	fillEncryptedDB(t, path)
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(contents, []byte("secret-value")) || bytes.Contains(contents, []byte("key-1")) {
+		t.Error("Plaintext should not be written to the file")
+	}
+
+	db, err := Open(path, WithEncryptionKey(testMasterKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, found, err := db.Get("key-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || value != "secret-value-42" {
+		t.Error("Should read back encrypted values", value)
+	}
+}
+
+func TestShouldRequireTheMasterKey(t *testing.T) {
+	path := clearNamedDB("encrypted.db")
+	fillEncryptedDB(t, path)
+
+	if _, err := Open(path); !errors.Is(err, ErrEncryptionKeyRequired) {
+		t.Error("Should require a master key", err)
+	}
+	if _, err := Open(path, WithEncryptionKey(otherMasterKey)); !errors.Is(err, ErrInvalidMasterKey) {
+		t.Error("Should reject the wrong master key", err)
+	}
+}
+
+func TestShouldDetectTamperedPages(t *testing.T) {
+	path := clearNamedDB("encrypted.db")
+	fillEncryptedDB(t, path)
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a byte inside the sealed payload of the root block
+	offset := int64(BlockSize + pageEnvelopeSize + 20)
+	b := make([]byte, 1)
+	file.ReadAt(b, offset)
+	b[0] ^= 0xff
+	file.WriteAt(b, offset)
+	file.Close()
+
+	if _, err := Open(path, WithEncryptionKey(testMasterKey)); err == nil {
+		t.Error("Should fail to authenticate a tampered page")
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	path := clearNamedDB("encrypted.db")
+	fillEncryptedDB(t, path)
+
+	if err := RotateKey(path, testMasterKey, otherMasterKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, WithEncryptionKey(testMasterKey)); !errors.Is(err, ErrInvalidMasterKey) {
+		t.Error("Old master key should no longer open the file", err)
+	}
+	db, err := Open(path, WithEncryptionKey(otherMasterKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 1; i <= 100; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || value != fmt.Sprintf("secret-value-%d", i) {
+			t.Error("Value should survive the rotation ", i)
+		}
+	}
+}
+
+func TestRotateKeyEncryptsPlaintextFile(t *testing.T) {
+	path := clearNamedDB("encrypted.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("hola", "amigos"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if err := RotateKey(path, nil, testMasterKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); !errors.Is(err, ErrEncryptionKeyRequired) {
+		t.Error("File should now be encrypted", err)
+	}
+	db, err = Open(path, WithEncryptionKey(testMasterKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, found, err := db.Get("hola")
+	if err != nil || !found || value != "amigos" {
+		t.Error("Should read the converted file", value, err)
+	}
+}
+
+func TestRotateKeyInterrupted(t *testing.T) {
+	path := clearVersionedDB("rotate_interrupted.db")
+	clearValueLogDB("rotate_interrupted.db")
+	segment := valueLogSegmentPath(path, 1)
+	sideFiles := []string{segment, historyPath(path)}
+	for _, name := range append(sideFiles, path) {
+		os.Remove(name + rotateSuffix)
+	}
+	db, err := Open(path, WithEncryptionKey(testMasterKey), WithVersioning(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("key", largeValue("old-value", 500))
+	db.Put("key", largeValue("new-value", 500))
+	db.Close()
+	original := make(map[string][]byte)
+	for _, name := range append(sideFiles, path) {
+		if original[name], err = os.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(key []byte) {
+		t.Helper()
+		db, err := Open(path, WithEncryptionKey(key), WithVersioning(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if value, _, err := db.Get("key"); err != nil || value != largeValue("new-value", 500) {
+			t.Error("The value log should match the file", len(value), err)
+		}
+		if versions, err := db.History("key"); err != nil || len(versions) != 2 || versions[0].Value != largeValue("old-value", 500) {
+			t.Error("The history should match the file", len(versions), err)
+		}
+		for _, name := range append(sideFiles, path) {
+			if _, err := os.Stat(name + rotateSuffix); !errors.Is(err, os.ErrNotExist) {
+				t.Error("Opening should leave no rotated file behind", name, err)
+			}
+		}
+	}
+
+	// Interrupted before the rename, the original files stay and the rotated ones go
+	for _, name := range append(sideFiles, path) {
+		if err := os.WriteFile(name+rotateSuffix, []byte("partly written"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(testMasterKey)
+
+	// Interrupted after the rename, the side files sealed with the new data key are renamed
+	if err := RotateKey(path, testMasterKey, otherMasterKey); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range sideFiles {
+		if err := os.Rename(name, name+rotateSuffix); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, original[name], 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(otherMasterKey)
+}
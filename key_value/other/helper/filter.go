@@ -0,0 +1,266 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"sync/atomic"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/bloom"
+)
+
+/**
+BLOOM FILTER
+	Lookups consult a bloom filter holding the keys of every tree of the file before they
+	walk a tree, a key the filter has never seen is missing without reading a page. Keys are
+	added as they are inserted and never removed, a deleted key only costs a walk. Each key
+	is prefixed with the root block of its tree so buckets don't answer for one another.
+	The filter is kept in memory and written next to the file on Close:
+		0:4   magic "KVBF"
+		4:8   CRC-32 of the body
+		8:    body: keys the filter was sized for (8), keys added (8), then the encoded
+		      filter. Sealed with the data key in encrypted files.
+	The headerFiltered flag of the file says the filter file holds every key. A writable
+	open clears it before the first write and Close sets it again once the filter is
+	synced, so after a crash, or for a file written without the filter, it is rebuilt
+	from a scan of the trees. It is rebuilt as well once more keys were added than it was
+	sized for, at the end of the write that overfilled it or on open, at twice the number
+	of keys so it doesn't fill up again right away.
+	Legacy files without a header and trees kept in memory have no filter.
+*/
+
+const filterSuffix = ".bloom"
+
+var filterMagic = []byte("KVBF")
+
+const (
+	filterHeaderSize = 8
+	filterBodySize   = 16
+	// filterMinKeys - Smallest number of keys a filter is sized for
+	filterMinKeys = 1024
+)
+
+// filterData - Additional data of a sealed filter
+var filterData = []byte("KVDB bloom")
+
+var errCorruptFilter = errors.New("corrupt bloom filter file")
+
+// keyFilter - Bloom filter over the keys of every tree of a file
+type keyFilter struct {
+	bloom *bloom.Filter
+	// capacity - Keys the filter was sized for
+	capacity uint64
+	// keys - Keys added since the filter was built, deleted ones included
+	keys uint64
+	// dirty - Keys were added since the filter was read from its file
+	dirty bool
+	// bitsPerKey - Bits per key of the filter when it is rebuilt
+	bitsPerKey int
+
+	// skipped - Lookups answered by the filter, updated atomically as reads share the lock
+	skipped uint64
+	// falsePositives - Lookups the filter let through for a missing key
+	falsePositives uint64
+}
+
+func filterPath(path string) string {
+	return path + filterSuffix
+}
+
+// filterKey - The key prefixed with the root block of its tree
+func filterKey(rootID uint64, key string) []byte {
+	buffer := make([]byte, 8, 8+len(key))
+	binary.LittleEndian.PutUint64(buffer, rootID)
+	return append(buffer, key...)
+}
+
+func newKeyFilter(keys uint64, bitsPerKey int) *keyFilter {
+	capacity := 2 * keys
+	if capacity < filterMinKeys {
+		capacity = filterMinKeys
+	}
+	return &keyFilter{bloom: bloom.New(int(capacity), bitsPerKey), capacity: capacity, dirty: true,
+		bitsPerKey: bitsPerKey}
+}
+
+// full - More keys were added than the filter was sized for
+func (f *keyFilter) full() bool {
+	return f.keys > f.capacity
+}
+
+// add - Adds the key, counting it when it is new to its tree
+func (f *keyFilter) add(rootID uint64, key string, added bool) {
+	f.bloom.Add(filterKey(rootID, key))
+	if added {
+		f.keys++
+	}
+	f.dirty = true
+}
+
+func (f *keyFilter) mayContain(rootID uint64, key string) bool {
+	if f.bloom.MayContain(filterKey(rootID, key)) {
+		return true
+	}
+	atomic.AddUint64(&f.skipped, 1)
+	return false
+}
+
+// falsePositiveRate - Estimated share of lookups of missing keys that get through
+func (f *keyFilter) falsePositiveRate() float64 {
+	return f.bloom.FalsePositiveRate(int(f.keys))
+}
+
+func (f *keyFilter) encode(aead cipher.AEAD) ([]byte, error) {
+	body := make([]byte, filterBodySize, filterBodySize+f.bloom.Size())
+	binary.LittleEndian.PutUint64(body, f.capacity)
+	binary.LittleEndian.PutUint64(body[8:], f.keys)
+	body = append(body, f.bloom.Encode()...)
+	if aead != nil {
+		var err error
+		if body, err = sealPayload(aead, body, filterData); err != nil {
+			return nil, err
+		}
+	}
+	buffer := make([]byte, filterHeaderSize, filterHeaderSize+len(body))
+	copy(buffer, filterMagic)
+	binary.LittleEndian.PutUint32(buffer[4:], crc32.ChecksumIEEE(body))
+	return append(buffer, body...), nil
+}
+
+// loadFilter - Reads the filter file at path
+func loadFilter(path string, aead cipher.AEAD) (*keyFilter, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffer) < filterHeaderSize || !bytes.Equal(buffer[:4], filterMagic) {
+		return nil, errCorruptFilter
+	}
+	body := buffer[filterHeaderSize:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(buffer[4:]) {
+		return nil, errCorruptFilter
+	}
+	if aead != nil {
+		if body, err = openPayload(aead, body, filterData); err != nil {
+			return nil, ErrInvalidMasterKey
+		}
+	}
+	if len(body) < filterBodySize {
+		return nil, errCorruptFilter
+	}
+	filter, err := bloom.Decode(body[filterBodySize:])
+	if err != nil {
+		return nil, err
+	}
+	return &keyFilter{
+		bloom:    filter,
+		capacity: binary.LittleEndian.Uint64(body),
+		keys:     binary.LittleEndian.Uint64(body[8:]),
+	}, nil
+}
+
+// filtered - Whether the filter file next to the file holds every key
+func (bs *BlockService) filtered() bool {
+	return bs.header != nil && bs.header.flags&headerFiltered != 0
+}
+
+// openFilter - Loads the filter of the file at path, rebuilding it when the file is stale
+// or too full, then marks it stale until Close when the tree is opened for writing. Without
+// bits per key the filter is off and only marked stale.
+func (bt *btree) openFilter(path string, bitsPerKey int) error {
+	bs := bt.blockService
+	if bs.filtered() && bitsPerKey > 0 {
+		if filter, err := loadFilter(filterPath(path), bs.format.cipher); err == nil && !filter.full() {
+			filter.bitsPerKey = bitsPerKey
+			bs.filter = filter
+		}
+	}
+	if bs.filter == nil && bitsPerKey > 0 {
+		if err := bt.rebuildFilter(bitsPerKey); err != nil {
+			return err
+		}
+	}
+	if bs.readOnly || !bs.filtered() {
+		return nil
+	}
+	bs.header.flags &^= headerFiltered
+	if err := bs.writeHeader(); err != nil {
+		return err
+	}
+	// The flag must be gone before any page it no longer vouches for
+	return bs.file.Sync()
+}
+
+// rebuildFilter - Builds the filter from a scan of the main tree, the catalog and the
+// buckets
+func (bt *btree) rebuildFilter(bitsPerKey int) error {
+	trees := []*btree{bt}
+	if bt.catalog != nil {
+		trees = append(trees, bt.catalog)
+	}
+	for _, name := range bt.bucketNames() {
+		trees = append(trees, bt.buckets[name])
+	}
+	var keys int64
+	for _, tree := range trees {
+		size, err := tree.size()
+		if err != nil {
+			return err
+		}
+		keys += size
+	}
+	filter := newKeyFilter(uint64(keys), bitsPerKey)
+	for _, tree := range trees {
+		err := tree.root.scan("", "", func(pair *Pairs) bool {
+			filter.add(tree.rootID, pair.Key, true)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	bt.blockService.filter = filter
+	return nil
+}
+
+// growFilter - Rebuilds the filter of the file of the main tree once it is full
+func (bt *btree) growFilter() error {
+	if filter := bt.filter(); filter != nil && filter.full() {
+		return bt.rebuildFilter(filter.bitsPerKey)
+	}
+	return nil
+}
+
+// saveFilter - Writes the filter next to the file at path and flags it as up to date
+func (bs *BlockService) saveFilter(path string) error {
+	if bs.filter.dirty {
+		buffer, err := bs.filter.encode(bs.format.cipher)
+		if err != nil {
+			return err
+		}
+		tmpPath := filterPath(path) + ".tmp"
+		if err := writeFileSync(tmpPath, buffer); err != nil {
+			return err
+		}
+		if err := os.Rename(tmpPath, filterPath(path)); err != nil {
+			return err
+		}
+	}
+	// Every page has to be on disk before the flag vouches for the filter
+	if err := bs.file.Sync(); err != nil {
+		return err
+	}
+	bs.header.flags |= headerFiltered
+	return bs.writeHeader()
+}
+
+// filter - The filter of the file backing the tree, nil when it has none
+func (bt *btree) filter() *keyFilter {
+	if bt.inMemory() {
+		return nil
+	}
+	return bt.blockService.filter
+}
@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// clearFilteredDB - Like clearNamedDB, also removing the bloom filter file
+func clearFilteredDB(name string) string {
+	path := clearNamedDB(name)
+	os.Remove(filterPath(path))
+	return path
+}
+
+// checkFilteredKeys - Every stored key is found and most missing ones are answered by the
+// filter
+func checkFilteredKeys(t *testing.T, db *DB, keys int) {
+	t.Helper()
+	for i := 0; i < keys; i++ {
+		if _, found, err := db.Get(fmt.Sprintf("key-%05d", i)); err != nil || !found {
+			t.Fatal("The filter must not hide a stored key", i, err)
+		}
+	}
+	before, _ := db.Stats()
+	for i := 0; i < 1000; i++ {
+		if _, found, _ := db.Get(fmt.Sprintf("missing-%05d", i)); found {
+			t.Fatal("Found a key that was never stored", i)
+		}
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := after.BloomSkipped - before.BloomSkipped
+	falsePositives := after.BloomFalsePositives - before.BloomFalsePositives
+	if skipped+falsePositives != 1000 || skipped < 950 {
+		t.Error("Most missing keys should be answered by the filter", skipped, falsePositives)
+	}
+	if after.BloomFalsePositiveRate <= 0 || after.BloomFalsePositiveRate > 0.02 {
+		t.Error("Unexpected false positive rate", after.BloomFalsePositiveRate)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	path := clearFilteredDB("bloom.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3000; i++ {
+		db.Put(fmt.Sprintf("key-%05d", i), "value")
+	}
+	db.CreateBucket("things")
+	bucket, _ := db.Bucket("things")
+	bucket.Put("thing", "value")
+	checkFilteredKeys(t, db, 3000)
+	if _, found, _ := db.Get("thing"); found {
+		t.Error("A key of a bucket is not a key of the database")
+	}
+	if db.storage.blockService.filtered() {
+		t.Error("The filter file is stale while the database is open for writing")
+	}
+	db.Close()
+
+	db, err = Open(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter := db.storage.blockService.filter; filter == nil || filter.dirty || filter.keys != 3002 {
+		t.Fatal("Open should read the filter saved by Close", filter)
+	}
+	checkFilteredKeys(t, db, 3000)
+	bucket, _ = db.Bucket("things")
+	if _, found, _ := bucket.Get("thing"); !found {
+		t.Error("The filter must not hide a key of a bucket")
+	}
+	db.Close()
+}
+
+func TestBloomFilterRebuilt(t *testing.T) {
+	path := clearFilteredDB("bloom_stale.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		db.Put(fmt.Sprintf("key-%05d", i), "value")
+	}
+	db.Close()
+
+	// Writes made without the filter leave its file behind
+	db, err = Open(path, WithBloomBitsPerKey(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1000; i < 2000; i++ {
+		db.Put(fmt.Sprintf("key-%05d", i), "value")
+	}
+	if stats, _ := db.Stats(); stats.BloomBytes != 0 {
+		t.Error("The filter should be off", stats.BloomBytes)
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter := db.storage.blockService.filter; filter == nil || filter.keys != 2000 || filter.capacity != 4000 {
+		t.Fatal("A stale filter should be rebuilt for the keys of the file", filter)
+	}
+	checkFilteredKeys(t, db, 2000)
+	db.Close()
+
+	// A damaged filter file is rebuilt too
+	if err := os.WriteFile(filterPath(path), []byte("KVBF garbage"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkFilteredKeys(t, db, 2000)
+}
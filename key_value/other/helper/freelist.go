@@ -0,0 +1,100 @@
+package helper
+
+import "errors"
+
+/**
+FREE LIST
+	Pages a tree no longer uses are chained into a list starting at the header. A free page
+	is an empty block whose count holds the next free block, 0 ends the list since block 0
+	is always the root of the main tree. New nodes take the first free block before the
+	file grows.
+	Splits and merges drop the blocks of the nodes they replace, those are freed once the
+	insert or delete is done and every parent points at the new nodes.
+	Freed pages are written before the header points to them and an allocated page leaves
+	the list before it is used, a crash in between leaks pages instead of handing out one
+	still in use. Legacy files without a header have no free list, the pages they drop are
+	left unreachable.
+*/
+
+var errCorruptFreeList = errors.New("corrupt free list")
+
+// allocateBlockID - Block for a new node, taken off the free list when it has any
+func (bs *BlockService) allocateBlockID() (uint64, error) {
+	if bs.header == nil || bs.header.freeList == 0 {
+		latestBlockID, err := bs.GetLatestBlockID()
+		if err != nil {
+			return 0, err
+		}
+		return uint64(latestBlockID + 1), nil
+	}
+	blockID := bs.header.freeList
+	block, err := bs.readBlock(int64(blockID))
+	if err != nil {
+		return 0, err
+	}
+	bs.header.freeList = block.Count
+	return blockID, bs.writeHeader()
+}
+
+// freeBlocks - Empties the blocks and puts them on the free list
+func (bs *BlockService) freeBlocks(blockIDs []uint64) error {
+	if bs.header == nil || len(blockIDs) == 0 {
+		return nil
+	}
+	next := bs.header.freeList
+	for _, blockID := range blockIDs {
+		// Emptying the page also keeps Repair from bringing back what was dropped
+		if err := bs.WriteBlockToDisk(&DiskBlock{Id: blockID, Count: next}); err != nil {
+			return err
+		}
+		next = blockID
+	}
+	bs.header.freeList = next
+	return bs.writeHeader()
+}
+
+// drop - Notes that the block is no longer used by the write in progress
+func (bs *BlockService) drop(blockID uint64) {
+	bs.dropped = append(bs.dropped, blockID)
+}
+
+// freeDropped - Frees the blocks dropped by a write once it is done, a failed write leaves
+// them unreachable instead since parts of the tree may still point to them
+func (bs *BlockService) freeDropped(err error) error {
+	dropped := bs.dropped
+	bs.dropped = nil
+	if err != nil {
+		return err
+	}
+	return bs.freeBlocks(dropped)
+}
+
+// freeBlockIDs - Blocks on the free list, stopping at a block that is not free or seen
+// twice so a corrupt list can't send the walk around a cycle
+func (bs *BlockService) freeBlockIDs() ([]uint64, error) {
+	if bs.header == nil {
+		return nil, nil
+	}
+	latestBlockID, err := bs.GetLatestBlockID()
+	if err != nil {
+		return nil, err
+	}
+	var blockIDs []uint64
+	seen := make(map[uint64]bool)
+	for blockID := bs.header.freeList; blockID != 0; {
+		if seen[blockID] || int64(blockID) > latestBlockID {
+			return blockIDs, errCorruptFreeList
+		}
+		seen[blockID] = true
+		block, err := bs.readBlock(int64(blockID))
+		if err != nil {
+			return blockIDs, err
+		}
+		if block.CurenLeafSize != 0 || block.CurrentChildrenSize != 0 {
+			return blockIDs, errCorruptFreeList
+		}
+		blockIDs = append(blockIDs, blockID)
+		blockID = block.Count
+	}
+	return blockIDs, nil
+}
@@ -0,0 +1,137 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/**
+FILE HEADER
+	Files created by Open reserve their first BlockSize bytes for a header, block 0 (the root)
+	starts right after it. Files written before the header existed start directly with the
+	root block, we tell them apart by the magic bytes since a legacy root always starts with
+	its block id 0.
+
+	0:4   magic "KVDB"
+	4:8   format version
+	8     page codec
+	9     flags (headerEncrypted, headerCounted, headerFiltered, headerPrefixed)
+	10:12 wrapped data key length
+	12:   wrapped data key
+	then  root block of the bucket catalog (8), 0 until the first bucket is created. Files
+	      written before buckets existed have zeros there.
+	then  first block of the free list (8), 0 when it is empty, see freelist.go
+*/
+
+const headerVersion = 1
+
+var headerMagic = []byte("KVDB")
+
+const (
+	headerEncrypted = 1 << 0
+	// headerCounted - Every page records the number of pairs in its subtree
+	headerCounted = 1 << 1
+	// headerFiltered - The bloom filter file next to the file holds every key, see filter.go
+	headerFiltered = 1 << 2
+	// headerPrefixed - Pages store their keys prefix compressed, see prefix.go
+	headerPrefixed = 1 << 3
+)
+
+var ErrUnsupportedVersion = errors.New("unsupported database file version")
+
+// fileHeader - Metadata stored in the header block of the file
+type fileHeader struct {
+	version    uint32
+	codec      Codec
+	flags      uint8
+	wrappedKey []byte
+	// catalogRoot - Root block of the tree of buckets, 0 when the file has none
+	catalogRoot uint64
+	// freeList - First block of the free list, 0 when it is empty
+	freeList uint64
+}
+
+func newFileHeader(o *options) *fileHeader {
+	return &fileHeader{version: headerVersion, codec: o.codec}
+}
+
+func (h *fileHeader) encrypted() bool {
+	return h.flags&headerEncrypted != 0
+}
+
+// pageFormat - Builds the page format of the file, unwrapping its data key when encrypted
+func (h *fileHeader) pageFormat(masterKey []byte) (pageFormat, error) {
+	format := pageFormat{codec: h.codec}
+	if !h.encrypted() {
+		return format, nil
+	}
+	if masterKey == nil {
+		return format, ErrEncryptionKeyRequired
+	}
+	dataKey, err := unwrapDataKey(masterKey, h.wrappedKey)
+	if err != nil {
+		return format, err
+	}
+	format.cipher, err = newCipher(dataKey)
+	return format, err
+}
+
+// hasHeader - Reports whether the buffer read from the start of a file holds a header
+func hasHeader(buffer []byte) bool {
+	return len(buffer) >= len(headerMagic) && bytes.Equal(buffer[:len(headerMagic)], headerMagic)
+}
+
+func (h *fileHeader) toBuffer() []byte {
+	buffer := make([]byte, BlockSize)
+	offset := 0
+	copy(buffer[offset:], headerMagic)
+	offset += len(headerMagic)
+	binary.LittleEndian.PutUint32(buffer[offset:], h.version)
+	offset += 4
+	buffer[offset] = byte(h.codec)
+	offset++
+	buffer[offset] = h.flags
+	offset++
+	binary.LittleEndian.PutUint16(buffer[offset:], uint16(len(h.wrappedKey)))
+	offset += 2
+	copy(buffer[offset:], h.wrappedKey)
+	offset += len(h.wrappedKey)
+	binary.LittleEndian.PutUint64(buffer[offset:], h.catalogRoot)
+	offset += 8
+	binary.LittleEndian.PutUint64(buffer[offset:], h.freeList)
+	return buffer
+}
+
+func headerFromBuffer(buffer []byte) (*fileHeader, error) {
+	if !hasHeader(buffer) {
+		return nil, errors.New("missing database file header")
+	}
+	h := &fileHeader{}
+	offset := len(headerMagic)
+	h.version = binary.LittleEndian.Uint32(buffer[offset:])
+	offset += 4
+	if h.version > headerVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.version)
+	}
+	h.codec = Codec(buffer[offset])
+	if !h.codec.valid() {
+		return nil, fmt.Errorf("unknown page codec %d in header", h.codec)
+	}
+	offset++
+	h.flags = buffer[offset]
+	offset++
+	keyLength := int(binary.LittleEndian.Uint16(buffer[offset:]))
+	offset += 2
+	if offset+keyLength+16 > len(buffer) {
+		return nil, errors.New("corrupt database file header")
+	}
+	h.wrappedKey = make([]byte, keyLength)
+	copy(h.wrappedKey, buffer[offset:offset+keyLength])
+	offset += keyLength
+	h.catalogRoot = binary.LittleEndian.Uint64(buffer[offset:])
+	offset += 8
+	h.freeList = binary.LittleEndian.Uint64(buffer[offset:])
+	return h, nil
+}
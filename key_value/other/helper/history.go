@@ -0,0 +1,582 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+VERSION HISTORY
+	Opened WithVersioning every write to the main tree is also appended to a history log
+	next to the file, so overwritten and deleted values can be read back for a while. The
+	log starts with a header:
+		0:4   magic "KVHS"
+		4:12  retention in nanoseconds, 0 keeps every version
+	followed by one record per write:
+		0:4   body length
+		4:8   CRC-32 of the body
+		8:    body: time of the write in unix nanoseconds (8), flags (historyDeleted), key
+		      length (2), key, value. Sealed with the data key in encrypted files.
+	The log is indexed on open, like the keydir of the bitcask engine: memory holds one list
+	of versions per key, oldest first, each pointing at its record, and values are read from
+	the log when asked for. A record is appended once the write to the tree succeeded. The
+	first write to a key since versioning was turned on logs the value it replaces at time
+	0 first, that value has been there since before the log.
+	A version is kept until retention has passed since the write that replaced it, the
+	latest version of a key is kept unless it is a delete. Every time the log doubles since
+	it was last swept, and on open, the versions that fell out of the window are dropped
+	and the log is rewritten once it holds more dropped records than kept ones, the same
+	way merges compact the bitcask engine. A torn record at the end is cut off.
+	Buckets are not versioned.
+*/
+
+const historySuffix = ".history"
+
+var historyMagic = []byte("KVHS")
+
+const (
+	historyHeaderSize = 12
+	historyRecordSize = 8
+	historyBodySize   = 11
+
+	historyDeleted = 1 << 0
+
+	// historySweepRecords - Records the log holds at least before a write sweeps it
+	historySweepRecords = 1024
+)
+
+// historyData - Additional data of sealed history records
+var historyData = []byte("KVDB history")
+
+var (
+	ErrNotVersioned   = errors.New("database is not versioned")
+	ErrVersionExpired = errors.New("time is before the retention window of the history")
+	errCorruptHistory = errors.New("corrupt history log")
+)
+
+// Version - One value a key had, as returned by History
+type Version struct {
+	Value   string `json:"value,omitempty"`
+	Deleted bool   `json:"deleted"`
+	// Time - When the version was written, zero for a value written before versioning was
+	// turned on
+	Time time.Time `json:"time"`
+}
+
+// version - A version of a key and where its record sits in the log
+type version struct {
+	at      int64
+	deleted bool
+	offset  int64
+	length  uint32
+}
+
+// history - The history log of a database and the index of its versions
+type history struct {
+	path      string
+	file      *os.File
+	size      int64
+	cipher    cipher.AEAD
+	retention time.Duration
+	versions  map[string][]version
+	// records - Records in the log, dropped ones included, live - Versions in the index
+	records, live int
+	// sweepAt - Records the log holds when the next write sweeps it
+	sweepAt int
+	// mu - Guards syncer, which commits outside the lock of the database while a write
+	// may replace it
+	mu     sync.Mutex
+	syncer *Syncer
+}
+
+func historyPath(path string) string {
+	return path + historySuffix
+}
+
+// openHistory - Opens the history log of the database file at path. A missing log is
+// created when versioning is asked for, otherwise the database is not versioned and nil
+// is returned. A log opened without WithVersioning keeps the retention it was written with.
+func openHistory(path string, o *options, format pageFormat) (*history, error) {
+	h, err := loadHistory(historyPath(path), format.cipher, o.readOnly)
+	if errors.Is(err, os.ErrNotExist) {
+		if !o.versioning || o.readOnly {
+			return nil, nil
+		}
+		if err := writeHistory(historyPath(path), o.retention); err != nil {
+			return nil, err
+		}
+		h, err = loadHistory(historyPath(path), format.cipher, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored := h.retention
+	if o.versioning {
+		h.retention = o.retention
+	}
+	if o.readOnly {
+		h.prune(time.Now().UnixNano())
+		return h, nil
+	}
+	// A changed retention is recorded in the header by rewriting the log
+	if err := h.sweep(h.retention != stored); err != nil {
+		h.file.Close()
+		return nil, err
+	}
+	h.syncer = NewSyncer(h.file, o.syncMode, o.syncInterval)
+	return h, nil
+}
+
+// loadHistory - Indexes the log at path, cutting off a torn record at its end unless it
+// is opened read-only
+func loadHistory(path string, aead cipher.AEAD, readOnly bool) (*history, error) {
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	h := &history{path: path, file: file, cipher: aead, versions: make(map[string][]version)}
+	if err := h.read(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !readOnly {
+		if err := file.Truncate(h.size); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (h *history) read() error {
+	reader := bufio.NewReader(h.file)
+	header := make([]byte, historyHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.Equal(header[:4], historyMagic) {
+		return errCorruptHistory
+	}
+	h.retention = time.Duration(binary.LittleEndian.Uint64(header[4:]))
+	h.size = historyHeaderSize
+
+	prefix := make([]byte, historyRecordSize)
+	for {
+		if _, err := io.ReadFull(reader, prefix); err != nil {
+			return nil
+		}
+		length := binary.LittleEndian.Uint32(prefix)
+		if length < historyBodySize || length > valueLogMaxBody {
+			return nil
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil
+		}
+		if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(prefix[4:]) {
+			return nil
+		}
+		key, v, _, err := h.decode(body)
+		if err != nil {
+			// The checksum held, the record was sealed with another key
+			return err
+		}
+		v.offset, v.length = h.size, length
+		h.versions[key] = append(h.versions[key], v)
+		h.records++
+		h.live++
+		h.size += historyRecordSize + int64(length)
+	}
+}
+
+func (h *history) encode(buffer []byte, key string, v version, value string) ([]byte, error) {
+	body := make([]byte, historyBodySize, historyBodySize+len(key)+len(value))
+	binary.LittleEndian.PutUint64(body, uint64(v.at))
+	if v.deleted {
+		body[8] = historyDeleted
+	}
+	binary.LittleEndian.PutUint16(body[9:], uint16(len(key)))
+	body = append(append(body, key...), value...)
+	if h.cipher != nil {
+		var err error
+		if body, err = sealPayload(h.cipher, body, historyData); err != nil {
+			return nil, err
+		}
+	}
+	var prefix [historyRecordSize]byte
+	binary.LittleEndian.PutUint32(prefix[:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(prefix[4:], crc32.ChecksumIEEE(body))
+	return append(append(buffer, prefix[:]...), body...), nil
+}
+
+// append - Encodes the version into buffer, which is written to the log at h.size, and
+// points the version at its record
+func (h *history) append(buffer []byte, key string, v *version, value string) ([]byte, error) {
+	start := len(buffer)
+	buffer, err := h.encode(buffer, key, *v, value)
+	if err != nil {
+		return nil, err
+	}
+	v.offset = h.size + int64(start)
+	v.length = uint32(len(buffer) - start - historyRecordSize)
+	return buffer, nil
+}
+
+func (h *history) decode(body []byte) (string, version, string, error) {
+	if h.cipher != nil {
+		opened, err := openPayload(h.cipher, body, historyData)
+		if err != nil {
+			return "", version{}, "", ErrInvalidMasterKey
+		}
+		body = opened
+	}
+	if len(body) < historyBodySize {
+		return "", version{}, "", errCorruptHistory
+	}
+	keyLen := int(binary.LittleEndian.Uint16(body[9:]))
+	if historyBodySize+keyLen > len(body) {
+		return "", version{}, "", errCorruptHistory
+	}
+	v := version{
+		at:      int64(binary.LittleEndian.Uint64(body)),
+		deleted: body[8]&historyDeleted != 0,
+	}
+	return string(body[historyBodySize : historyBodySize+keyLen]), v, string(body[historyBodySize+keyLen:]), nil
+}
+
+// value - Reads the value of the version from its record
+func (h *history) value(v version) (string, error) {
+	record := make([]byte, historyRecordSize+int(v.length))
+	if _, err := h.file.ReadAt(record, v.offset); err != nil {
+		return "", err
+	}
+	body := record[historyRecordSize:]
+	if binary.LittleEndian.Uint32(record) != v.length || crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(record[4:]) {
+		return "", errCorruptHistory
+	}
+	_, _, value, err := h.decode(body)
+	return value, err
+}
+
+func (h *history) export(v version) (Version, error) {
+	exported := Version{Deleted: v.deleted}
+	if v.at != 0 {
+		exported.Time = time.Unix(0, v.at)
+	}
+	var err error
+	exported.Value, err = h.value(v)
+	return exported, err
+}
+
+// writeHistory - Writes an empty log next to path and renames it into place
+func writeHistory(path string, retention time.Duration) error {
+	tmpPath := path + ".compact"
+	if err := writeFileSync(tmpPath, historyHeader(retention)); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func historyHeader(retention time.Duration) []byte {
+	header := make([]byte, historyHeaderSize)
+	copy(header, historyMagic)
+	binary.LittleEndian.PutUint64(header[4:], uint64(retention))
+	return header
+}
+
+// save - Writes a log holding the indexed versions, keys in order, to file and syncs it.
+// The values are read from the current log and sealed with aead. Returns the index of the
+// written log and its size.
+func (h *history) save(file *os.File, aead cipher.AEAD) (map[string][]version, int64, error) {
+	saved := &history{cipher: aead, size: historyHeaderSize, versions: make(map[string][]version, len(h.versions))}
+	writer := bufio.NewWriter(file)
+	if _, err := writer.Write(historyHeader(h.retention)); err != nil {
+		return nil, 0, err
+	}
+	keys := make([]string, 0, len(h.versions))
+	for key := range h.versions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buffer []byte
+	for _, key := range keys {
+		versions := make([]version, len(h.versions[key]))
+		for i, v := range h.versions[key] {
+			value, err := h.value(v)
+			if err != nil {
+				return nil, 0, err
+			}
+			if buffer, err = saved.append(buffer[:0], key, &v, value); err != nil {
+				return nil, 0, err
+			}
+			if _, err := writer.Write(buffer); err != nil {
+				return nil, 0, err
+			}
+			saved.size += int64(len(buffer))
+			versions[i] = v
+		}
+		saved.versions[key] = versions
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, 0, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, 0, err
+	}
+	return saved.versions, saved.size, nil
+}
+
+// writeFileSync - Writes the file and syncs it before returning
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// window - Drops the versions that fell out of the retention window at now
+func (h *history) window(versions []version, now int64) []version {
+	if h.retention <= 0 {
+		return versions
+	}
+	cutoff := now - int64(h.retention)
+	first := 0
+	for first < len(versions)-1 && versions[first+1].at < cutoff {
+		first++
+	}
+	versions = versions[first:]
+	if len(versions) == 1 && versions[0].deleted && versions[0].at < cutoff {
+		return nil
+	}
+	return versions
+}
+
+// prune - Drops the versions of every key that fell out of the retention window at now
+func (h *history) prune(now int64) {
+	h.live = 0
+	for key, versions := range h.versions {
+		if versions = h.window(versions, now); len(versions) == 0 {
+			delete(h.versions, key)
+		} else {
+			h.versions[key] = versions
+		}
+		h.live += len(versions)
+	}
+}
+
+// sweep - Prunes every key and rewrites the log once it holds more dropped records than
+// kept ones, or when forced
+func (h *history) sweep(force bool) error {
+	h.prune(time.Now().UnixNano())
+	if force || h.records > 2*h.live {
+		if err := h.rewrite(); err != nil {
+			return err
+		}
+	}
+	h.sweepAt = 2 * h.records
+	if h.sweepAt < historySweepRecords {
+		h.sweepAt = historySweepRecords
+	}
+	return nil
+}
+
+// rewrite - Replaces the log with one holding only the indexed versions
+func (h *history) rewrite() error {
+	tmpPath := h.path + ".compact"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	versions, size, err := h.save(file, h.cipher)
+	if err == nil {
+		err = os.Rename(tmpPath, h.path)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := syncDir(filepath.Dir(h.path)); err != nil {
+		file.Close()
+		return err
+	}
+	// Every record is in the synced log now, so is every record a waiting commit covers
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.syncer != nil {
+		h.syncer.Close()
+		h.syncer = NewSyncer(file, h.syncer.mode, h.syncer.interval)
+	}
+	h.file.Close()
+	h.file, h.size, h.versions = file, size, versions
+	h.records = h.live
+	return nil
+}
+
+// write - Logs a write of the key, old and existed describe the value it replaces
+func (h *history) write(key string, old string, existed bool, value string, deleted bool) error {
+	now := time.Now().UnixNano()
+	versions := h.versions[key]
+	live := len(versions)
+	var buffer []byte
+	var err error
+	records := 1
+	if len(versions) == 0 && existed {
+		before := version{}
+		if buffer, err = h.append(buffer, key, &before, old); err != nil {
+			return err
+		}
+		versions = append(versions, before)
+		records++
+	}
+	// Versions of a key are ordered by time, even when the clock steps back
+	if last := len(versions) - 1; last >= 0 && versions[last].at >= now {
+		now = versions[last].at + 1
+	}
+	v := version{at: now, deleted: deleted}
+	if buffer, err = h.append(buffer, key, &v, value); err != nil {
+		return err
+	}
+	if _, err := h.file.WriteAt(buffer, h.size); err != nil {
+		return err
+	}
+	h.size += int64(len(buffer))
+	h.records += records
+	if versions = h.window(append(versions, v), now); len(versions) == 0 {
+		delete(h.versions, key)
+	} else {
+		h.versions[key] = versions
+	}
+	h.live += len(versions) - live
+	if h.records >= h.sweepAt {
+		return h.sweep(false)
+	}
+	return nil
+}
+
+// commit - Makes the records written so far as durable as the sync mode promises
+func (h *history) commit() error {
+	h.mu.Lock()
+	syncer := h.syncer
+	h.mu.Unlock()
+	if syncer == nil {
+		return nil
+	}
+	err := syncer.Commit()
+	if errors.Is(err, os.ErrClosed) {
+		h.mu.Lock()
+		rewritten := syncer != h.syncer
+		h.mu.Unlock()
+		if rewritten {
+			// The log was rewritten and synced since the write
+			return nil
+		}
+	}
+	return err
+}
+
+func (h *history) close() error {
+	if h.syncer != nil {
+		if err := h.syncer.Close(); err != nil {
+			h.file.Close()
+			return err
+		}
+	}
+	return h.file.Close()
+}
+
+// current - Versions of the key still in the retention window
+func (h *history) current(key string) []version {
+	return h.window(h.versions[key], time.Now().UnixNano())
+}
+
+// getAt - The value of the key at the time, known is false for a key never written since
+// versioning was turned on, whose current value is the one it had then
+func (h *history) getAt(key string, at time.Time) (value string, found bool, known bool, err error) {
+	if h.retention > 0 && at.Before(time.Now().Add(-h.retention)) {
+		return "", false, true, ErrVersionExpired
+	}
+	versions := h.current(key)
+	if len(versions) == 0 {
+		return "", false, false, nil
+	}
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].at > at.UnixNano() })
+	if i == 0 {
+		// Every version was written after the time, the key did not exist yet
+		return "", false, true, nil
+	}
+	v := versions[i-1]
+	if v.deleted {
+		return "", false, true, nil
+	}
+	value, err = h.value(v)
+	return value, err == nil, true, err
+}
+
+// GetAt - The value key had at the given time. Needs a database opened WithVersioning and
+// a time inside the retention window, otherwise ErrVersionExpired is returned.
+func (db *DB) GetAt(key string, at time.Time) (string, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return "", false, ErrClosed
+	}
+	if db.history == nil {
+		return "", false, ErrNotVersioned
+	}
+	value, found, known, err := db.history.getAt(key, at)
+	if err != nil || known {
+		return value, found, err
+	}
+	return db.storage.get(key)
+}
+
+// History - The versions of key still in the retention window, oldest first. The last one
+// is the current value, or the delete that removed the key.
+func (db *DB) History(key string) ([]Version, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.history == nil {
+		return nil, ErrNotVersioned
+	}
+	versions := db.history.current(key)
+	if len(versions) == 0 {
+		// Not written since versioning was turned on, only its current value is known
+		value, found, err := db.storage.get(key)
+		if err != nil || !found {
+			return nil, err
+		}
+		return []Version{{Value: value}}, nil
+	}
+	exported := make([]Version, len(versions))
+	for i, v := range versions {
+		var err error
+		if exported[i], err = db.history.export(v); err != nil {
+			return nil, err
+		}
+	}
+	return exported, nil
+}
@@ -0,0 +1,226 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// clearVersionedDB - Like clearNamedDB, also removing the history log
+func clearVersionedDB(name string) string {
+	path := clearNamedDB(name)
+	os.Remove(historyPath(path))
+	return path
+}
+
+func TestHistory(t *testing.T) {
+	path := clearVersionedDB("history.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("legacy", "before")
+	if _, err := db.History("legacy"); !errors.Is(err, ErrNotVersioned) {
+		t.Error("History needs a versioned database", err)
+	}
+	db.Close()
+
+	db, err = Open(path, WithVersioning(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, found, _ := db.GetAt("legacy", time.Now()); !found || value != "before" {
+		t.Error("A key not written since versioning reads its current value", value)
+	}
+	start := time.Now()
+	db.Put("key", "v1")
+	afterFirst := time.Now()
+	db.Put("key", "v2")
+	db.Delete("key")
+	afterDelete := time.Now()
+	db.Put("key", "v3")
+	db.Put("legacy", "after")
+
+	for _, check := range []struct {
+		at    time.Time
+		value string
+		found bool
+	}{
+		{start, "", false},
+		{afterFirst, "v1", true},
+		{afterDelete, "", false},
+		{time.Now(), "v3", true},
+	} {
+		value, found, err := db.GetAt("key", check.at)
+		if err != nil || found != check.found || value != check.value {
+			t.Error("Unexpected value at", check.at, value, found, err)
+		}
+	}
+	db.Close()
+
+	// The database stays versioned without the option
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	versions, err := db.History("key")
+	if err != nil || len(versions) != 4 || versions[0].Value != "v1" || !versions[2].Deleted || versions[3].Value != "v3" {
+		t.Fatal("History should list every version oldest first", versions, err)
+	}
+	versions, _ = db.History("legacy")
+	if len(versions) != 2 || !versions[0].Time.IsZero() || versions[0].Value != "before" {
+		t.Error("The value from before versioning should be kept without a time", versions)
+	}
+	if value, _, _ := db.GetAt("legacy", start); value != "before" {
+		t.Error("Point in time read of the value from before versioning", value)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	path := clearVersionedDB("history_retention.db")
+	db, err := Open(path, WithVersioning(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for _, value := range []string{"v1", "v2", "v3"} {
+		db.Put("key", value)
+	}
+	db.Put("gone", "value")
+	db.Delete("gone")
+	if versions, _ := db.History("key"); len(versions) != 3 {
+		t.Error("Versions inside the window should be kept", versions)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, _, err := db.GetAt("key", start); !errors.Is(err, ErrVersionExpired) {
+		t.Error("Reads before the window should fail", err)
+	}
+	if versions, _ := db.History("key"); len(versions) != 1 || versions[0].Value != "v3" {
+		t.Error("Only the current version should be left", versions)
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.history.records != 1 || len(db.history.versions) != 1 {
+		t.Error("Open should rewrite the log without the expired versions", db.history.records, db.history.versions)
+	}
+	if versions, _ := db.History("gone"); len(versions) != 0 {
+		t.Error("An expired delete leaves nothing behind", versions)
+	}
+}
+
+func TestHistoryEncrypted(t *testing.T) {
+	path := clearVersionedDB("history_encrypted.db")
+	db, err := Open(path, WithEncryptionKey(testMasterKey), WithVersioning(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("key", "secret-old-value")
+	db.Put("key", "secret-new-value")
+	db.Close()
+
+	log, err := os.ReadFile(historyPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(log, []byte("secret-old-value")) {
+		t.Error("History of an encrypted database should be sealed")
+	}
+	if err := RotateKey(path, testMasterKey, otherMasterKey); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path, WithEncryptionKey(otherMasterKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if versions, err := db.History("key"); err != nil || len(versions) != 2 || versions[0].Value != "secret-old-value" {
+		t.Error("History should survive a key rotation", versions, err)
+	}
+}
+
+func TestHistoryCompactsWhileOpen(t *testing.T) {
+	path := clearVersionedDB("history_compact.db")
+	db, err := Open(path, WithVersioning(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5*historySweepRecords; i++ {
+		if err := db.Put("expiring", fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.history.records >= 2*historySweepRecords {
+		t.Error("Writes should rewrite the log without the expired versions", db.history.records)
+	}
+	versions, err := db.History("expiring")
+	if err != nil || len(versions) != 1 || versions[0].Value != fmt.Sprintf("value-%d", 5*historySweepRecords-1) {
+		t.Error("The current version should survive the rewrites", versions, err)
+	}
+	db.Close()
+
+	// Without a retention every version is kept through the sweeps
+	path = clearVersionedDB("history_compact.db")
+	db, err = Open(path, WithVersioning(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*historySweepRecords; i++ {
+		db.Put("kept", fmt.Sprintf("value-%d", i))
+	}
+	db.Close()
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	versions, err = db.History("kept")
+	if err != nil || len(versions) != 2*historySweepRecords {
+		t.Fatal("Every version should be kept", len(versions), err)
+	}
+	for i, v := range versions {
+		if v.Value != fmt.Sprintf("value-%d", i) {
+			t.Fatal("Versions should be read back from the log", i, v.Value)
+		}
+	}
+}
+
+func TestHistoryFailedWrite(t *testing.T) {
+	path := clearVersionedDB("history_failed.db")
+	db, err := Open(path, WithVersioning(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put("key", "v1")
+
+	// Writes to the tree fail on a handle opened read-only
+	bs := db.storage.blockService
+	file := bs.file
+	if bs.file, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DeleteRange("", ""); err == nil {
+		t.Fatal("The range delete from the tree should fail")
+	}
+	if err := db.Put("key", "v2"); err == nil {
+		t.Fatal("The write to the tree should fail")
+	}
+	if _, err := db.Delete("key"); err == nil {
+		t.Fatal("The delete from the tree should fail")
+	}
+	bs.file.Close()
+	bs.file = file
+
+	if versions, err := db.History("key"); err != nil || len(versions) != 1 || versions[0].Value != "v1" {
+		t.Error("Failed writes should leave no version behind", versions, err)
+	}
+}
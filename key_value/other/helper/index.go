@@ -0,0 +1,208 @@
+package helper
+
+import (
+	"errors"
+	"strings"
+)
+
+/**
+SECONDARY INDEXES
+	An index maps a key extracted from every pair of the main tree to the key of the pair.
+	It is an auxiliary tree kept in memory whose keys join the index key and the primary
+	key with a NUL byte, so one index key can point to many pairs and they stay sorted by
+	primary key:
+		"red\x00apple" -> "apple", "red\x00cherry" -> "cherry"
+	Extract functions are code and can't be stored in the file, so the index is built from
+	a scan of the database by CreateIndex and lives as long as the handle. Every write to
+	the main tree updates the indexes under the same lock, readers never see them differ.
+	Pairs of buckets are not indexed.
+*/
+
+var (
+	ErrIndexExists   = errors.New("index already exists")
+	ErrIndexNotFound = errors.New("index not found")
+	ErrIndexName     = errors.New("index name must not be empty")
+	// ErrIndexKey - Index keys can't hold a NUL byte, it separates them from primary keys
+	ErrIndexKey = errors.New("index key must not contain a NUL byte")
+)
+
+// indexSeparator - Joins the index key and the primary key in the keys of an index tree
+const indexSeparator = "\x00"
+
+// IndexFunc - Extracts the index key of a pair, returning false leaves the pair out of the
+// index. It is called with the database locked and must not use it.
+type IndexFunc func(key string, value string) (string, bool)
+
+type index struct {
+	extract IndexFunc
+	tree    *btree
+}
+
+func (idx *index) add(key string, value string) error {
+	if indexKey, ok := idx.extract(key, value); ok {
+		return idx.tree.insert(NewPair(indexKey+indexSeparator+key, key))
+	}
+	return nil
+}
+
+func (idx *index) remove(key string, value string) error {
+	if indexKey, ok := idx.extract(key, value); ok {
+		_, err := idx.tree.delete(indexKey + indexSeparator + key)
+		return err
+	}
+	return nil
+}
+
+// checkIndexKeys - Refuses a pair whose index key can't be stored, before anything is
+// written. Must be called with mu held.
+func (db *DB) checkIndexKeys(key string, value string) error {
+	for _, idx := range db.indexes {
+		if indexKey, ok := idx.extract(key, value); ok && strings.Contains(indexKey, indexSeparator) {
+			return ErrIndexKey
+		}
+	}
+	return nil
+}
+
+// tracked - Whether writes to the tree have to keep indexes or the history in step
+func (db *DB) tracked(tree *btree) bool {
+	return tree == db.storage && (len(db.indexes) > 0 || db.history != nil)
+}
+
+// insertPair - Inserts the pair into the tree, keeping the indexes and the history in step
+// when it is the main tree. Must be called with mu held for writing.
+func (db *DB) insertPair(tree *btree, pair *Pairs) error {
+	if !db.tracked(tree) {
+		return tree.insert(pair)
+	}
+	// A missing key reads as an empty value, removing its entry is then a no-op
+	old, existed, err := tree.get(pair.Key)
+	if err != nil {
+		return err
+	}
+	if err := tree.insert(pair); err != nil {
+		return err
+	}
+	for _, idx := range db.indexes {
+		if err := idx.remove(pair.Key, old); err != nil {
+			return err
+		}
+		if err := idx.add(pair.Key, pair.Value); err != nil {
+			return err
+		}
+	}
+	// Logged once the tree holds the version, a failed insert leaves no version behind
+	if db.history != nil {
+		return db.history.write(pair.Key, old, existed, pair.Value, false)
+	}
+	return nil
+}
+
+// deletePair - Removes the key from the tree, keeping the indexes and the history in step
+// when it is the main tree. Must be called with mu held for writing.
+func (db *DB) deletePair(tree *btree, key string) (bool, error) {
+	if !db.tracked(tree) {
+		return tree.delete(key)
+	}
+	old, existed, err := tree.get(key)
+	if err != nil || !existed {
+		return false, err
+	}
+	found, err := tree.delete(key)
+	if err != nil || !found {
+		return found, err
+	}
+	for _, idx := range db.indexes {
+		if err := idx.remove(key, old); err != nil {
+			return true, err
+		}
+	}
+	if db.history != nil {
+		return true, db.history.write(key, old, true, "", true)
+	}
+	return true, nil
+}
+
+// CreateIndex - Index the pairs of the database by the key extract returns for them. The
+// index is built from the current content and kept up to date by every later write.
+func (db *DB) CreateIndex(name string, extract IndexFunc) error {
+	if name == "" {
+		return ErrIndexName
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if _, found := db.indexes[name]; found {
+		return ErrIndexExists
+	}
+	idx := &index{extract: extract, tree: newMemoryBtree()}
+	var addErr error
+	err := db.storage.scan("", "", func(pair *Pairs) bool {
+		if indexKey, ok := extract(pair.Key, pair.Value); ok && strings.Contains(indexKey, indexSeparator) {
+			addErr = ErrIndexKey
+			return false
+		}
+		addErr = idx.add(pair.Key, pair.Value)
+		return addErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if addErr != nil {
+		return addErr
+	}
+	if db.indexes == nil {
+		db.indexes = make(map[string]*index)
+	}
+	db.indexes[name] = idx
+	return nil
+}
+
+// DropIndex - Stop maintaining the index and release it
+func (db *DB) DropIndex(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if _, found := db.indexes[name]; !found {
+		return ErrIndexNotFound
+	}
+	delete(db.indexes, name)
+	return nil
+}
+
+// LookupIndex - Keys of the pairs whose index key is value, in key order
+func (db *DB) LookupIndex(name string, value string) ([]string, error) {
+	keys := []string{}
+	err := db.scanIndex(name, value+indexSeparator, value+"\x01", func(indexKey string, key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// ScanIndex - Call fn with the index key and the key of the pairs whose index key is in
+// [start, end), ordered by index key then key, until fn returns false. An empty end scans
+// to the last index key. Like Scan, fn must not write to the database.
+func (db *DB) ScanIndex(name string, start string, end string, fn func(indexKey string, key string) bool) error {
+	return db.scanIndex(name, start, end, fn)
+}
+
+func (db *DB) scanIndex(name string, start string, end string, fn func(indexKey string, key string) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrClosed
+	}
+	idx, found := db.indexes[name]
+	if !found {
+		return ErrIndexNotFound
+	}
+	return idx.tree.scan(start, end, func(pair *Pairs) bool {
+		indexKey := pair.Key[:strings.Index(pair.Key, indexSeparator)]
+		return fn(indexKey, pair.Value)
+	})
+}
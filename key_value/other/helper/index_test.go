@@ -0,0 +1,150 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// colour - Indexes values of the form "colour:rest" by their colour
+func colour(key string, value string) (string, bool) {
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return "", false
+	}
+	return value[:i], true
+}
+
+func TestSecondaryIndex(t *testing.T) {
+	db, err := Open(clearNamedDB("index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put("apple", "red:fruit")
+	db.Put("banana", "yellow:fruit")
+	db.Put("plain", "no colour")
+
+	if err := db.CreateIndex("colour", colour); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex("colour", colour); err != ErrIndexExists {
+		t.Error("An index name should only be used once", err)
+	}
+	db.Put("cherry", "red:fruit")
+	db.Put("brick", "red:stone")
+	// Changing the value moves the key to its new index key
+	db.Put("banana", "green:unripe")
+	db.Delete("brick")
+
+	keys, err := db.LookupIndex("colour", "red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[apple cherry]" {
+		t.Error("Unexpected lookup", keys)
+	}
+	if keys, _ := db.LookupIndex("colour", "yellow"); len(keys) != 0 {
+		t.Error("Old index key should be gone", keys)
+	}
+
+	batch := &Batch{}
+	batch.Put("lemon", "yellow:fruit")
+	batch.Delete("apple")
+	if err := db.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	err = db.ScanIndex("colour", "", "s", func(indexKey string, key string) bool {
+		entries = append(entries, indexKey+"="+key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(entries) != "[green=banana red=cherry]" {
+		t.Error("Unexpected index range", entries)
+	}
+
+	if err := db.Put("bad", "a\x00b:x"); err != ErrIndexKey {
+		t.Error("Index keys with a NUL byte should be refused", err)
+	}
+	if _, found, _ := db.Get("bad"); found {
+		t.Error("A refused write should not reach the database")
+	}
+	if err := db.DropIndex("colour"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LookupIndex("colour", "red"); err != ErrIndexNotFound {
+		t.Error("Dropped index should be gone", err)
+	}
+}
+
+func TestEmptyValuesRefused(t *testing.T) {
+	db, err := Open(clearNamedDB("index_empty.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.CreateIndex("colour", colour); err != nil {
+		t.Fatal(err)
+	}
+	// An empty value reads as missing, Delete couldn't find it to remove it
+	if err := db.Put("ghost", ""); err != ErrEmptyValue {
+		t.Error("An empty value should be refused", err)
+	}
+	batch := &Batch{}
+	batch.Put("apple", "red:fruit")
+	batch.Put("ghost", "")
+	if err := db.Write(batch); err != ErrEmptyValue {
+		t.Error("A batch with an empty value should be refused", err)
+	}
+	if count, err := db.Count("", ""); err != nil || count != 0 {
+		t.Error("A refused write should store nothing", count, err)
+	}
+}
+
+func TestIndexWriteErrors(t *testing.T) {
+	db, err := Open(clearNamedDB("index_errors.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("apple", "red:fruit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex("colour", colour); err != nil {
+		t.Fatal(err)
+	}
+
+	// An index tree backed by a read-only file holding the entries fails every write made
+	// to it
+	path := clearNamedDB("index_errors_ro.db")
+	other, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"apple", "cherry"} {
+		if err := other.Put("red"+indexSeparator+key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other.Close()
+	readOnly, err := Open(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	db.indexes["colour"].tree = readOnly.storage
+
+	if err := db.Put("cherry", "red:fruit"); !errors.Is(err, ErrReadOnly) {
+		t.Error("A failed index insert should fail the put", err)
+	}
+	if _, err := db.Delete("apple"); !errors.Is(err, ErrReadOnly) {
+		t.Error("A failed index delete should fail the delete", err)
+	}
+	if _, err := db.DeleteRange("", ""); !errors.Is(err, ErrReadOnly) {
+		t.Error("A failed index delete should fail the range delete", err)
+	}
+}
@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// DefaultLockTimeout - How long Open waits for another process to release the file
+const DefaultLockTimeout = time.Second
+
+const lockRetryInterval = 10 * time.Millisecond
+
+var (
+	ErrDatabaseLocked = errors.New("database file is locked by another process")
+	ErrReadOnly       = errors.New("database was opened read-only")
+)
+
+/**
+FILE LOCKING
+	Open takes an advisory flock on the database file before reading anything from it. A
+	writer takes it exclusively, read-only opens share it, so any number of readers can
+	open a file nobody writes to. The lock belongs to the open file, closing the file
+	releases it, which also means two handles in one process exclude each other as well.
+	RotateKey renames a new file over the path while holding the lock on the old one, so an
+	opener that was waiting for that lock checks the path still names the file it locked
+	and opens the path again when it doesn't.
+*/
+
+// LockFile - Locks the file, retrying until the timeout runs out
+func LockFile(file *os.File, exclusive bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(file, exclusive)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return ErrDatabaseLocked
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// openLocked - Opens and locks the file at path, opening it again when it was replaced
+// while waiting for the lock
+func openLocked(path string, flag int, exclusive bool, timeout time.Duration) (*os.File, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		file, err := os.OpenFile(path, flag, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if err := LockFile(file, exclusive, time.Until(deadline)); err != nil {
+			file.Close()
+			return nil, err
+		}
+		locked, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(locked, current) {
+			return file, nil
+		}
+		file.Close()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package helper
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestShouldLockDatabaseForWriters(t *testing.T) {
+	path := clearNamedDB("lock.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = Open(path, WithLockTimeout(50*time.Millisecond))
+	if !errors.Is(err, ErrDatabaseLocked) {
+		t.Error("Second writer should be locked out", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Should wait for the lock timeout before giving up")
+	}
+	if _, err := Open(path, WithReadOnly(), WithLockTimeout(0)); !errors.Is(err, ErrDatabaseLocked) {
+		t.Error("Readers should be locked out by a writer", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path, WithLockTimeout(0))
+	if err != nil {
+		t.Error("Lock should be released on close", err)
+	}
+	db.Close()
+}
+
+func TestShouldShareLockBetweenReaders(t *testing.T) {
+	path := clearNamedDB("lock.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("hola", "amigos"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	reader1, err := Open(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader1.Close()
+	reader2, err := Open(path, WithReadOnly(), WithLockTimeout(0))
+	if err != nil {
+		t.Fatal("Readers should share the lock", err)
+	}
+	defer reader2.Close()
+
+	value, found, err := reader2.Get("hola")
+	if err != nil || !found || value != "amigos" {
+		t.Error("Read-only handle should read", value, err)
+	}
+	if err := reader1.Put("foo", "bar"); !errors.Is(err, ErrReadOnly) {
+		t.Error("Read-only handle should refuse writes", err)
+	}
+	if _, err := Open(path, WithLockTimeout(0)); !errors.Is(err, ErrDatabaseLocked) {
+		t.Error("Writer should wait for the readers", err)
+	}
+}
+
+func TestShouldNotOpenMissingFileReadOnly(t *testing.T) {
+	path := clearNamedDB("lock.db")
+	if _, err := Open(path, WithReadOnly()); err == nil {
+		t.Error("Read-only open should not create the file")
+	}
+}
+
+func TestShouldOpenFileRenamedOverLockedOne(t *testing.T) {
+	path := clearNamedDB("lock.db")
+	replacement := clearNamedDB("lock_replacement.db")
+	db, err := Open(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("file", "replacement")
+	db.Close()
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("file", "original")
+
+	// The second open waits on the original file, which is replaced before it is released
+	opened := make(chan *DB)
+	go func() {
+		db, err := Open(path, WithLockTimeout(time.Second))
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- db
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db = <-opened
+	if db == nil {
+		return
+	}
+	defer db.Close()
+	if value, _, err := db.Get("file"); err != nil || value != "replacement" {
+		t.Error("The waiting open should read the file now at the path", value, err)
+	}
+}
@@ -0,0 +1,289 @@
+package helper
+
+import (
+	"fmt"
+	"sort"
+)
+
+/**
+IN-MEMORY NODES
+	MemoryNode implements node for trees that never touch a file, children are held by
+	pointer instead of block id. The algorithms are the ones of DiskNode, with the same
+	MaxLeafSize and minimum fill:
+		1. Insertion splits a node that overflows around its middle element, which moves up
+		   into the parent, a split root gets a new root above it
+		2. Deletion replaces an internal element by its predecessor and rebalances children
+		   that drop below the minimum by borrowing from a sibling or merging with it
+	Nodes are never shared, a split builds two new nodes and the old one is dropped. Every
+	node counts the pairs of its subtree like the pages of a file do, see counts.go.
+*/
+
+// MemoryNode - Node of a tree kept in memory
+type MemoryNode struct {
+	keys     []*Pairs
+	children []*MemoryNode
+	// count - Pairs in the subtree of the node
+	count int
+}
+
+func (n *MemoryNode) isLeaf() bool {
+	return len(n.children) == 0
+}
+
+// search - Index of the first element not before the key and whether it is the key
+func (n *MemoryNode) search(key string) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool { return n.keys[i].Key >= key })
+	return i, i < len(n.keys) && n.keys[i].Key == key
+}
+
+func memoryMinKeys() int {
+	return MaxLeafSize / 2
+}
+
+// split - Splits the node around its middle element into two new nodes
+func (n *MemoryNode) split() (*Pairs, *MemoryNode, *MemoryNode) {
+	mid := len(n.keys) / 2
+	left := &MemoryNode{keys: append([]*Pairs(nil), n.keys[:mid]...)}
+	right := &MemoryNode{keys: append([]*Pairs(nil), n.keys[mid+1:]...)}
+	if !n.isLeaf() {
+		left.children = append([]*MemoryNode(nil), n.children[:mid+1]...)
+		right.children = append([]*MemoryNode(nil), n.children[mid+1:]...)
+	}
+	left.recount()
+	right.recount()
+	return n.keys[mid], left, right
+}
+
+// recount - Sets the count of the node from its elements and the counts of its children
+func (n *MemoryNode) recount() {
+	n.count = len(n.keys)
+	for _, child := range n.children {
+		n.count += child.count
+	}
+}
+
+// insert - Inserts or replaces the pair in the subtree, returning the middle element and
+// halves of the node when it had to split and whether the key is new
+func (n *MemoryNode) insert(value *Pairs) (*Pairs, *MemoryNode, *MemoryNode, bool) {
+	i, found := n.search(value.Key)
+	if found {
+		n.keys[i] = value
+		return nil, nil, nil, false
+	}
+	if n.isLeaf() {
+		n.keys = append(n.keys, nil)
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = value
+	} else {
+		middle, left, right, added := n.children[i].insert(value)
+		if !added {
+			return nil, nil, nil, false
+		}
+		if middle == nil {
+			n.count++
+			return nil, nil, nil, true
+		}
+		n.keys = append(n.keys, nil)
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = middle
+		n.children = append(n.children, nil)
+		copy(n.children[i+2:], n.children[i+1:])
+		n.children[i], n.children[i+1] = left, right
+	}
+	n.count++
+	if len(n.keys) <= MaxLeafSize {
+		return nil, nil, nil, true
+	}
+	middle, left, right := n.split()
+	return middle, left, right, true
+}
+
+func (n *MemoryNode) insertPair(value *Pairs, bt *btree) error {
+	middle, left, right, _ := n.insert(value)
+	if middle != nil {
+		root := &MemoryNode{keys: []*Pairs{middle}, children: []*MemoryNode{left, right}}
+		root.recount()
+		bt.setRootNode(root)
+	}
+	return nil
+}
+
+func (n *MemoryNode) getValue(key string) (string, error) {
+	for {
+		i, found := n.search(key)
+		if found {
+			return n.keys[i].Value, nil
+		}
+		if n.isLeaf() {
+			return "", nil
+		}
+		n = n.children[i]
+	}
+}
+
+func (n *MemoryNode) deletePair(key string, bt *btree) (bool, error) {
+	found := n.delete(key)
+	if found && bt.isRootNode(n) && !n.isLeaf() && len(n.keys) == 0 {
+		// The root has a single child left, which becomes the root
+		bt.setRootNode(n.children[0])
+	}
+	return found, nil
+}
+
+func (n *MemoryNode) delete(key string) bool {
+	i, found := n.search(key)
+	if n.isLeaf() {
+		if found {
+			n.keys = append(n.keys[:i], n.keys[i+1:]...)
+			n.count--
+		}
+		return found
+	}
+	if found {
+		n.keys[i] = n.children[i].removeMax()
+	} else if !n.children[i].delete(key) {
+		return false
+	}
+	n.count--
+	if len(n.children[i].keys) < memoryMinKeys() {
+		n.rebalanceChild(i)
+	}
+	return true
+}
+
+// removeMax - Removes and returns the largest element of the subtree
+func (n *MemoryNode) removeMax() *Pairs {
+	n.count--
+	if n.isLeaf() {
+		last := n.keys[len(n.keys)-1]
+		n.keys = n.keys[:len(n.keys)-1]
+		return last
+	}
+	i := len(n.children) - 1
+	last := n.children[i].removeMax()
+	if len(n.children[i].keys) < memoryMinKeys() {
+		n.rebalanceChild(i)
+	}
+	return last
+}
+
+// rebalanceChild - Brings the child at index back to the minimum number of elements
+func (n *MemoryNode) rebalanceChild(i int) {
+	child := n.children[i]
+	if i > 0 && len(n.children[i-1].keys) > memoryMinKeys() {
+		// Rotate right through the separator
+		left := n.children[i-1]
+		child.keys = append([]*Pairs{n.keys[i-1]}, child.keys...)
+		n.keys[i-1] = left.keys[len(left.keys)-1]
+		left.keys = left.keys[:len(left.keys)-1]
+		moved := 1
+		if !left.isLeaf() {
+			child.children = append([]*MemoryNode{left.children[len(left.children)-1]}, child.children...)
+			left.children = left.children[:len(left.children)-1]
+			moved += child.children[0].count
+		}
+		left.count -= moved
+		child.count += moved
+		return
+	}
+	if i < len(n.children)-1 && len(n.children[i+1].keys) > memoryMinKeys() {
+		// Rotate left, the mirror image of the above
+		right := n.children[i+1]
+		child.keys = append(child.keys, n.keys[i])
+		n.keys[i] = right.keys[0]
+		right.keys = right.keys[1:]
+		moved := 1
+		if !right.isLeaf() {
+			child.children = append(child.children, right.children[0])
+			right.children = right.children[1:]
+			moved += child.children[len(child.children)-1].count
+		}
+		right.count -= moved
+		child.count += moved
+		return
+	}
+	// Neither sibling can spare an element, merge with one of them
+	if i > 0 {
+		i--
+	}
+	left, right := n.children[i], n.children[i+1]
+	left.keys = append(append(left.keys, n.keys[i]), right.keys...)
+	left.children = append(left.children, right.children...)
+	left.count += 1 + right.count
+	n.keys = append(n.keys[:i], n.keys[i+1:]...)
+	n.children = append(n.children[:i+1], n.children[i+2:]...)
+}
+
+// scanRange - Calls fn for the pairs of the subtree in [start, end), see scan.go. The
+// children before the first element not before start are skipped altogether.
+func (n *MemoryNode) scanRange(start string, end string, fn func(pair *Pairs) bool) bool {
+	i, _ := n.search(start)
+	for ; i < len(n.keys); i++ {
+		if !n.isLeaf() && !n.children[i].scanRange(start, end, fn) {
+			return false
+		}
+		if end != "" && n.keys[i].Key >= end {
+			return false
+		}
+		if !fn(n.keys[i]) {
+			return false
+		}
+	}
+	if n.isLeaf() {
+		return true
+	}
+	return n.children[len(n.keys)].scanRange(start, end, fn)
+}
+
+func (n *MemoryNode) scan(start string, end string, fn func(pair *Pairs) bool) error {
+	n.scanRange(start, end, fn)
+	return nil
+}
+
+func (n *MemoryNode) printTree(level int) error {
+	currentLevel := level
+	if level == 0 {
+		currentLevel = 1
+	}
+	fmt.Println("Printing Node")
+	fmt.Println("--------------")
+	for _, pair := range n.keys {
+		fmt.Println(pair)
+	}
+	fmt.Println("**********************")
+	for i, child := range n.children {
+		fmt.Println("Printing ", i+1, " th child of level : ", currentLevel)
+		child.printTree(currentLevel + 1)
+	}
+	return nil
+}
+
+// addStats - Adds the nodes and pairs of the subtree to the statistics and the fill of
+// its nodes to fill, and of its leaves to leafFill. Nodes are counted as pages. Returns the
+// height of the subtree.
+func (n *MemoryNode) addStats(stats *Stats, fill *float64, leafFill *float64) int {
+	height := 0
+	level := []*MemoryNode{n}
+	for len(level) > 0 {
+		height++
+		var next []*MemoryNode
+		for _, node := range level {
+			nodeFill := float64(len(node.keys)) / float64(MaxLeafSize)
+			if node.isLeaf() {
+				stats.LeafPages++
+				*leafFill += nodeFill
+			} else {
+				stats.InternalPages++
+			}
+			stats.Keys += int64(len(node.keys))
+			*fill += nodeFill
+			for _, pair := range node.keys {
+				stats.KeyBytes += int64(pair.KeyLen)
+				stats.ValueBytes += int64(len(pair.Value))
+			}
+			next = append(next, node.children...)
+		}
+		level = next
+	}
+	return height
+}
@@ -0,0 +1,105 @@
+package helper
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestMemoryPutGetDelete(t *testing.T) {
+	db := OpenMemory()
+	defer db.Close()
+	random := rand.New(rand.NewSource(3))
+	total := 3000
+	for _, i := range random.Perm(total) {
+		if err := db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Put("key-0042", "replaced")
+	if value, _, _ := db.Get("key-0042"); value != "replaced" {
+		t.Error("Put should replace the stored pair", value)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != int64(total) || stats.Height < 3 {
+		t.Error("Tree should hold every key over several levels", stats.Keys, stats.Height)
+	}
+
+	deleted := make(map[int]bool)
+	for n, i := range random.Perm(total) {
+		if n%4 == 0 {
+			continue
+		}
+		found, err := db.Delete(fmt.Sprintf("key-%04d", i))
+		if err != nil || !found {
+			t.Fatal("Delete should find the key", i, err)
+		}
+		deleted[i] = true
+	}
+	var keys []string
+	db.Scan("", "", func(key string, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != total-len(deleted) {
+		t.Fatal("Scan should return the remaining keys", len(keys))
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatal("Scan should return keys in order", keys[i-1], keys[i])
+		}
+	}
+	for i := 0; i < total; i++ {
+		_, found, _ := db.Get(fmt.Sprintf("key-%04d", i))
+		if found == deleted[i] {
+			t.Fatal("Get disagrees with the deletes", i, found)
+		}
+	}
+
+	for i := 0; i < total; i++ {
+		db.Delete(fmt.Sprintf("key-%04d", i))
+	}
+	if stats, _ := db.Stats(); stats.Keys != 0 || stats.Height != 1 {
+		t.Error("Emptied tree should shrink back to a leaf", stats)
+	}
+	if _, err := db.Check(); err != ErrInMemory {
+		t.Error("Check needs a file", err)
+	}
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	db := OpenMemory()
+	for i := 0; i < 1000; i++ {
+		db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i))
+	}
+	path := clearNamedDB("snapshot.db")
+	if err := db.Snapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Snapshot(path); err == nil {
+		t.Error("Snapshot should not overwrite a file")
+	}
+	db.Close()
+	if _, _, err := db.Get("key-0001"); err != ErrClosed {
+		t.Error("A closed database should refuse reads", err)
+	}
+
+	disk, err := Open(path, WithMustExist())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	report, err := disk.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || report.Keys != 1000 {
+		t.Fatal("Snapshot should be a healthy file with every key", report.Keys, report.Problems)
+	}
+	if value, _, _ := disk.Get("key-0500"); value != "value-500" {
+		t.Error("Snapshot lost a pair", value)
+	}
+}
@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// mmapGrowth - The mapping is extended in steps of this size so a growing file doesn't
+// need a remap for every new block
+const mmapGrowth = 256 * BlockSize
+
+var ErrMmapUnsupported = errors.New("memory mapped reads are not supported on this platform")
+
+// mmapReader - Read only shared mapping of the database file. Writes still go through the
+// file, the mapping sees them through the page cache, and it is remapped when a read
+// reaches past its end because the file grew.
+type mmapReader struct {
+	mu   sync.RWMutex
+	file *os.File
+	data []byte
+	// size - File size when last checked, the mapping is rounded up past the end of the
+	// file and touching pages beyond it faults, so reads are checked against it
+	size int64
+}
+
+func newMmapReader(file *os.File) (*mmapReader, error) {
+	m := &mmapReader{file: file}
+	if err := m.remap(0); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// remap - Maps the file again when it has grown past the current mapping. Must be called
+// with the write lock held.
+func (m *mmapReader) remap(minSize int64) error {
+	fi, err := m.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if size < minSize {
+		return errors.New("read past the end of the database file")
+	}
+	if size <= int64(len(m.data)) || size == 0 {
+		m.size = size
+		return nil
+	}
+	if m.data != nil {
+		if err := munmapFile(m.data); err != nil {
+			return err
+		}
+		m.data = nil
+	}
+	length := (size + mmapGrowth - 1) / mmapGrowth * mmapGrowth
+	data, err := mmapFile(m.file, length)
+	if err != nil {
+		return err
+	}
+	m.data = data
+	m.size = size
+	return nil
+}
+
+// read - Calls fn with the mapped bytes at offset. The bytes are only valid while fn runs.
+func (m *mmapReader) read(offset int64, length int, fn func([]byte) error) error {
+	end := offset + int64(length)
+	m.mu.RLock()
+	if end <= m.size {
+		defer m.mu.RUnlock()
+		return fn(m.data[offset:end])
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.remap(end); err != nil {
+		return err
+	}
+	return fn(m.data[offset:end])
+}
+
+func (m *mmapReader) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return nil
+	}
+	err := munmapFile(m.data)
+	m.data = nil
+	m.size = 0
+	return err
+}
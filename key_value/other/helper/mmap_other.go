@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package helper
+
+import "os"
+
+const mmapSupported = false
+
+func mmapFile(file *os.File, length int64) ([]byte, error) {
+	return nil, ErrMmapUnsupported
+}
+
+func munmapFile(data []byte) error {
+	return ErrMmapUnsupported
+}
@@ -0,0 +1,90 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestOpenWithMmap(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap not supported on this platform")
+	}
+	path := clearNamedDB("mmap.db")
+	db, err := Open(path, WithMmap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	totalElements := 3000
+	for i := 1; i <= totalElements; i++ {
+		if err := db.Put(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= totalElements; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || value != fmt.Sprintf("value-%d", i) {
+			t.Error("Value should be found ", i)
+		}
+	}
+	if _, found, _ := db.Get("missing"); found {
+		t.Error("Value should not be found")
+	}
+}
+
+func TestMmapReaderRemapsWhenFileGrows(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap not supported on this platform")
+	}
+	file, err := os.OpenFile(clearNamedDB("mmap.db"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteAt([]byte("first"), 0)
+
+	m, err := newMmapReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+
+	offset := int64(mmapGrowth + 10)
+	file.WriteAt([]byte("second"), offset)
+	err = m.read(offset, len("second"), func(b []byte) error {
+		if string(b) != "second" {
+			t.Error("Should read bytes written after the file grew", string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(m.data)) < offset {
+		t.Error("Mapping should have grown", len(m.data))
+	}
+	if err := m.read(offset+100, 1, func([]byte) error { return nil }); err == nil {
+		t.Error("Should not read past the end of the file")
+	}
+}
+
+func TestMmapWithEncryptedPages(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap not supported on this platform")
+	}
+	path := clearNamedDB("encrypted.db")
+	fillEncryptedDB(t, path)
+	db, err := Open(path, WithEncryptionKey(testMasterKey), WithMmap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, found, err := db.Get("key-7")
+	if err != nil || !found || value != "secret-value-7" {
+		t.Error("Should decode envelopes read through the mapping", value, err)
+	}
+}
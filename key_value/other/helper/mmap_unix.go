@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package helper
+
+import (
+	"os"
+	"syscall"
+)
+
+const mmapSupported = true
+
+func mmapFile(file *os.File, length int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(length), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,165 @@
+package helper
+
+/**
+NEAREST KEY LOOKUPS
+	Floor and ceiling walk a single path from the root like a point lookup. In every node
+	find the first element after (floor) or not before (ceiling) the key:
+		1. An element equal to the key is the answer
+		2. Otherwise remember the element of the node closest to the key on the wanted side,
+		   the one before that position for floor and the one at it for ceiling
+		3. Descend into the child between the two, whatever it holds is closer still
+	The last element remembered is the answer, none means there is no such key. The
+	smallest key is the ceiling of "", the largest is found down the rightmost children.
+*/
+
+// floor - The pair with the largest key not after the given one, nil when there is none
+func (n *DiskNode) floor(key string) (*Pairs, error) {
+	var closest *Pairs
+	for {
+		i := n.childIndexForKey(key)
+		if i > 0 {
+			closest = n.keys[i-1]
+			if closest.Key == key {
+				return closest, nil
+			}
+		}
+		if n.isLeaf() {
+			return closest, nil
+		}
+		if n.blockService.searchesPages() {
+			return n.blockService.floorInPages(n.childrenBlockIDs[i], key, closest)
+		}
+		child, err := n.getChildAtIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		n = child
+	}
+}
+
+// ceiling - The pair with the smallest key not before the given one, nil when there is none
+func (n *DiskNode) ceiling(key string) (*Pairs, error) {
+	var closest *Pairs
+	for {
+		i := 0
+		for i < len(n.keys) && n.keys[i].Key < key {
+			i++
+		}
+		if i < len(n.keys) {
+			closest = n.keys[i]
+			if closest.Key == key {
+				return closest, nil
+			}
+		}
+		if n.isLeaf() {
+			return closest, nil
+		}
+		child, err := n.getChildAtIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		n = child
+	}
+}
+
+// last - The pair with the largest key of the subtree, nil when it is empty
+func (n *DiskNode) last() (*Pairs, error) {
+	for !n.isLeaf() {
+		child, err := n.getLastChildNode()
+		if err != nil {
+			return nil, err
+		}
+		n = child
+	}
+	if len(n.keys) == 0 {
+		return nil, nil
+	}
+	return n.keys[len(n.keys)-1], nil
+}
+
+func (n *MemoryNode) floor(key string) (*Pairs, error) {
+	var closest *Pairs
+	for {
+		i, found := n.search(key)
+		if found {
+			return n.keys[i], nil
+		}
+		if i > 0 {
+			closest = n.keys[i-1]
+		}
+		if n.isLeaf() {
+			return closest, nil
+		}
+		n = n.children[i]
+	}
+}
+
+func (n *MemoryNode) ceiling(key string) (*Pairs, error) {
+	var closest *Pairs
+	for {
+		i, found := n.search(key)
+		if found {
+			return n.keys[i], nil
+		}
+		if i < len(n.keys) {
+			closest = n.keys[i]
+		}
+		if n.isLeaf() {
+			return closest, nil
+		}
+		n = n.children[i]
+	}
+}
+
+func (n *MemoryNode) last() (*Pairs, error) {
+	for !n.isLeaf() {
+		n = n.children[len(n.children)-1]
+	}
+	if len(n.keys) == 0 {
+		return nil, nil
+	}
+	return n.keys[len(n.keys)-1], nil
+}
+
+// Floor - The pair with the largest key at or before key, found is false when every key
+// sorts after it
+func (db *DB) Floor(key string) (string, string, bool, error) {
+	return db.nearest("", func(tree *btree) (*Pairs, error) { return tree.root.floor(key) })
+}
+
+// Ceiling - The pair with the smallest key at or after key, found is false when every key
+// sorts before it
+func (db *DB) Ceiling(key string) (string, string, bool, error) {
+	return db.nearest("", func(tree *btree) (*Pairs, error) { return tree.root.ceiling(key) })
+}
+
+// Min - The pair with the smallest key, found is false when the database is empty
+func (db *DB) Min() (string, string, bool, error) {
+	return db.nearest("", func(tree *btree) (*Pairs, error) { return tree.root.ceiling("") })
+}
+
+// Max - The pair with the largest key, found is false when the database is empty
+func (db *DB) Max() (string, string, bool, error) {
+	return db.nearest("", func(tree *btree) (*Pairs, error) { return tree.root.last() })
+}
+
+// nearest - Runs a lookup of a single pair on the tree of the bucket under the read lock
+func (db *DB) nearest(bucket string, lookup func(tree *btree) (*Pairs, error)) (string, string, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return "", "", false, ErrClosed
+	}
+	tree, err := db.tree(bucket)
+	if err != nil {
+		return "", "", false, err
+	}
+	pair, err := lookup(tree)
+	if err == nil {
+		pair, err = tree.resolve(pair)
+	}
+	if err != nil || pair == nil {
+		return "", "", false, err
+	}
+	return pair.Key, pair.Value, true, nil
+}
@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFloorCeiling(t *testing.T) {
+	for _, db := range []*DB{OpenMemory(), nil} {
+		if db == nil {
+			var err error
+			if db, err = Open(clearNamedDB("nearest.db")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, found, err := db.Min(); found || err != nil {
+			t.Error("An empty database has no smallest key", err)
+		}
+		if _, _, found, _ := db.Floor("key"); found {
+			t.Error("An empty database has no floor")
+		}
+		// Only even keys are stored, odd ones fall in the gaps
+		for i := 0; i < 2000; i += 2 {
+			if err := db.Put(fmt.Sprintf("ts-%05d", i), fmt.Sprintf("value-%d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 1; i < 1999; i += 2 {
+			key, value, found, err := db.Floor(fmt.Sprintf("ts-%05d", i))
+			if err != nil || !found || key != fmt.Sprintf("ts-%05d", i-1) || value != fmt.Sprintf("value-%d", i-1) {
+				t.Fatal("Floor should return the previous key", i, key, err)
+			}
+			key, _, found, err = db.Ceiling(fmt.Sprintf("ts-%05d", i))
+			if err != nil || !found || key != fmt.Sprintf("ts-%05d", i+1) {
+				t.Fatal("Ceiling should return the next key", i, key, err)
+			}
+			if key, _, _, _ := db.Floor(fmt.Sprintf("ts-%05d", i+1)); key != fmt.Sprintf("ts-%05d", i+1) {
+				t.Fatal("Floor of a stored key is the key itself", i+1, key)
+			}
+		}
+		if _, _, found, _ := db.Floor("ts-"); found {
+			t.Error("Nothing sorts before the first key")
+		}
+		if _, _, found, _ := db.Ceiling("ts-99999"); found {
+			t.Error("Nothing sorts after the last key")
+		}
+		if key, _, _, _ := db.Min(); key != "ts-00000" {
+			t.Error("Min should return the first key", key)
+		}
+		if key, _, _, _ := db.Max(); key != "ts-01998" {
+			t.Error("Max should return the last key", key)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,146 @@
+package helper
+
+import (
+	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/bloom"
+)
+
+// Option - Configures how Open prepares the database file
+type Option func(*options)
+
+type options struct {
+	codec     Codec
+	masterKey []byte
+	mmap      bool
+	cacheSize int
+
+	syncMode     SyncMode
+	syncInterval time.Duration
+
+	readOnly    bool
+	mustExist   bool
+	lockTimeout time.Duration
+
+	versioning bool
+	retention  time.Duration
+
+	bloomBitsPerKey int
+	valueThreshold  int
+}
+
+func defaultOptions() *options {
+	return &options{
+		codec:        CodecNone,
+		cacheSize:    DefaultCacheSize,
+		syncMode:     SyncNone,
+		syncInterval: DefaultSyncInterval,
+		lockTimeout:  DefaultLockTimeout,
+
+		bloomBitsPerKey: bloom.DefaultBitsPerKey,
+		valueThreshold:  maxValueLength,
+	}
+}
+
+func buildOptions(opts []Option) *options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCompression - Compress every page of a newly created file with the given codec.
+// Existing files keep the codec recorded in their header.
+func WithCompression(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithEncryptionKey - Encrypt the pages of a newly created file, and open encrypted files,
+// with the given AES master key (16, 24 or 32 bytes). Existing plaintext files stay
+// plaintext until they are converted with RotateKey.
+func WithEncryptionKey(masterKey []byte) Option {
+	return func(o *options) {
+		o.masterKey = masterKey
+	}
+}
+
+// WithMmap - Serve block reads from a read only memory mapping of the file instead of
+// reading every block into a fresh buffer, useful for read heavy databases
+func WithMmap() Option {
+	return func(o *options) {
+		o.mmap = true
+	}
+}
+
+// WithCacheSize - Keep up to blocks decoded blocks in memory, 0 disables the cache
+func WithCacheSize(blocks int) Option {
+	return func(o *options) {
+		o.cacheSize = blocks
+	}
+}
+
+// WithSync - Choose when writes are flushed to stable storage, the interval is only used
+// by SyncInterval and is the longest a write waits for its group commit
+func WithSync(mode SyncMode, interval time.Duration) Option {
+	return func(o *options) {
+		o.syncMode = mode
+		o.syncInterval = interval
+	}
+}
+
+// WithReadOnly - Open an existing file for reading only. The file lock is shared with other
+// readers and every write returns ErrReadOnly. Read-only opens never create the file.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+// WithLockTimeout - How long Open waits for a conflicting lock on the file before giving up
+// with ErrDatabaseLocked
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = timeout
+	}
+}
+
+// WithMustExist - Fail with an error wrapping os.ErrNotExist instead of creating the file
+// when it is missing
+func WithMustExist() Option {
+	return func(o *options) {
+		o.mustExist = true
+	}
+}
+
+// WithVersioning - Keep the values overwritten or deleted in the main tree for the given
+// retention, so they can be read back with GetAt and History. A retention of 0 keeps them
+// forever, the history log then grows with every write while memory only holds where each
+// version sits in it. A database opened once with versioning stays versioned, later opens
+// without the option keep the retention it was last opened with. See history.go.
+func WithVersioning(retention time.Duration) Option {
+	return func(o *options) {
+		o.versioning = true
+		o.retention = retention
+	}
+}
+
+// WithBloomBitsPerKey - Size of the bloom filter lookups consult before walking the tree,
+// more bits give fewer false positives. It applies when the filter is rebuilt, 0 turns the
+// filter off. See filter.go.
+func WithBloomBitsPerKey(bits int) Option {
+	return func(o *options) {
+		o.bloomBitsPerKey = bits
+	}
+}
+
+// WithValueLog - Write values longer than threshold bytes to the value log and keep only a
+// pointer to them in the pages. Values that don't fit in a page always go to the log, the
+// threshold can only be lowered. See vlog.go.
+func WithValueLog(threshold int) Option {
+	return func(o *options) {
+		o.valueThreshold = threshold
+	}
+}
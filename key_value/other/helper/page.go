@@ -0,0 +1,120 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/**
+PAGE ENVELOPE
+	When a file uses a codec or encryption every block slot is wrapped in a small envelope,
+	the slot keeps its BlockSize so block ids still map directly to offsets. A compressed
+	page leaves the rest of its slot zero, the file takes as much space as without a codec.
+
+	0     flags (pageCompressed, pageEncrypted)
+	1:5   payload length
+	5:    payload, the rest of the slot is zero
+
+	Trailing zero bytes of a page are never stored, decoding pads the page back to BlockSize.
+	An encrypted payload is nonce followed by the AES-GCM sealed (possibly compressed) page,
+	with the block id as additional data so a page copied to another slot fails to open.
+*/
+
+const (
+	pageCompressed = 1 << 0
+	pageEncrypted  = 1 << 1
+)
+
+const pageEnvelopeSize = 5
+
+var errCorruptPage = errors.New("corrupt page envelope")
+
+// pageFormat - How raw pages are transformed on their way to and from the disk
+type pageFormat struct {
+	codec  Codec
+	cipher cipher.AEAD
+}
+
+func (f pageFormat) raw() bool {
+	return f.codec == CodecNone && f.cipher == nil
+}
+
+// encodePage - Wraps a raw page in the envelope described by the format
+func (f pageFormat) encodePage(blockID uint64, page []byte) ([]byte, error) {
+	if f.raw() {
+		return page, nil
+	}
+	payload := bytes.TrimRight(page, "\x00")
+	var flags byte
+
+	if f.codec != CodecNone {
+		compressed, err := compress(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(payload) {
+			payload = compressed
+			flags |= pageCompressed
+		}
+	}
+	if f.cipher != nil {
+		sealed, err := sealPayload(f.cipher, payload, Uint64ToBytes(blockID))
+		if err != nil {
+			return nil, err
+		}
+		payload = sealed
+		flags |= pageEncrypted
+	}
+	if pageEnvelopeSize+len(payload) > BlockSize {
+		return nil, fmt.Errorf("page payload of %d bytes does not fit in a block", len(payload))
+	}
+
+	slot := make([]byte, BlockSize)
+	slot[0] = flags
+	binary.LittleEndian.PutUint32(slot[1:], uint32(len(payload)))
+	copy(slot[pageEnvelopeSize:], payload)
+	return slot, nil
+}
+
+// decodePage - Unwraps a slot written by encodePage into a BlockSize page
+func (f pageFormat) decodePage(blockID uint64, slot []byte) ([]byte, error) {
+	if f.raw() {
+		return slot, nil
+	}
+	if len(slot) < pageEnvelopeSize {
+		return nil, errCorruptPage
+	}
+	flags := slot[0]
+	length := int(binary.LittleEndian.Uint32(slot[1:]))
+	if length > len(slot)-pageEnvelopeSize {
+		return nil, errCorruptPage
+	}
+	payload := slot[pageEnvelopeSize : pageEnvelopeSize+length]
+
+	if flags&pageEncrypted != 0 {
+		if f.cipher == nil {
+			return nil, ErrEncryptionKeyRequired
+		}
+		opened, err := openPayload(f.cipher, payload, Uint64ToBytes(blockID))
+		if err != nil {
+			return nil, fmt.Errorf("%w: block %d failed authentication", errCorruptPage, blockID)
+		}
+		payload = opened
+	} else if f.cipher != nil {
+		// Every page of an encrypted file is sealed, a plaintext one was tampered with
+		return nil, fmt.Errorf("%w: block %d is not encrypted", errCorruptPage, blockID)
+	}
+
+	if flags&pageCompressed != 0 {
+		return inflate(payload)
+	}
+	if len(payload) > BlockSize {
+		return nil, errCorruptPage
+	}
+	page := make([]byte, BlockSize)
+	copy(page, payload)
+	return page, nil
+}
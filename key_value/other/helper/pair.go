@@ -23,6 +23,10 @@ const maxKeyLength = 30
 //maxlength of a value
 const maxValueLength = 93
 
+// valueLogged - Bit of the value length of a pair whose value is a pointer into the value
+// log, see vlog.go
+const valueLogged = 1 << 15
+
 // A pair struct
 type Pairs struct {
 	KeyLen   uint16 //2
@@ -42,7 +46,9 @@ func (p *Pairs) SetKey(key string) {
 //Takes value to be set as a string
 func (p *Pairs) SetValue(value string) {
 	p.Value = value
-	p.ValueLen = uint16(len(value))
+	// Values long enough to reach valueLogged are moved to the value log before they
+	// reach a page, or only ever kept in memory
+	p.ValueLen = uint16(len(value)) &^ valueLogged
 }
 
 // newPair creates a new Pair object.
@@ -55,6 +61,16 @@ func NewPair(key string, value string) *Pairs {
 	return pair
 }
 
+// logged - Whether the value of the pair is a pointer into the value log
+func (p *Pairs) logged() bool {
+	return p.ValueLen&valueLogged != 0
+}
+
+// valueLength - Length of the value stored with the pair, a pointer for a logged value
+func (p *Pairs) valueLength() uint16 {
+	return p.ValueLen &^ valueLogged
+}
+
 func (p *Pairs) Validate() error {
 	if len(p.Key) > maxKeyLength {
 		return fmt.Errorf("key length should not be more than 30, currently it is %d ", len(p.Key))
@@ -95,7 +111,7 @@ func ConvertPairsToBytes(pair *Pairs) []byte {
 	copy(bytePair[pairOffset:], keyByte[:pair.KeyLen])
 	pairOffset += pair.KeyLen
 	valByte := []byte(pair.Value)
-	copy(bytePair[pairOffset:], valByte[:pair.ValueLen])
+	copy(bytePair[pairOffset:], valByte[:pair.valueLength()])
 	return bytePair
 }
 
@@ -112,6 +128,6 @@ func ConvertBytesToPairs(pairByte []byte) *Pairs {
 	pairOffset += 2
 	pair.Key = string(pairByte[pairOffset : pairOffset+pair.KeyLen])
 	pairOffset += pair.KeyLen
-	pair.Value = string(pairByte[pairOffset : pairOffset+pair.ValueLen])
+	pair.Value = string(pairByte[pairOffset : pairOffset+pair.valueLength()])
 	return pair
 }
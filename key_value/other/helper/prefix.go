@@ -0,0 +1,395 @@
+package helper
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/**
+PREFIX COMPRESSED PAGES
+	Files flagged headerPrefixed leave out of every key the bytes it shares with the key
+	before it in the page, keys like tenant42:orders:000123 mostly cost their last bytes.
+	Every prefixRestartInterval-th key is a restart point stored in full, a key is found
+	with a binary search over the restart points and a scan of the few keys after one.
+
+	0:8    block id
+	8:10   pairs
+	10:12  children
+	12:14  restart points
+	14:22  pairs in the subtree, see counts.go
+	22:    child block ids (8 each)
+	then   offset of every restart point in the page (2 each)
+	then   the pairs: shared key bytes (1), length of the rest of the key (1), value length
+	       with the valueLogged bit (2), rest of the key, value
+
+	Pairs take a varying number of bytes, a node overflows when its page outgrows
+	prefixedPageSize instead of at MaxLeafSize pairs. The size is estimated by prefixedSize,
+	which charges every restart point the longest key so removing a pair never makes it
+	bigger. Deletion can still grow a node when one of its separators is replaced by a
+	longer pair, the node is then split by its parent just like on insert. Nodes other
+	than the root keep prefixedMinKeys pairs, few enough that two of them merged always fit
+	in a page whatever their keys and values.
+	Files without the flag keep the fixed PairSize slots of GetBufferFromBlock.
+*/
+
+const (
+	prefixRestartInterval = 16
+
+	prefixedHeaderSize      = 22
+	prefixedEntryHeaderSize = 4
+	prefixedRestartSize     = 2
+	// prefixedPageSize - Largest raw page, that of MaxLeafSize fixed slots so a page still
+	// fits in a block with its envelope
+	prefixedPageSize = 24 + MaxLeafSize*PairSize + (MaxLeafSize+1)*8 + 8
+	// prefixedMaxEntry - Most bytes a pair takes with its child pointer
+	prefixedMaxEntry = prefixedEntryHeaderSize + maxKeyLength + maxValueLength + 8
+	// prefixedMaxKeys - Pairs of the largest size that fit in a page, they need no more
+	// than two restart points
+	prefixedMaxKeys = (prefixedPageSize - prefixedHeaderSize - 8 - 2*(prefixedRestartSize+maxKeyLength)) / prefixedMaxEntry
+	// prefixedMinKeys - Fewest pairs of a node other than the root
+	prefixedMinKeys = prefixedMaxKeys / 2
+)
+
+var errNodeTooLarge = errors.New("node does not fit in a page")
+
+// prefixed - Whether the pages of the file are prefix compressed
+func (bs *BlockService) prefixed() bool {
+	return bs.header != nil && bs.header.flags&headerPrefixed != 0
+}
+
+func sharedPrefix(a string, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func restartPoints(pairs int) int {
+	return (pairs + prefixRestartInterval - 1) / prefixRestartInterval
+}
+
+// prefixedSize - Estimated size of the page of a node with the given pairs, never smaller
+// than the page encodePrefixedBlock writes
+func prefixedSize(pairs []*Pairs, internal bool) int {
+	size := prefixedHeaderSize + restartPoints(len(pairs))*(prefixedRestartSize+maxKeyLength)
+	if internal {
+		size += 8 * (len(pairs) + 1)
+	}
+	previous := ""
+	for _, pair := range pairs {
+		size += prefixedEntryHeaderSize + len(pair.Key) - sharedPrefix(previous, pair.Key) + int(pair.valueLength())
+		previous = pair.Key
+	}
+	return size
+}
+
+// prefixedSplitIndex - Index of the element to pop up when splitting a node with the given
+// pairs, the one leaving both halves closest in size while keeping prefixedMinKeys each
+func prefixedSplitIndex(pairs []*Pairs, internal bool) int {
+	entry := func(i int) int {
+		size := prefixedEntryHeaderSize + len(pairs[i].Key) + int(pairs[i].valueLength())
+		if i > 0 {
+			size -= sharedPrefix(pairs[i-1].Key, pairs[i].Key)
+		}
+		if internal {
+			size += 8
+		}
+		return size
+	}
+	half := func(pairs int, entries int) int {
+		size := prefixedHeaderSize + restartPoints(pairs)*(prefixedRestartSize+maxKeyLength) + entries
+		if internal {
+			size += 8
+		}
+		return size
+	}
+	total := 0
+	for i := range pairs {
+		total += entry(i)
+	}
+
+	best, bestSize := len(pairs)/2, -1
+	left := 0
+	for i := 0; i < len(pairs); i++ {
+		if i >= prefixedMinKeys && len(pairs)-1-i >= prefixedMinKeys {
+			// The first pair of the right half loses the prefix it shared with the middle
+			right := total - left - entry(i)
+			if i+1 < len(pairs) {
+				right += sharedPrefix(pairs[i].Key, pairs[i+1].Key)
+			}
+			size := half(i, left)
+			if rightSize := half(len(pairs)-1-i, right); rightSize > size {
+				size = rightSize
+			}
+			if bestSize < 0 || size < bestSize {
+				best, bestSize = i, size
+			}
+		}
+		left += entry(i)
+	}
+	return best
+}
+
+// encodePrefixedBlock - The raw page of the block in the prefix compressed layout
+func encodePrefixedBlock(block *DiskBlock) ([]byte, error) {
+	if size := prefixedSize(block.DataSet, len(block.ChildrenBlocksIds) > 0); size > prefixedPageSize {
+		return nil, fmt.Errorf("%w: block %d needs %d bytes", errNodeTooLarge, block.Id, size)
+	}
+	page := make([]byte, BlockSize)
+	restarts := restartPoints(len(block.DataSet))
+	binary.LittleEndian.PutUint64(page, block.Id)
+	binary.LittleEndian.PutUint16(page[8:], uint16(len(block.DataSet)))
+	binary.LittleEndian.PutUint16(page[10:], uint16(len(block.ChildrenBlocksIds)))
+	binary.LittleEndian.PutUint16(page[12:], uint16(restarts))
+	binary.LittleEndian.PutUint64(page[14:], block.Count)
+	offset := prefixedHeaderSize
+	for _, childID := range block.ChildrenBlocksIds {
+		binary.LittleEndian.PutUint64(page[offset:], childID)
+		offset += 8
+	}
+
+	restartOffset := offset
+	offset += restarts * prefixedRestartSize
+	previous := ""
+	for i, pair := range block.DataSet {
+		shared := 0
+		if i%prefixRestartInterval == 0 {
+			binary.LittleEndian.PutUint16(page[restartOffset:], uint16(offset))
+			restartOffset += prefixedRestartSize
+		} else {
+			shared = sharedPrefix(previous, pair.Key)
+		}
+		page[offset] = byte(shared)
+		page[offset+1] = byte(len(pair.Key) - shared)
+		binary.LittleEndian.PutUint16(page[offset+2:], pair.ValueLen)
+		offset += prefixedEntryHeaderSize
+		offset += copy(page[offset:], pair.Key[shared:])
+		offset += copy(page[offset:], pair.Value[:pair.valueLength()])
+		previous = pair.Key
+	}
+	return page, nil
+}
+
+// prefixedPage - A raw prefix compressed page, read in place
+type prefixedPage struct {
+	page                      []byte
+	pairs, children, restarts int
+}
+
+// readPrefixedPage - Checks that the header of the page describes parts that fit in it
+func readPrefixedPage(page []byte) (prefixedPage, error) {
+	if len(page) < prefixedHeaderSize {
+		return prefixedPage{}, errCorruptBlock
+	}
+	p := prefixedPage{
+		page:     page,
+		pairs:    int(binary.LittleEndian.Uint16(page[8:])),
+		children: int(binary.LittleEndian.Uint16(page[10:])),
+		restarts: int(binary.LittleEndian.Uint16(page[12:])),
+	}
+	if p.restarts != restartPoints(p.pairs) || p.entriesOffset() > len(page) {
+		return prefixedPage{}, fmt.Errorf("%w: %d pairs and %d children don't fit in a block", errCorruptBlock, p.pairs, p.children)
+	}
+	return p, nil
+}
+
+func (p prefixedPage) child(i int) uint64 {
+	return binary.LittleEndian.Uint64(p.page[prefixedHeaderSize+8*i:])
+}
+
+func (p prefixedPage) restartOffset(r int) int {
+	return int(binary.LittleEndian.Uint16(p.page[prefixedHeaderSize+8*p.children+prefixedRestartSize*r:]))
+}
+
+func (p prefixedPage) entriesOffset() int {
+	return prefixedHeaderSize + 8*p.children + prefixedRestartSize*p.restarts
+}
+
+// entry - Decodes the pair at offset, previous is the key of the pair before it. Returns
+// the offset of the next pair.
+func (p prefixedPage) entry(offset int, previous string) (*Pairs, int, error) {
+	if offset < p.entriesOffset() || offset+prefixedEntryHeaderSize > len(p.page) {
+		return nil, 0, fmt.Errorf("%w: pair at offset %d is outside the page", errCorruptBlock, offset)
+	}
+	shared, rest := int(p.page[offset]), int(p.page[offset+1])
+	valueLen := binary.LittleEndian.Uint16(p.page[offset+2:])
+	length := int(valueLen &^ valueLogged)
+	offset += prefixedEntryHeaderSize
+	if shared > len(previous) || shared+rest > maxKeyLength || length > maxValueLength ||
+		offset+rest+length > len(p.page) {
+		return nil, 0, fmt.Errorf("%w: pair at offset %d has invalid lengths", errCorruptBlock, offset)
+	}
+	key := previous[:shared] + string(p.page[offset:offset+rest])
+	offset += rest
+	pair := &Pairs{KeyLen: uint16(len(key)), ValueLen: valueLen, Key: key, Value: string(p.page[offset : offset+length])}
+	return pair, offset + length, nil
+}
+
+// decode - The block of the page, every pair is checked on the way
+func (p prefixedPage) decode() (*DiskBlock, error) {
+	block := &DiskBlock{
+		Id:                  binary.LittleEndian.Uint64(p.page),
+		CurenLeafSize:       uint64(p.pairs),
+		CurrentChildrenSize: uint64(p.children),
+		ChildrenBlocksIds:   make([]uint64, p.children),
+		DataSet:             make([]*Pairs, p.pairs),
+		Count:               binary.LittleEndian.Uint64(p.page[14:]),
+	}
+	for i := range block.ChildrenBlocksIds {
+		block.ChildrenBlocksIds[i] = p.child(i)
+	}
+	offset := p.entriesOffset()
+	previous := ""
+	for i := range block.DataSet {
+		if i%prefixRestartInterval == 0 {
+			if p.restartOffset(i/prefixRestartInterval) != offset {
+				return nil, fmt.Errorf("%w: restart point %d is misplaced", errCorruptBlock, i/prefixRestartInterval)
+			}
+			previous = ""
+		}
+		pair, next, err := p.entry(offset, previous)
+		if err != nil {
+			return nil, err
+		}
+		block.DataSet[i], offset, previous = pair, next, pair.Key
+	}
+	return block, nil
+}
+
+// upperBound - Index of the first pair after the key, with the pair before it (nil for the
+// first). A binary search finds the last restart point not after the key, only the pairs
+// that follow it up to the next restart point are decoded.
+func (p prefixedPage) upperBound(key string) (int, *Pairs, error) {
+	var err error
+	r := sort.Search(p.restarts, func(r int) bool {
+		pair, _, restartErr := p.entry(p.restartOffset(r), "")
+		if restartErr != nil {
+			err = restartErr
+			return true
+		}
+		return pair.Key > key
+	})
+	if err != nil || r == 0 {
+		return 0, nil, err
+	}
+	index := (r - 1) * prefixRestartInterval
+	end := index + prefixRestartInterval
+	if end > p.pairs {
+		end = p.pairs
+	}
+	offset := p.restartOffset(r - 1)
+	var closest *Pairs
+	previous := ""
+	for ; index < end; index++ {
+		pair, next, err := p.entry(offset, previous)
+		if err != nil {
+			return 0, nil, err
+		}
+		if pair.Key > key {
+			break
+		}
+		closest, offset, previous = pair, next, pair.Key
+	}
+	return index, closest, nil
+}
+
+// searchesPages - Whether lookups search the raw pages in place instead of decoding them,
+// done for prefix compressed files when there is no cache to keep the decoded blocks
+func (bs *BlockService) searchesPages() bool {
+	return bs.prefixed() && bs.cache == nil
+}
+
+// floorInPages - Carries on DiskNode.floor from the block, closest is the best pair found
+// above it
+func (bs *BlockService) floorInPages(blockID uint64, key string, closest *Pairs) (*Pairs, error) {
+	for {
+		done := false
+		err := bs.withPage(int64(blockID), func(page []byte) error {
+			p, err := readPrefixedPage(page)
+			if err != nil {
+				return err
+			}
+			i, pair, err := p.upperBound(key)
+			if err != nil {
+				return err
+			}
+			if pair != nil {
+				closest = pair
+			}
+			if (pair != nil && pair.Key == key) || p.children == 0 {
+				done = true
+				return nil
+			}
+			if i >= p.children {
+				return fmt.Errorf("%w: no child for pair %d", errCorruptBlock, i)
+			}
+			blockID = p.child(i)
+			return nil
+		})
+		if err != nil || done {
+			return closest, err
+		}
+	}
+}
+
+// salvagePrefixedPairs - salvagePairs for a prefix compressed page. Decoding stops at the
+// first damaged pair and resumes at the next restart point. When the pair count is damaged
+// the runs of the recorded restart points are decoded as far as they hold plausible pairs.
+func salvagePrefixedPairs(page []byte) (pairs []*Pairs, lost int) {
+	if len(page) < prefixedHeaderSize {
+		return nil, 0
+	}
+	p := prefixedPage{
+		page:     page,
+		pairs:    int(binary.LittleEndian.Uint16(page[8:])),
+		children: int(binary.LittleEndian.Uint16(page[10:])),
+		restarts: int(binary.LittleEndian.Uint16(page[12:])),
+	}
+	trusted := p.restarts == restartPoints(p.pairs)
+	if !trusted {
+		p.pairs = p.restarts * prefixRestartInterval
+	}
+	if p.entriesOffset() > len(page) {
+		return nil, 0
+	}
+	for r := 0; r < p.restarts; r++ {
+		offset := p.restartOffset(r)
+		previous := ""
+		end := (r + 1) * prefixRestartInterval
+		if end > p.pairs {
+			end = p.pairs
+		}
+		for i := r * prefixRestartInterval; i < end; i++ {
+			pair, next, err := p.entry(offset, previous)
+			if err != nil || pair.Key == "" {
+				if trusted {
+					lost += end - i
+				}
+				break
+			}
+			pairs = append(pairs, pair)
+			offset, previous = next, pair.Key
+		}
+	}
+	return pairs, lost
+}
+
+// nodeFits - Whether a node with the given pairs fits in a page
+func (bs *BlockService) nodeFits(pairs []*Pairs, internal bool) bool {
+	if bs.prefixed() {
+		return prefixedSize(pairs, internal) <= prefixedPageSize
+	}
+	return len(pairs) <= bs.GetMaxLeafSize()
+}
+
+// fill - Share of the page of the block in use, bytes for prefix compressed pages and pair
+// slots otherwise
+func (bs *BlockService) fill(block *DiskBlock) float64 {
+	if bs.prefixed() {
+		return float64(prefixedSize(block.DataSet, block.CurrentChildrenSize > 0)) / prefixedPageSize
+	}
+	return float64(block.CurenLeafSize) / float64(bs.GetMaxLeafSize())
+}
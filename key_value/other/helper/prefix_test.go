@@ -0,0 +1,206 @@
+package helper
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPrefixCompressedPages(t *testing.T) {
+	path := clearNamedDB("prefix.db")
+	db, err := Open(path, WithCacheSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3000; i++ {
+		if err := db.Put(fmt.Sprintf("tenant42:orders:%06d", i), fmt.Sprintf("%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !db.storage.blockService.prefixed() {
+		t.Fatal("New files should be prefix compressed")
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pairsPerPage := stats.Keys / (stats.LeafPages + stats.InternalPages); pairsPerPage < 3*MaxLeafSize {
+		t.Error("Shared prefixes should pack many more pairs in a page", pairsPerPage, stats)
+	}
+	db.Close()
+
+	// Lookups without a cache search the pages in place
+	db, err = Open(path, WithCacheSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3000; i++ {
+		value, found, err := db.Get(fmt.Sprintf("tenant42:orders:%06d", i))
+		if err != nil || !found || value != fmt.Sprintf("%d", i) {
+			t.Fatal("Missing key after reopening", i, value, err)
+		}
+	}
+	if _, found, _ := db.Get("tenant42:orders:"); found {
+		t.Error("Found a key that was never stored")
+	}
+	if pair, err := db.storage.root.floor("tenant42:orders:001500x"); err != nil || pair == nil || pair.Key != "tenant42:orders:001500" {
+		t.Error("Floor should find the key before", pair, err)
+	}
+	db.Close()
+
+	report, err := Check(path)
+	if err != nil || !report.OK {
+		t.Error("Prefix compressed file should be healthy", report, err)
+	}
+}
+
+func TestPrefixedPageSearch(t *testing.T) {
+	block := &DiskBlock{Id: 7, Count: 100}
+	var pairs []*Pairs
+	for i := 0; i < 100; i++ {
+		pairs = append(pairs, NewPair(fmt.Sprintf("user:%04d", i*2), strings.Repeat("v", i%10)))
+	}
+	block.SetData(pairs)
+	raw, err := encodePrefixedBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := readPrefixedPage(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := page.decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Id != 7 || decoded.Count != 100 || len(decoded.DataSet) != 100 {
+		t.Fatal("Block should decode as it was encoded", decoded)
+	}
+	for i, pair := range decoded.DataSet {
+		if pair.Key != pairs[i].Key || pair.Value != pairs[i].Value {
+			t.Fatal("Pair should decode as it was encoded", i, pair)
+		}
+	}
+
+	for i := -1; i < 201; i++ {
+		key := fmt.Sprintf("user:%04d", i)
+		want := 0
+		for want < len(pairs) && pairs[want].Key <= key {
+			want++
+		}
+		index, closest, err := page.upperBound(key)
+		if err != nil || index != want {
+			t.Fatal("Binary search should agree with a scan", key, index, want, err)
+		}
+		if (want == 0) != (closest == nil) || (closest != nil && closest.Key != pairs[want-1].Key) {
+			t.Fatal("Binary search should return the pair before", key, closest)
+		}
+	}
+}
+
+func TestPrefixedDelete(t *testing.T) {
+	path := clearNamedDB("prefix_delete.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Keys and values of very different sizes, so replaced separators and values grow
+	// pages past their size
+	random := rand.New(rand.NewSource(49))
+	stored := make(map[string]string)
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("%d:%s", random.Intn(5), strings.Repeat("k", random.Intn(20)))
+		key = fmt.Sprintf("%s%05d", key, random.Intn(3000))
+		value := strings.Repeat("v", 1+random.Intn(maxValueLength))
+		if err := db.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+		stored[key] = value
+	}
+	deleted := 0
+	for key := range stored {
+		if deleted%3 != 0 {
+			if _, err := db.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			delete(stored, key)
+		}
+		deleted++
+	}
+	report, err := db.storage.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK || report.Keys != int64(len(stored)) {
+		t.Fatal("Tree should stay healthy through the deletes", len(stored), report)
+	}
+	for key, value := range stored {
+		if got, found, err := db.Get(key); err != nil || !found || got != value {
+			t.Fatal("Key should survive the deletes of others", key, err)
+		}
+	}
+}
+
+func TestPrefixedNodesOverflow(t *testing.T) {
+	// Two levels, then three: the root or the node above the leaves fills up
+	for _, total := range []int{20000, 100000} {
+		tree, err := openBtree(clearNamedDB("prefix_overflow.db"), defaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs := make([]*Pairs, total)
+		for i := range pairs {
+			pairs[i] = NewPair(fmt.Sprintf("k%06d", i), "v")
+		}
+		if err := tree.bulkLoad(pairs); err != nil {
+			t.Fatal(err)
+		}
+		node := tree.root.(*DiskNode)
+		for {
+			child, err := node.getChildAtIndex(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if child.isLeaf() {
+				break
+			}
+			node = child
+		}
+
+		// Small separators replaced by large pairs, by deletion or in place
+		large := strings.Repeat("v", maxValueLength)
+		deleted := make(map[string]bool)
+		for i, separator := range append([]*Pairs(nil), node.keys...) {
+			var index int
+			fmt.Sscanf(separator.Key, "k%06d", &index)
+			if i%2 == 0 {
+				// Deletion pulls up the predecessor of the separator, made large first
+				if err := tree.insert(NewPair(fmt.Sprintf("k%06d", index-1), large)); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tree.delete(separator.Key); err != nil {
+					t.Fatal(err)
+				}
+				deleted[separator.Key] = true
+			} else if err := tree.insert(NewPair(separator.Key, large)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		report, err := tree.check()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.OK || report.Keys != int64(total-len(deleted)) {
+			t.Fatal("Overflown nodes should be split", total, report)
+		}
+		for i := 0; i < total; i++ {
+			key := fmt.Sprintf("k%06d", i)
+			if _, found, err := tree.get(key); err != nil || found == deleted[key] {
+				t.Fatal("Unexpected lookup after the splits", key, found, err)
+			}
+		}
+		tree.close()
+	}
+}
@@ -0,0 +1,298 @@
+package helper
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// RepairReport - What Repair recovered from a damaged file and what it had to give up on
+type RepairReport struct {
+	ScannedBlocks int64 `json:"scanned_blocks"`
+	// UnreadableBlocks - Blocks whose page failed to decode or authenticate, their pairs are lost
+	UnreadableBlocks []uint64 `json:"unreadable_blocks"`
+	// DamagedBlocks - Blocks with a bad header or some bad pairs, the rest was salvaged
+	DamagedBlocks []uint64 `json:"damaged_blocks"`
+	// LostPairs - Pair slots of damaged blocks that held no decodable pair
+	LostPairs int `json:"lost_pairs"`
+	// DuplicatePairs - Older copies of a key dropped in favour of the latest one
+	DuplicatePairs int `json:"duplicate_pairs"`
+	// FromUnreachable - Keys only found in blocks no longer reachable from the root
+	FromUnreachable int `json:"from_unreachable"`
+	// UnattributedPairs - Pairs of unreachable blocks of a file with buckets, left out as
+	// their bucket is unknown
+	UnattributedPairs int `json:"unattributed_pairs"`
+	// StalePairs - Pairs of unreachable blocks left out as every tree could be read, they
+	// are copies dropped by a write that never freed them and may hold deleted keys
+	StalePairs int `json:"stale_pairs"`
+	RecoveredPairs    int `json:"recovered_pairs"`
+	RecoveredBuckets  int `json:"recovered_buckets"`
+}
+
+// salvaged - A recovered pair and where it was found, to pick the latest copy of a key
+type salvaged struct {
+	pair      *Pairs
+	reachable bool
+	blockID   uint64
+	index     int
+}
+
+// newerThan - Copies in the live tree win over stale ones in dropped blocks, then the
+// copy written last, blocks are allocated at the end of the file
+func (s salvaged) newerThan(other salvaged) bool {
+	if s.reachable != other.reachable {
+		return s.reachable
+	}
+	if s.blockID != other.blockID {
+		return s.blockID > other.blockID
+	}
+	return s.index > other.index
+}
+
+// salvagePairs - Recovers the pairs of a page that doesn't decode as a whole. When the
+// pair count is damaged too every slot is tried and only plausible pairs are kept.
+func salvagePairs(page []byte) (pairs []*Pairs, lost int) {
+	slots := (len(page) - 24) / PairSize
+	leafSize := Uint64FromBytes(page[8:])
+	trusted := leafSize <= uint64(slots)
+	if trusted {
+		slots = int(leafSize)
+	}
+	for i := 0; i < slots; i++ {
+		offset := 24 + i*PairSize
+		keyLen := int(binary.LittleEndian.Uint16(page[offset:]))
+		valueLen := int(binary.LittleEndian.Uint16(page[offset+2:]) &^ valueLogged)
+		if keyLen == 0 || keyLen > maxKeyLength || valueLen > maxValueLength || offset+4+keyLen+valueLen > len(page) {
+			if trusted {
+				lost++
+			}
+			continue
+		}
+		pairs = append(pairs, ConvertBytesToPairs(page[offset:]))
+	}
+	return pairs, lost
+}
+
+// blockOwners - The tree each block reachable from a root belongs to
+type blockOwners struct {
+	// buckets - Bucket of the blocks of the main tree ("") and of the bucket trees
+	buckets map[uint64]string
+	catalog map[uint64]bool
+	// names - Buckets listed by the catalog, in catalog order
+	names []string
+	// broken - Whether a block of a tree couldn't be read, the pairs of unreachable blocks
+	// may then be the only copy left of some keys
+	broken bool
+}
+
+// reachFrom - Calls fn for every readable block of the tree rooted at rootID, in breadth
+// first order and without visiting a block twice. Returns false when a block of the tree
+// couldn't be read.
+func (bs *BlockService) reachFrom(rootID uint64, latestBlockID int64, visited map[uint64]bool, fn func(block *DiskBlock)) bool {
+	intact := true
+	queue := []uint64{rootID}
+	for len(queue) > 0 {
+		blockID := queue[0]
+		queue = queue[1:]
+		if visited[blockID] {
+			continue
+		}
+		if int64(blockID) > latestBlockID {
+			intact = false
+			continue
+		}
+		visited[blockID] = true
+		block, err := bs.readBlock(int64(blockID))
+		if err != nil {
+			intact = false
+			continue
+		}
+		fn(block)
+		queue = append(queue, block.ChildrenBlocksIds...)
+	}
+	return intact
+}
+
+// owners - Finds the tree of every block reachable from the main root, the bucket catalog
+// or the roots the catalog lists, skipping whatever can't be read
+func (bs *BlockService) owners() blockOwners {
+	owners := blockOwners{buckets: make(map[uint64]string), catalog: make(map[uint64]bool)}
+	latestBlockID, err := bs.GetLatestBlockID()
+	if err != nil || latestBlockID < 0 {
+		return owners
+	}
+	visited := make(map[uint64]bool)
+	owners.broken = !bs.reachFrom(0, latestBlockID, visited, func(block *DiskBlock) {
+		owners.buckets[block.Id] = ""
+	})
+	catalogRoot := bs.catalogRoot()
+	if catalogRoot == 0 {
+		return owners
+	}
+	roots := make(map[string]uint64)
+	intact := bs.reachFrom(catalogRoot, latestBlockID, visited, func(block *DiskBlock) {
+		owners.catalog[block.Id] = true
+		for _, entry := range block.DataSet {
+			rootID, err := strconv.ParseUint(entry.Value, 10, 64)
+			if _, found := roots[entry.Key]; err == nil && !found {
+				owners.names = append(owners.names, entry.Key)
+				roots[entry.Key] = rootID
+			}
+		}
+	})
+	owners.broken = owners.broken || !intact
+	for _, name := range owners.names {
+		name := name
+		intact := bs.reachFrom(roots[name], latestBlockID, visited, func(block *DiskBlock) {
+			owners.buckets[block.Id] = name
+		})
+		owners.broken = owners.broken || !intact
+	}
+	return owners
+}
+
+// salvageKey - Keys of different buckets don't replace each other
+type salvageKey struct {
+	bucket string
+	key    string
+}
+
+/**
+REPAIR ALGORITHM
+	The tree of a damaged file can't be trusted, so every block slot is read in file order
+		1. Pages that decode as a block give all their pairs, pages whose header or pairs are
+		   damaged give whatever pairs still decode (salvagePairs)
+		2. Each key keeps a single copy, the one in the live tree if any, else the most recently
+		   written (see newerThan)
+		3. The surviving pairs are bulk loaded into a fresh file, the pairs of every bucket
+		   still listed by the catalog into a bucket of the same name
+	Unreachable blocks were dropped by splits and merges of a write interrupted before it
+	freed them, or of a legacy file, and may still hold keys deleted since. They are only salvaged when a block of a tree can't be read, the pairs found only
+	in them may then be the only copy of a key left, and are counted in the report as they
+	could also be stale. A file with buckets is the exception: there is no telling which
+	tree an unreachable block belonged to, so its pairs are left out rather than mixed into
+	the wrong keyspace.
+*/
+
+// Repair - Salvages the pairs of the damaged file at src into a new file at dst. The source
+// file is only read. The options apply to both files, an encrypted source needs its key.
+func Repair(src, dst string, opts ...Option) (*RepairReport, error) {
+	o := buildOptions(opts)
+	if _, err := os.Stat(dst); err == nil {
+		return nil, fmt.Errorf("%s already exists", dst)
+	}
+
+	srcBS, err := openInspected(src, o)
+	if err != nil {
+		return nil, err
+	}
+	defer srcBS.close()
+	latestBlockID, err := srcBS.GetLatestBlockID()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RepairReport{UnreadableBlocks: []uint64{}, DamagedBlocks: []uint64{}}
+	owners := srcBS.owners()
+	latest := make(map[salvageKey]salvaged)
+	for id := int64(0); id <= latestBlockID; id++ {
+		report.ScannedBlocks++
+		if owners.catalog[uint64(id)] {
+			continue
+		}
+		bucket, reachable := owners.buckets[uint64(id)]
+		if !reachable && !owners.broken {
+			if block, err := srcBS.readBlock(id); err == nil {
+				report.StalePairs += len(block.DataSet)
+			}
+			continue
+		}
+		var pairs []*Pairs
+		err := srcBS.withPage(id, func(page []byte) error {
+			block, err := srcBS.decodeBlock(page)
+			if err == nil {
+				pairs = block.DataSet
+				return nil
+			}
+			var lost int
+			if srcBS.prefixed() {
+				pairs, lost = salvagePrefixedPairs(page)
+			} else {
+				pairs, lost = salvagePairs(page)
+			}
+			report.LostPairs += lost
+			report.DamagedBlocks = append(report.DamagedBlocks, uint64(id))
+			return nil
+		})
+		if err != nil {
+			report.UnreadableBlocks = append(report.UnreadableBlocks, uint64(id))
+			continue
+		}
+		if !reachable && srcBS.catalogRoot() != 0 {
+			report.UnattributedPairs += len(pairs)
+			continue
+		}
+		for index, pair := range pairs {
+			candidate := salvaged{pair: pair, reachable: reachable, blockID: uint64(id), index: index}
+			key := salvageKey{bucket: bucket, key: pair.Key}
+			if current, found := latest[key]; found {
+				report.DuplicatePairs++
+				if !candidate.newerThan(current) {
+					continue
+				}
+			}
+			latest[key] = candidate
+		}
+	}
+
+	// Values in the value log are read back and logged again by the new file
+	srcLog := srcBS.vlog
+	recovered := make(map[string][]*Pairs)
+	for key, s := range latest {
+		pair := s.pair
+		if pair.logged() {
+			if srcLog == nil {
+				report.LostPairs++
+				continue
+			}
+			value, err := srcLog.value(pair)
+			if err != nil {
+				report.LostPairs++
+				continue
+			}
+			pair = NewPair(pair.Key, value)
+		}
+		if !s.reachable {
+			report.FromUnreachable++
+		}
+		recovered[key.bucket] = append(recovered[key.bucket], pair)
+		report.RecoveredPairs++
+	}
+
+	o.mustExist = false
+	o.readOnly = false
+	tree, err := openBtree(dst, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := tree.bulkLoad(recovered[""]); err != nil {
+		tree.close()
+		return nil, err
+	}
+	for _, name := range owners.names {
+		if err := tree.createBucket(name); err != nil {
+			tree.close()
+			return nil, err
+		}
+		if err := tree.buckets[name].bulkLoad(recovered[name]); err != nil {
+			tree.close()
+			return nil, err
+		}
+		report.RecoveredBuckets++
+	}
+	if err := tree.close(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
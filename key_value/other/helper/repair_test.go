@@ -0,0 +1,170 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestBulkLoad(t *testing.T) {
+	for _, total := range []int{0, 1, 30, 31, 500, 5000} {
+		path := clearNamedDB("bulkload.db")
+		tree, err := openBtree(path, defaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs := make([]*Pairs, total)
+		for i := range pairs {
+			// Insert in reverse, the loader sorts
+			pairs[i] = NewPair(fmt.Sprintf("key-%05d", total-i), "value")
+		}
+		if err := tree.bulkLoad(pairs); err != nil {
+			t.Fatal(err)
+		}
+		report, err := tree.check()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.OK || report.Keys != int64(total) || len(report.Unreachable) != 0 {
+			t.Error("Bulk loaded tree should be healthy", total, report)
+		}
+		for i := 1; i <= total; i += 97 {
+			if _, found, err := tree.get(fmt.Sprintf("key-%05d", i)); err != nil || !found {
+				t.Error("Missing key after bulk load", i, err)
+			}
+		}
+		tree.close()
+	}
+}
+
+func TestRepairDamagedFile(t *testing.T) {
+	src := clearNamedDB("damaged.db")
+	dst := clearNamedDB("repaired.db")
+	db, err := Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		if err := db.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs := db.storage.blockService
+	root, err := bs.GetRootBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last pair of the first restart run of the first child, losing it loses no other
+	page, err := bs.readPage(int64(root.ChildrenBlocksIds[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := readPrefixedPage(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, previous := leaf.restartOffset(0), ""
+	for i := 0; i < prefixRestartInterval-1; i++ {
+		pair, next, err := leaf.entry(offset, previous)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset, previous = next, pair.Key
+	}
+	db.Close()
+
+	// Scribble over the pair count of the root and that pair of its first child
+	file, err := os.OpenFile(src, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	file.WriteAt(garbage[:2], BlockSize+8)
+	file.WriteAt(garbage, BlockSize*(1+int64(root.ChildrenBlocksIds[0]))+int64(offset))
+	file.Close()
+	if _, err := Open(src); err == nil {
+		t.Fatal("Damaged root should not open")
+	}
+
+	report, err := Repair(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.DamagedBlocks) != 2 || report.LostPairs != 1 {
+		t.Error("Unexpected repair report", report)
+	}
+	// The lost pair may still be recovered from a copy a split left behind
+	if report.RecoveredPairs < 299 || report.FromUnreachable == 0 {
+		t.Error("With the root damaged every pair comes from unreachable blocks", report)
+	}
+	check, err := Check(dst)
+	if err != nil || !check.OK {
+		t.Fatal("Repaired file should be healthy", check, err)
+	}
+	repaired, err := Open(dst, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repaired.Close()
+	value, found, err := repaired.Get("key-250")
+	if err != nil || !found || value != "value-250" {
+		t.Error("Recovered value should be readable", value, err)
+	}
+	if _, err := Repair(src, dst); err == nil {
+		t.Error("Repair should not overwrite an existing file")
+	}
+}
+
+func TestRepairKeepsDeletes(t *testing.T) {
+	src := clearNamedDB("deleted.db")
+	dst := clearNamedDB("deleted_repaired.db")
+	db, err := Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := db.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("%080d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 200; i += 2 {
+		if _, err := db.Delete(fmt.Sprintf("key-%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A write interrupted before freeing the blocks it dropped leaves stale copies of
+	// deleted keys in blocks the tree no longer reaches
+	bs := db.storage.blockService
+	latestBlockID, err := bs.GetLatestBlockID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := &DiskBlock{Id: uint64(latestBlockID + 1)}
+	for i := 0; i < 10; i += 2 {
+		stale.DataSet = append(stale.DataSet, NewPair(fmt.Sprintf("key-%03d", i), fmt.Sprintf("%080d", i)))
+	}
+	stale.CurenLeafSize = uint64(len(stale.DataSet))
+	stale.Count = stale.CurenLeafSize
+	if err := bs.WriteBlockToDisk(stale); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	report, err := Repair(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.StalePairs == 0 || report.FromUnreachable != 0 || report.RecoveredPairs != 100 {
+		t.Error("Stale copies should be left out of a readable tree", report)
+	}
+	repaired, err := Open(dst, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repaired.Close()
+	for i := 0; i < 200; i++ {
+		if _, found, err := repaired.Get(fmt.Sprintf("key-%03d", i)); err != nil || found != (i%2 == 1) {
+			t.Fatal("Deleted keys should stay deleted", i, found, err)
+		}
+	}
+}
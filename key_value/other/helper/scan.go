@@ -0,0 +1,46 @@
+package helper
+
+/**
+RANGE SCAN ALGORITHM
+	In order traversal limited to the keys in [start, end), an empty end means no upper
+	bound. For every element i of a node:
+		1. Visit child i first unless element i sorts before start, then the whole child does too
+		2. Stop once element i reaches end, neither it nor anything after it is in range
+		3. Emit element i if it is not before start
+	Finally visit the last child. The callback returns false to stop the scan early.
+*/
+
+// scanRange - Calls fn for the pairs of the subtree in [start, end) in key order, the
+// returned bool is false once fn asked to stop
+func (n *DiskNode) scanRange(start string, end string, fn func(pair *Pairs) bool) (bool, error) {
+	for i, element := range n.getElements() {
+		if !n.isLeaf() && element.Key >= start {
+			child, err := n.getChildAtIndex(i)
+			if err != nil {
+				return false, err
+			}
+			if more, err := child.scanRange(start, end, fn); err != nil || !more {
+				return more, err
+			}
+		}
+		if end != "" && element.Key >= end {
+			return false, nil
+		}
+		if element.Key >= start && !fn(element) {
+			return false, nil
+		}
+	}
+	if n.isLeaf() {
+		return true, nil
+	}
+	child, err := n.getLastChildNode()
+	if err != nil {
+		return false, err
+	}
+	return child.scanRange(start, end, fn)
+}
+
+func (n *DiskNode) scan(start string, end string, fn func(pair *Pairs) bool) error {
+	_, err := n.scanRange(start, end, fn)
+	return err
+}
@@ -0,0 +1,68 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+)
+
+// Snapshot - Write the content of the database to a new file at path, which Open can then
+// open with the same options. The pairs are bulk loaded, so the file is also a compact
+// copy of a file backed database. Buckets are copied along. Writes wait while the pairs
+// are collected.
+func (db *DB) Snapshot(path string, opts ...Option) error {
+	o := buildOptions(opts)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrClosed
+	}
+	// Pairs are never changed once stored, writes replace them, so they can be loaded
+	// after the lock is released
+	collect := func(tree *btree) ([]*Pairs, error) {
+		var pairs []*Pairs
+		err := tree.scan("", "", func(pair *Pairs) bool {
+			pairs = append(pairs, pair)
+			return true
+		})
+		return pairs, err
+	}
+	pairs, err := collect(db.storage)
+	names := db.storage.bucketNames()
+	buckets := make(map[string][]*Pairs, len(names))
+	for _, name := range names {
+		if err != nil {
+			break
+		}
+		buckets[name], err = collect(db.storage.buckets[name])
+	}
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	o.mustExist = false
+	o.readOnly = false
+	tree, err := openBtree(path, o)
+	if err != nil {
+		return err
+	}
+	if err := tree.bulkLoad(pairs); err != nil {
+		tree.close()
+		return err
+	}
+	for _, name := range names {
+		if err := tree.createBucket(name); err != nil {
+			tree.close()
+			return err
+		}
+		if err := tree.buckets[name].bulkLoad(buckets[name]); err != nil {
+			tree.close()
+			return err
+		}
+	}
+	return tree.close()
+}
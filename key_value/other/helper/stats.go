@@ -0,0 +1,200 @@
+package helper
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Stats - Shape and usage of a database file
+type Stats struct {
+	// Height - Number of levels of the main tree, a lone root leaf has height 1
+	Height int `json:"height"`
+	// Buckets - Number of buckets, whose pages and keys are counted with the main tree
+	Buckets int `json:"buckets"`
+	// TotalPages - Block slots in the file, not counting the header
+	TotalPages    int64 `json:"total_pages"`
+	InternalPages int64 `json:"internal_pages"`
+	LeafPages     int64 `json:"leaf_pages"`
+	// FreePages - Slots on the free list, new nodes take them before the file grows
+	FreePages int64 `json:"free_pages"`
+	// UnreachablePages - Slots neither reachable nor free, dropped by a write interrupted
+	// before it freed them or by splits in legacy files, see CheckReport
+	UnreachablePages int64 `json:"unreachable_pages"`
+	Keys             int64 `json:"keys"`
+	// FillFactor - Average share of a reachable page that is in use, the pair slots or for
+	// prefix compressed files the bytes
+	FillFactor float64 `json:"avg_fill_factor"`
+	// LeafFillFactor - The same for leaf pages only. Appends after the last key fill the
+	// leaves they split to 90% rather than half, see DiskNode.splitIndex.
+	LeafFillFactor float64 `json:"avg_leaf_fill_factor"`
+	KeyBytes       int64   `json:"key_bytes"`
+	ValueBytes     int64   `json:"value_bytes"`
+
+	CacheHits     uint64  `json:"cache_hits"`
+	CacheMisses   uint64  `json:"cache_misses"`
+	CacheHitRatio float64 `json:"cache_hit_ratio"`
+
+	// BloomBytes - Size of the bloom filter lookups consult first, 0 when there is none
+	BloomBytes int64 `json:"bloom_bytes"`
+	// BloomFalsePositiveRate - Estimated share of lookups of missing keys the filter lets
+	// through to the tree
+	BloomFalsePositiveRate float64 `json:"bloom_false_positive_rate"`
+	// BloomSkipped - Lookups the filter answered without reading a page since the open
+	BloomSkipped uint64 `json:"bloom_skipped"`
+	// BloomFalsePositives - Lookups the filter let through for a missing key since the open
+	BloomFalsePositives uint64 `json:"bloom_false_positives"`
+
+	// LoggedValues - Pairs whose value is in the value log, their ValueBytes count the
+	// pointer kept in the page
+	LoggedValues     int64 `json:"logged_values"`
+	ValueLogSegments int   `json:"value_log_segments"`
+	// ValueLogBytes - Size of the value log, garbage included until it is collected
+	ValueLogBytes int64 `json:"value_log_bytes"`
+
+	// Splits - Nodes split since the open, SequentialSplits of them by appends after the
+	// last key
+	Splits           uint64 `json:"splits"`
+	SequentialSplits uint64 `json:"sequential_splits"`
+
+	// Compression - Pages written through the codec since the open, nil without a codec
+	Compression *CompressionStats `json:"compression,omitempty"`
+}
+
+// readBlock - Reads and validates a block straight from the file, bypassing the cache so
+// maintenance walks neither evict hot blocks nor skew the hit ratio
+func (bs *BlockService) readBlock(index int64) (*DiskBlock, error) {
+	var block *DiskBlock
+	err := bs.withPage(index, func(page []byte) (err error) {
+		block, err = bs.decodeBlock(page)
+		return err
+	})
+	return block, err
+}
+
+/**
+STATS WALK
+	Visit the tree level by level from the root (block 0), counting pages and pairs as we go,
+	then the bucket catalog and the tree of every bucket. The slots on the free list are
+	free, every other slot of the file that the walks never reach is unreachable. A block
+	reached twice means the file is corrupt, we stop instead of walking a cycle forever.
+*/
+
+// stats - Walks the tree and gathers its statistics
+func (bt *btree) stats() (Stats, error) {
+	var stats Stats
+	var fill, leafFill float64
+	stats.Buckets = len(bt.buckets)
+	if bt.inMemory() {
+		stats.Height = bt.root.(*MemoryNode).addStats(&stats, &fill, &leafFill)
+		for _, tree := range bt.buckets {
+			tree.root.(*MemoryNode).addStats(&stats, &fill, &leafFill)
+		}
+		stats.TotalPages = stats.InternalPages + stats.LeafPages
+		if stats.TotalPages > 0 {
+			stats.FillFactor = fill / float64(stats.TotalPages)
+			stats.LeafFillFactor = leafFill / float64(stats.LeafPages)
+		}
+		return stats, nil
+	}
+
+	bs := bt.blockService
+	latestBlockID, err := bs.GetLatestBlockID()
+	if err != nil {
+		return stats, err
+	}
+	stats.TotalPages = latestBlockID + 1
+
+	visited := make(map[uint64]bool)
+	// walk - Counts the pages of the tree rooted at rootID and returns its height, the pairs
+	// of the catalog are not keys of the database
+	walk := func(rootID uint64, countKeys bool) (int, error) {
+		height := 0
+		level := []uint64{rootID}
+		for len(level) > 0 {
+			height++
+			var next []uint64
+			for _, blockID := range level {
+				if visited[blockID] {
+					return height, fmt.Errorf("block %d is referenced more than once", blockID)
+				}
+				visited[blockID] = true
+				block, err := bs.readBlock(int64(blockID))
+				if err != nil {
+					return height, err
+				}
+				pageFill := bs.fill(block)
+				if block.CurrentChildrenSize == 0 {
+					stats.LeafPages++
+					leafFill += pageFill
+				} else {
+					stats.InternalPages++
+				}
+				fill += pageFill
+				if countKeys {
+					stats.Keys += int64(block.CurenLeafSize)
+					for _, pair := range block.DataSet {
+						stats.KeyBytes += int64(pair.KeyLen)
+						stats.ValueBytes += int64(pair.valueLength())
+						if pair.logged() {
+							stats.LoggedValues++
+						}
+					}
+				}
+				next = append(next, block.ChildrenBlocksIds...)
+			}
+			level = next
+		}
+		return height, nil
+	}
+	if stats.Height, err = walk(0, true); err != nil {
+		return stats, err
+	}
+	if bt.catalog != nil {
+		if _, err := walk(bt.catalog.rootID, false); err != nil {
+			return stats, err
+		}
+	}
+	for _, name := range bt.bucketNames() {
+		if _, err := walk(bt.buckets[name].rootID, true); err != nil {
+			return stats, err
+		}
+	}
+
+	reachable := stats.InternalPages + stats.LeafPages
+	if reachable > 0 {
+		stats.FillFactor = fill / float64(reachable)
+		stats.LeafFillFactor = leafFill / float64(stats.LeafPages)
+	}
+	stats.Splits, stats.SequentialSplits = bs.splits, bs.sequentialSplits
+	if bs.format.codec != CodecNone {
+		compression := bs.compression
+		stats.Compression = &compression
+	}
+	free, err := bs.freeBlockIDs()
+	if err != nil {
+		return stats, err
+	}
+	stats.FreePages = int64(len(free))
+	if stats.TotalPages > reachable+stats.FreePages {
+		stats.UnreachablePages = stats.TotalPages - reachable - stats.FreePages
+	}
+	if bs.cache != nil {
+		stats.CacheHits, stats.CacheMisses = bs.cache.counters()
+		if lookups := stats.CacheHits + stats.CacheMisses; lookups > 0 {
+			stats.CacheHitRatio = float64(stats.CacheHits) / float64(lookups)
+		}
+	}
+	if bs.vlog != nil {
+		stats.ValueLogSegments = len(bs.vlog.segments)
+		if stats.ValueLogBytes, err = bs.vlog.bytes(); err != nil {
+			return stats, err
+		}
+	}
+	if bs.filter != nil {
+		stats.BloomBytes = int64(bs.filter.bloom.Size())
+		stats.BloomFalsePositiveRate = bs.filter.falsePositiveRate()
+		stats.BloomSkipped = atomic.LoadUint64(&bs.filter.skipped)
+		stats.BloomFalsePositives = atomic.LoadUint64(&bs.filter.falsePositives)
+	}
+	return stats, nil
+}
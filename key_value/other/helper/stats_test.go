@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestStatsOfEmptyDB(t *testing.T) {
+	db, err := Open(clearNamedDB("stats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Height != 1 || stats.LeafPages != 1 || stats.Keys != 0 || stats.FreePages != 0 {
+		t.Error("Empty database should be a lone empty leaf", stats)
+	}
+}
+
+func TestStatsAfterInserts(t *testing.T) {
+	db, err := Open(clearNamedDB("stats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var keyBytes, valueBytes int64
+	for i := 0; i < 200; i++ {
+		key, value := fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%040d", i)
+		keyBytes += int64(len(key))
+		valueBytes += int64(len(value))
+		if err := db.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if _, _, err := db.Get("key-007"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 200 || stats.KeyBytes != keyBytes || stats.ValueBytes != valueBytes {
+		t.Error("Key counts don't match the inserts", stats)
+	}
+	if stats.Height < 2 || stats.InternalPages == 0 {
+		t.Error("200 keys should not fit in a single page", stats)
+	}
+	if stats.InternalPages+stats.LeafPages+stats.FreePages+stats.UnreachablePages != stats.TotalPages {
+		t.Error("Every page should be accounted for", stats)
+	}
+	if stats.FillFactor <= 0 || stats.FillFactor > 1 {
+		t.Error("Fill factor out of range", stats.FillFactor)
+	}
+	if stats.CacheHitRatio <= 0 || stats.CacheHitRatio > 1 {
+		t.Error("Repeated reads should hit the cache", stats.CacheHitRatio)
+	}
+}
+
+// insertedStats - Stats of a new database after inserting the keys in the given order
+func insertedStats(t *testing.T, order []int) Stats {
+	t.Helper()
+	db, err := Open(clearNamedDB("stats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, i := range order {
+		if err := db.Put(fmt.Sprintf("order:%08d", i), fmt.Sprintf("value-%020d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := db.storage.check()
+	if err != nil || !report.OK || report.Keys != int64(len(order)) {
+		t.Fatal("Tree should be healthy after the inserts", report, err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestSequentialSplits(t *testing.T) {
+	order := make([]int, 5000)
+	for i := range order {
+		order[i] = i
+	}
+	appended := insertedStats(t, order)
+	if appended.Splits == 0 || appended.SequentialSplits != appended.Splits {
+		t.Error("Every split of an append only workload should be sequential", appended)
+	}
+	if appended.LeafFillFactor < 0.85 {
+		t.Error("Appends should leave the leaves nearly full", appended.LeafFillFactor)
+	}
+
+	rand.New(rand.NewSource(50)).Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	shuffled := insertedStats(t, order)
+	if shuffled.SequentialSplits*10 > shuffled.Splits {
+		t.Error("Random inserts should rarely split sequentially", shuffled)
+	}
+	if shuffled.LeafFillFactor > appended.LeafFillFactor-0.1 {
+		t.Error("Random inserts should leave emptier leaves than appends", shuffled.LeafFillFactor, appended.LeafFillFactor)
+	}
+}
+
+func TestStatsFreeAndUnreachablePages(t *testing.T) {
+	db, err := Open(clearNamedDB("stats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 200; i++ {
+		db.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%040d", i))
+	}
+	for i := 0; i < 150; i++ {
+		db.Delete(fmt.Sprintf("key-%03d", i))
+	}
+	// A page dropped by a write that never freed it is neither reachable nor free
+	bs := db.storage.blockService
+	latestBlockID, err := bs.GetLatestBlockID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.WriteBlockToDisk(&DiskBlock{Id: uint64(latestBlockID + 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := db.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FreePages == 0 || stats.FreePages != report.FreeBlocks {
+		t.Error("Free pages should be the ones on the free list", stats.FreePages, report.FreeBlocks)
+	}
+	if stats.UnreachablePages != 1 || int64(len(report.Unreachable)) != 1 {
+		t.Error("The dropped page should be unreachable", stats.UnreachablePages, report.Unreachable)
+	}
+	if stats.InternalPages+stats.LeafPages+stats.FreePages+stats.UnreachablePages != stats.TotalPages {
+		t.Error("Every page should be accounted for", stats)
+	}
+}
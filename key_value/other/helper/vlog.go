@@ -0,0 +1,668 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+VALUE LOG
+	Values longer than the inline threshold, and every value too long for a page, are
+	appended to a value log next to the file while the tree only keeps a pointer to them,
+	so pages keep their fan-out whatever the size of the values (WiscKey). The log is a
+	sequence of segments path.vlog.000001, path.vlog.000002, ... Each starts with the magic
+	"KVVL" followed by one record per value:
+		0:4   body length
+		4:8   CRC-32 of the body
+		8:    body: root block of the tree of the key (8), key length (2), key, value.
+		      Sealed with the data key in encrypted files.
+	Values are appended to the newest segment, a new one is started once it grows past
+	valueLogSegmentSize. The pair in the tree holds a pointer to the record: segment (4),
+	offset (8) and body length (4). The valueLogged bit of its value length tells it apart
+	from a value stored inline, no inline value is long enough to reach it.
+	The log is synced before the tree on commit, so a committed pair never points past the
+	end of the log, and a torn record at the end of the newest segment is cut off on open.
+	Overwritten and deleted values stay in the log until it is collected, see
+	CollectValueLog. Legacy files without a header have no value log.
+*/
+
+const valueLogSuffix = ".vlog."
+
+var valueLogMagic = []byte("KVVL")
+
+const (
+	valueLogRecordSize = 8
+	valueLogBodySize   = 10
+	valueRefSize       = 16
+	// valueLogMaxBody - Longest body of a record, sealing adds less than 64 bytes
+	valueLogMaxBody = valueLogBodySize + maxKeyLength + maxLoggedValueLength + 64
+	// valueLogSegmentSize - Size past which values go to a new segment
+	valueLogSegmentSize = 64 << 20
+	// maxLoggedValueLength - Longest value a database with a value log takes
+	maxLoggedValueLength = 1 << 20
+)
+
+// valueLogData - Additional data of sealed value log records
+var valueLogData = []byte("KVDB value log")
+
+var errCorruptValueLog = errors.New("corrupt value log")
+
+// valueRef - Where a value sits in the log
+type valueRef struct {
+	segment uint32
+	offset  int64
+	length  uint32
+}
+
+func (r valueRef) encode() string {
+	buffer := make([]byte, valueRefSize)
+	binary.LittleEndian.PutUint32(buffer, r.segment)
+	binary.LittleEndian.PutUint64(buffer[4:], uint64(r.offset))
+	binary.LittleEndian.PutUint32(buffer[12:], r.length)
+	return string(buffer)
+}
+
+func decodeValueRef(pointer string) (valueRef, error) {
+	if len(pointer) != valueRefSize {
+		return valueRef{}, errCorruptValueLog
+	}
+	buffer := []byte(pointer)
+	return valueRef{
+		segment: binary.LittleEndian.Uint32(buffer),
+		offset:  int64(binary.LittleEndian.Uint64(buffer[4:])),
+		length:  binary.LittleEndian.Uint32(buffer[12:]),
+	}, nil
+}
+
+// newLoggedPair - Pair holding a pointer to its value in the log
+func newLoggedPair(key string, ref valueRef) *Pairs {
+	pair := NewPair(key, ref.encode())
+	pair.ValueLen |= valueLogged
+	return pair
+}
+
+// valueRecord - A value as stored in the log
+type valueRecord struct {
+	ref    valueRef
+	rootID uint64
+	key    string
+	value  string
+}
+
+// valueLog - Segments of the value log of a file
+type valueLog struct {
+	path   string
+	cipher cipher.AEAD
+	// threshold - Values longer than it are appended to the log
+	threshold    int
+	readOnly     bool
+	syncMode     SyncMode
+	syncInterval time.Duration
+	// segments - Open segment files by number
+	segments map[uint32]*os.File
+	// active - Segment values are appended to, 0 until the first one is created
+	active uint32
+	// size - End of the active segment
+	size int64
+
+	// mu - Guards syncer, commits use it outside the lock of the database
+	mu     sync.RWMutex
+	syncer *Syncer
+}
+
+func valueLogSegmentPath(path string, segment uint32) string {
+	return fmt.Sprintf("%s%s%06d", path, valueLogSuffix, segment)
+}
+
+// valueLogSegments - Numbers of the segments of the log of the file at path, in order
+func valueLogSegments(path string) ([]uint32, error) {
+	matches, err := filepath.Glob(path + valueLogSuffix + "*")
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint32
+	for _, match := range matches {
+		segment, err := strconv.ParseUint(strings.TrimPrefix(match, path+valueLogSuffix), 10, 32)
+		if err != nil || segment == 0 {
+			// Not a segment, like a segment being rewritten by RotateKey
+			continue
+		}
+		segments = append(segments, uint32(segment))
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// openValueLog - Opens the segments of the log of the file at path. Segments are created
+// by the first value long enough to need one.
+func openValueLog(path string, o *options, format pageFormat) (*valueLog, error) {
+	segments, err := valueLogSegments(path)
+	if err != nil {
+		return nil, err
+	}
+	log := &valueLog{path: path, cipher: format.cipher, threshold: o.valueThreshold, readOnly: o.readOnly,
+		syncMode: o.syncMode, syncInterval: o.syncInterval, segments: make(map[uint32]*os.File)}
+	if log.threshold < 0 || log.threshold > maxValueLength {
+		log.threshold = maxValueLength
+	}
+	for i, segment := range segments {
+		flag := os.O_RDONLY
+		if i == len(segments)-1 && !o.readOnly {
+			flag = os.O_RDWR
+		}
+		file, err := os.OpenFile(valueLogSegmentPath(path, segment), flag, 0666)
+		if err != nil {
+			log.close()
+			return nil, err
+		}
+		log.segments[segment] = file
+		log.active = segment
+	}
+	if log.active == 0 || o.readOnly {
+		return log, nil
+	}
+	// Cut off what a crash left of the last record
+	log.size = int64(len(valueLogMagic))
+	err = log.records(log.active, func(record valueRecord) error {
+		log.size = record.ref.offset + valueLogRecordSize + int64(record.ref.length)
+		return nil
+	})
+	if err == nil {
+		err = log.segments[log.active].Truncate(log.size)
+	}
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+	log.syncer = NewSyncer(log.segments[log.active], log.syncMode, log.syncInterval)
+	return log, nil
+}
+
+// rotate - Starts a new segment, syncing the one values were appended to so far
+func (log *valueLog) rotate() error {
+	segment := log.active + 1
+	file, err := os.OpenFile(valueLogSegmentPath(log.path, segment), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(valueLogMagic); err != nil {
+		file.Close()
+		return err
+	}
+	log.mu.Lock()
+	old := log.syncer
+	log.syncer = NewSyncer(file, log.syncMode, log.syncInterval)
+	log.mu.Unlock()
+	if old != nil {
+		// Commits waiting on the old segment are covered by its last sync
+		if err := old.Close(); err != nil {
+			return err
+		}
+	}
+	log.segments[segment] = file
+	log.active = segment
+	log.size = int64(len(valueLogMagic))
+	return nil
+}
+
+// append - Appends the value of the key to the log
+func (log *valueLog) append(rootID uint64, key string, value string) (valueRef, error) {
+	if log.readOnly {
+		return valueRef{}, ErrReadOnly
+	}
+	if log.active == 0 || log.size >= valueLogSegmentSize {
+		if err := log.rotate(); err != nil {
+			return valueRef{}, err
+		}
+	}
+	buffer, err := encodeValueRecord(log.cipher, rootID, key, value)
+	if err != nil {
+		return valueRef{}, err
+	}
+	if _, err := log.segments[log.active].WriteAt(buffer, log.size); err != nil {
+		return valueRef{}, err
+	}
+	ref := valueRef{segment: log.active, offset: log.size, length: uint32(len(buffer) - valueLogRecordSize)}
+	log.size += int64(len(buffer))
+	return ref, nil
+}
+
+// encodeValueRecord - The record of the value of the key
+func encodeValueRecord(aead cipher.AEAD, rootID uint64, key string, value string) ([]byte, error) {
+	body := make([]byte, valueLogBodySize, valueLogBodySize+len(key)+len(value))
+	binary.LittleEndian.PutUint64(body, rootID)
+	binary.LittleEndian.PutUint16(body[8:], uint16(len(key)))
+	body = append(append(body, key...), value...)
+	if aead != nil {
+		var err error
+		if body, err = sealPayload(aead, body, valueLogData); err != nil {
+			return nil, err
+		}
+	}
+	buffer := make([]byte, valueLogRecordSize, valueLogRecordSize+len(body))
+	binary.LittleEndian.PutUint32(buffer, uint32(len(body)))
+	binary.LittleEndian.PutUint32(buffer[4:], crc32.ChecksumIEEE(body))
+	return append(buffer, body...), nil
+}
+
+// decode - Reads back the body of a record
+func (log *valueLog) decode(ref valueRef, body []byte) (valueRecord, error) {
+	if log.cipher != nil {
+		opened, err := openPayload(log.cipher, body, valueLogData)
+		if err != nil {
+			return valueRecord{}, ErrInvalidMasterKey
+		}
+		body = opened
+	}
+	if len(body) < valueLogBodySize {
+		return valueRecord{}, errCorruptValueLog
+	}
+	keyLen := int(binary.LittleEndian.Uint16(body[8:]))
+	if valueLogBodySize+keyLen > len(body) {
+		return valueRecord{}, errCorruptValueLog
+	}
+	return valueRecord{
+		ref:    ref,
+		rootID: binary.LittleEndian.Uint64(body),
+		key:    string(body[valueLogBodySize : valueLogBodySize+keyLen]),
+		value:  string(body[valueLogBodySize+keyLen:]),
+	}, nil
+}
+
+// read - The record the pointer leads to
+func (log *valueLog) read(ref valueRef) (valueRecord, error) {
+	file, found := log.segments[ref.segment]
+	if !found || ref.length > valueLogMaxBody {
+		return valueRecord{}, fmt.Errorf("%w: no record at %d in segment %d", errCorruptValueLog, ref.offset, ref.segment)
+	}
+	buffer := make([]byte, valueLogRecordSize+int(ref.length))
+	if _, err := file.ReadAt(buffer, ref.offset); err != nil {
+		return valueRecord{}, fmt.Errorf("%w: reading segment %d: %v", errCorruptValueLog, ref.segment, err)
+	}
+	body := buffer[valueLogRecordSize:]
+	if binary.LittleEndian.Uint32(buffer) != ref.length || crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(buffer[4:]) {
+		return valueRecord{}, fmt.Errorf("%w: bad record at %d in segment %d", errCorruptValueLog, ref.offset, ref.segment)
+	}
+	return log.decode(ref, body)
+}
+
+// value - The value of a pair whose value was written to the log
+func (log *valueLog) value(pair *Pairs) (string, error) {
+	ref, err := decodeValueRef(pair.Value)
+	if err != nil {
+		return "", err
+	}
+	record, err := log.read(ref)
+	if err != nil {
+		return "", err
+	}
+	if record.key != pair.Key {
+		return "", fmt.Errorf("%w: record at %d in segment %d belongs to %q", errCorruptValueLog, ref.offset, ref.segment, record.key)
+	}
+	return record.value, nil
+}
+
+// records - Calls fn with the records of the segment in order, stopping at the first one
+// that is torn
+func (log *valueLog) records(segment uint32, fn func(record valueRecord) error) error {
+	file := log.segments[segment]
+	reader := bufio.NewReader(io.NewSectionReader(file, 0, 1<<62))
+	magic := make([]byte, len(valueLogMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, valueLogMagic) {
+		return fmt.Errorf("%w: segment %d", errCorruptValueLog, segment)
+	}
+	offset := int64(len(valueLogMagic))
+	prefix := make([]byte, valueLogRecordSize)
+	for {
+		if _, err := io.ReadFull(reader, prefix); err != nil {
+			return nil
+		}
+		length := binary.LittleEndian.Uint32(prefix)
+		if length < valueLogBodySize || length > valueLogMaxBody {
+			return nil
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil
+		}
+		if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(prefix[4:]) {
+			return nil
+		}
+		record, err := log.decode(valueRef{segment: segment, offset: offset, length: length}, body)
+		if err != nil {
+			// The checksum held, the record was sealed with another key
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		offset += valueLogRecordSize + int64(length)
+	}
+}
+
+// segmentNumbers - Numbers of the open segments, in order
+func (log *valueLog) segmentNumbers() []uint32 {
+	segments := make([]uint32, 0, len(log.segments))
+	for segment := range log.segments {
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments
+}
+
+// bytes - Size of every segment of the log
+func (log *valueLog) bytes() (int64, error) {
+	var size int64
+	for _, file := range log.segments {
+		fi, err := file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		size += fi.Size()
+	}
+	return size, nil
+}
+
+// commit - Makes the values appended so far as durable as the sync mode promises
+func (log *valueLog) commit() error {
+	log.mu.RLock()
+	defer log.mu.RUnlock()
+	if log.syncer == nil {
+		return nil
+	}
+	return log.syncer.Commit()
+}
+
+func (log *valueLog) close() error {
+	var err error
+	if log.syncer != nil {
+		err = log.syncer.Close()
+	}
+	for _, file := range log.segments {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// valueLog - The value log of the file backing the tree, nil when it has none
+func (bt *btree) valueLog() *valueLog {
+	if bt.inMemory() {
+		return nil
+	}
+	return bt.blockService.vlog
+}
+
+// valueLimit - Longest value the tree takes. Trees kept in memory have no pages to fit
+// values in and files with a header move long values to the value log.
+func (bt *btree) valueLimit() int {
+	if bt.inMemory() || bt.blockService.header != nil {
+		return maxLoggedValueLength
+	}
+	return maxValueLength
+}
+
+// logValue - The pair to store for the given one, with its value moved to the log when it
+// is longer than the threshold
+func (bt *btree) logValue(pair *Pairs) (*Pairs, error) {
+	log := bt.valueLog()
+	if log == nil || pair.logged() || len(pair.Value) <= log.threshold {
+		return pair, nil
+	}
+	ref, err := log.append(bt.rootID, pair.Key, pair.Value)
+	if err != nil {
+		return nil, err
+	}
+	return newLoggedPair(pair.Key, ref), nil
+}
+
+// resolve - The pair with its value read back from the log when it was written there
+func (bt *btree) resolve(pair *Pairs) (*Pairs, error) {
+	if pair == nil || !pair.logged() {
+		return pair, nil
+	}
+	log := bt.valueLog()
+	if log == nil {
+		return nil, fmt.Errorf("%w: pair %q points into a value log the file has none of", errCorruptValueLog, pair.Key)
+	}
+	value, err := log.value(pair)
+	if err != nil {
+		return nil, err
+	}
+	return NewPair(pair.Key, value), nil
+}
+
+// validate - Checks the pair fits in the database
+func (db *DB) validate(pair *Pairs) error {
+	return validatePair(pair, db.storage.valueLimit())
+}
+
+// ValidatePair - Checks the pair fits in a database created by Open, for stores that want
+// to take the same pairs
+func ValidatePair(key string, value string) error {
+	return validatePair(NewPair(key, value), maxLoggedValueLength)
+}
+
+func validatePair(pair *Pairs, limit int) error {
+	if err := NewPair(pair.Key, "").Validate(); err != nil {
+		return err
+	}
+	if pair.Value == "" {
+		return ErrEmptyValue
+	}
+	if len(pair.Value) > limit {
+		return fmt.Errorf("value length should not be more than %d, currently it is %d", limit, len(pair.Value))
+	}
+	return nil
+}
+
+/**
+VALUE LOG COLLECTION
+	The newest segment is closed first so that every segment holding values can be
+	collected, then for each of them in order:
+		1. Read every record and look its key up in the tree of its root block. The record
+		   is live while the pair of the key still points at it.
+		2. Keep the segment as it is when less than minGarbage of its bytes are garbage
+		3. Otherwise append the live values to the newest segment and point their pairs at
+		   the copies
+	The collected segments are deleted once the copies and the tree are synced, a crash
+	before that leaves both copies with the pairs pointing at either of them.
+*/
+
+// ValueLogReport - Outcome of CollectValueLog
+type ValueLogReport struct {
+	// Segments - Segments deleted, their live values were moved to the newest one
+	Segments    int `json:"segments"`
+	MovedValues int `json:"moved_values"`
+	// ReclaimedBytes - Size of the deleted segments less the size of the moved values
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+// collectValueLog - Rewrites the live values of the segments holding at least minGarbage
+// garbage into the newest segment and deletes them
+func (bt *btree) collectValueLog(minGarbage float64) (*ValueLogReport, error) {
+	report := &ValueLogReport{}
+	log := bt.valueLog()
+	if log == nil || log.active == 0 {
+		return report, nil
+	}
+	trees := map[uint64]*btree{bt.rootID: bt}
+	for _, tree := range bt.buckets {
+		trees[tree.rootID] = tree
+	}
+	segments := log.segmentNumbers()
+	if log.size > int64(len(valueLogMagic)) {
+		if err := log.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var collected []uint32
+	for _, segment := range segments {
+		if segment == log.active {
+			continue
+		}
+		fi, err := log.segments[segment].Stat()
+		if err != nil {
+			return nil, err
+		}
+		var live []valueRecord
+		var liveBytes int64
+		err = log.records(segment, func(record valueRecord) error {
+			tree, found := trees[record.rootID]
+			if !found {
+				// The bucket was dropped
+				return nil
+			}
+			pair, err := tree.root.floor(record.key)
+			if err != nil {
+				return err
+			}
+			if pair == nil || pair.Key != record.key || !pair.logged() || pair.Value != record.ref.encode() {
+				return nil
+			}
+			live = append(live, record)
+			liveBytes += valueLogRecordSize + int64(record.ref.length)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if float64(fi.Size()-liveBytes) < minGarbage*float64(fi.Size()) {
+			continue
+		}
+		for _, record := range live {
+			ref, err := log.append(record.rootID, record.key, record.value)
+			if err != nil {
+				return nil, err
+			}
+			if err := trees[record.rootID].insert(newLoggedPair(record.key, ref)); err != nil {
+				return nil, err
+			}
+			report.MovedValues++
+		}
+		collected = append(collected, segment)
+		report.Segments++
+		report.ReclaimedBytes += fi.Size() - liveBytes
+	}
+	if len(collected) == 0 {
+		return report, nil
+	}
+
+	// The copies and the pairs pointing at them must be on disk before the old records go
+	if err := log.segments[log.active].Sync(); err != nil {
+		return nil, err
+	}
+	if err := bt.blockService.file.Sync(); err != nil {
+		return nil, err
+	}
+	for _, segment := range collected {
+		log.segments[segment].Close()
+		delete(log.segments, segment)
+		if err := os.Remove(valueLogSegmentPath(log.path, segment)); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// CollectValueLog - Reclaims the space of overwritten and deleted values in the value log.
+// Every segment where at least minGarbage (0 to 1) of the bytes are no longer referenced
+// has its live values moved to the newest segment and is deleted. Writes wait while the
+// log is collected.
+func (db *DB) CollectValueLog(minGarbage float64) (*ValueLogReport, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.storage.inMemory() {
+		return nil, ErrInMemory
+	}
+	if db.storage.readOnly() {
+		return nil, ErrReadOnly
+	}
+	if db.storage.blockService.header == nil {
+		return nil, ErrLegacyFile
+	}
+	return db.storage.collectValueLog(minGarbage)
+}
+
+// resealValueLog - Writes every segment of the log of the file at path sealed with
+// another data key next to it, and returns the names of the files written even on
+// failure. Sealing adds the nonce and the tag to a record, so a rotation adding or
+// removing encryption moves the records, the moved ones are returned by their old place.
+func resealValueLog(path string, from cipher.AEAD, to cipher.AEAD) ([]string, map[valueRef]valueRef, error) {
+	log, err := openValueLog(path, &options{readOnly: true, valueThreshold: maxValueLength}, pageFormat{cipher: from})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer log.close()
+	var written []string
+	moved := make(map[valueRef]valueRef)
+	for _, segment := range log.segmentNumbers() {
+		buffer := append([]byte(nil), valueLogMagic...)
+		err := log.records(segment, func(record valueRecord) error {
+			encoded, err := encodeValueRecord(to, record.rootID, record.key, record.value)
+			if err != nil {
+				return err
+			}
+			ref := valueRef{segment: segment, offset: int64(len(buffer)), length: uint32(len(encoded) - valueLogRecordSize)}
+			if ref != record.ref {
+				moved[record.ref] = ref
+			}
+			buffer = append(buffer, encoded...)
+			return nil
+		})
+		if err != nil {
+			return written, nil, err
+		}
+		tmpPath := valueLogSegmentPath(path, segment) + rotateSuffix
+		written = append(written, tmpPath)
+		if err := writeFileSync(tmpPath, buffer); err != nil {
+			return written, nil, err
+		}
+	}
+	return written, moved, nil
+}
+
+// moveValueRefs - The page with the pointers of its pairs to moved records updated, the
+// page itself when none of them moved
+func (bs *BlockService) moveValueRefs(page []byte, moved map[valueRef]valueRef) ([]byte, error) {
+	block, err := bs.decodeBlock(page)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	for _, pair := range block.DataSet {
+		if !pair.logged() {
+			continue
+		}
+		ref, err := decodeValueRef(pair.Value)
+		if err != nil {
+			return nil, err
+		}
+		if to, found := moved[ref]; found {
+			pair.Value = to.encode()
+			changed = true
+		}
+	}
+	if !changed {
+		return page, nil
+	}
+	return bs.encodeBlock(block)
+}
@@ -0,0 +1,249 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// clearValueLogDB - Like clearNamedDB, also removing the segments of the value log
+func clearValueLogDB(name string) string {
+	path := clearFilteredDB(name)
+	segments, _ := valueLogSegments(path)
+	for _, segment := range segments {
+		os.Remove(valueLogSegmentPath(path, segment))
+	}
+	return path
+}
+
+// largeValue - A value of the given length that tells keys apart
+func largeValue(key string, length int) string {
+	return (key + strings.Repeat("*", length))[:length]
+}
+
+func TestValueLog(t *testing.T) {
+	path := clearValueLogDB("vlog.db")
+	snapshotPath := clearValueLogDB("vlog_snapshot.db")
+	db, err := Open(path, WithValueLog(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{
+		"inline":  "short value",
+		"logged":  largeValue("logged", 40),
+		"page":    largeValue("page", 200),
+		"large":   largeValue("large", 100000),
+		"largest": largeValue("largest", maxLoggedValueLength),
+	}
+	for key, value := range values {
+		if err := db.Put(key, value); err != nil {
+			t.Fatal(key, err)
+		}
+	}
+	if err := db.Put("too-large", largeValue("too-large", maxLoggedValueLength+1)); err == nil {
+		t.Error("A value longer than the log takes should be refused")
+	}
+	db.CreateBucket("things")
+	bucket, _ := db.Bucket("things")
+	bucket.Put("page", largeValue("thing", 300))
+
+	check := func(db *DB) {
+		t.Helper()
+		for key, value := range values {
+			if stored, found, err := db.Get(key); err != nil || !found || stored != value {
+				t.Fatal("Get should read the value back", key, len(stored), err)
+			}
+		}
+		scanned := 0
+		db.Scan("", "", func(key string, value string) bool {
+			if value != values[key] {
+				t.Error("Scan should read the value back", key, len(value))
+			}
+			scanned++
+			return true
+		})
+		if scanned != len(values) {
+			t.Error("Scan should visit every key", scanned)
+		}
+		if key, value, _, err := db.Floor("pagf"); err != nil || key != "page" || value != values["page"] {
+			t.Error("Floor should read the value back", key, len(value), err)
+		}
+		bucket, _ := db.Bucket("things")
+		if value, _, _ := bucket.Get("page"); value != largeValue("thing", 300) {
+			t.Error("Buckets have values in the log too", len(value))
+		}
+	}
+	check(db)
+	stats, err := db.Stats()
+	if err != nil || stats.LoggedValues != 5 || stats.ValueLogSegments != 1 || stats.ValueLogBytes < 1100000 {
+		t.Error("Values past the threshold should be logged", stats.LoggedValues, stats.ValueLogSegments, stats.ValueLogBytes, err)
+	}
+	if err := db.Snapshot(snapshotPath); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for _, path := range []string{path, snapshotPath} {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(db)
+		if report, err := db.Check(); err != nil || !report.OK {
+			t.Error("Pointers into the log should check", report, err)
+		}
+		db.Close()
+	}
+
+	memory := OpenMemory()
+	defer memory.Close()
+	if err := memory.Put("large", values["large"]); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := memory.Get("large"); value != values["large"] {
+		t.Error("A database kept in memory holds long values as they are")
+	}
+}
+
+func TestCollectValueLog(t *testing.T) {
+	path := clearValueLogDB("vlog_collect.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(i int) string { return fmt.Sprintf("key-%03d", i) }
+	for i := 0; i < 100; i++ {
+		db.Put(key(i), largeValue(key(i), 1000))
+	}
+	for i := 0; i < 80; i++ {
+		db.Put(key(i), largeValue("new-"+key(i), 1000))
+	}
+	for i := 90; i < 100; i++ {
+		db.Delete(key(i))
+	}
+	before, _ := db.Stats()
+
+	report, err := db.CollectValueLog(0.9)
+	if err != nil || report.Segments != 0 {
+		t.Fatal("A segment with less garbage than asked for should be kept", report, err)
+	}
+	report, err = db.CollectValueLog(0.5)
+	if err != nil || report.Segments != 1 || report.MovedValues != 90 {
+		t.Fatal("The first segment should be collected", report, err)
+	}
+	after, _ := db.Stats()
+	if after.ValueLogSegments != 1 || after.ValueLogBytes >= before.ValueLogBytes || after.ValueLogBytes+report.ReclaimedBytes != before.ValueLogBytes+int64(len(valueLogMagic)) {
+		t.Error("Collection should reclaim the garbage", before.ValueLogBytes, after.ValueLogBytes, report.ReclaimedBytes)
+	}
+	check := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			value, found, err := db.Get(key(i))
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case i < 80 && value != largeValue("new-"+key(i), 1000):
+				t.Fatal("Moved values should be the latest ones", i)
+			case i >= 80 && i < 90 && value != largeValue(key(i), 1000):
+				t.Fatal("Values never overwritten should be moved", i)
+			case i >= 90 && found:
+				t.Fatal("Deleted keys should stay deleted", i)
+			}
+		}
+	}
+	check(db)
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+	if report, err := db.Check(); err != nil || !report.OK {
+		t.Error("Every pointer should lead into the remaining segment", report, err)
+	}
+}
+
+func TestValueLogEncrypted(t *testing.T) {
+	path := clearValueLogDB("vlog_encrypted.db")
+	db, err := Open(path, WithEncryptionKey(testMasterKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := largeValue("secret-value", 500)
+	db.Put("key", secret)
+	db.Close()
+
+	segment, err := os.ReadFile(valueLogSegmentPath(path, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(segment, []byte("secret-value")) {
+		t.Error("The value log of an encrypted database should be sealed")
+	}
+	if err := RotateKey(path, testMasterKey, otherMasterKey); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path, WithEncryptionKey(otherMasterKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if value, _, err := db.Get("key"); err != nil || value != secret {
+		t.Error("The value log should survive a key rotation", len(value), err)
+	}
+}
+
+func TestValueLogEncryptionAddedAndRemoved(t *testing.T) {
+	path := clearValueLogDB("vlog_rotate.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(i int) string { return fmt.Sprintf("key-%03d", i) }
+	for i := 0; i < 50; i++ {
+		if err := db.Put(key(i), largeValue(key(i), 100+i*20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.CreateBucket("things")
+	bucket, _ := db.Bucket("things")
+	bucket.Put("thing", largeValue("thing", 300))
+	db.Close()
+
+	check := func(masterKey []byte) {
+		t.Helper()
+		var opts []Option
+		if masterKey != nil {
+			opts = append(opts, WithEncryptionKey(masterKey))
+		}
+		db, err := Open(path, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		for i := 0; i < 50; i++ {
+			if value, _, err := db.Get(key(i)); err != nil || value != largeValue(key(i), 100+i*20) {
+				t.Fatal("Logged values should be read back after the rotation", i, len(value), err)
+			}
+		}
+		bucket, _ := db.Bucket("things")
+		if value, _, err := bucket.Get("thing"); err != nil || value != largeValue("thing", 300) {
+			t.Error("Logged values of buckets should be read back after the rotation", len(value), err)
+		}
+		if report, err := db.Check(); err != nil || !report.OK {
+			t.Error("Pointers into the log should check", report, err)
+		}
+	}
+	if err := RotateKey(path, nil, testMasterKey); err != nil {
+		t.Fatal(err)
+	}
+	check(testMasterKey)
+	if err := RotateKey(path, testMasterKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(nil)
+}
@@ -0,0 +1,21 @@
+package lsm
+
+// Batch - Puts and deletes applied together by DB.Write
+type Batch struct {
+	entries []entry
+}
+
+// Put - Queue a key value pair to be inserted
+func (b *Batch) Put(key string, value string) {
+	b.entries = append(b.entries, entry{key: key, value: value})
+}
+
+// Delete - Queue a key to be removed
+func (b *Batch) Delete(key string) {
+	b.entries = append(b.entries, entry{key: key, deleted: true})
+}
+
+// Len - Number of queued operations
+func (b *Batch) Len() int {
+	return len(b.entries)
+}
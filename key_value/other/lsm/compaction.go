@@ -0,0 +1,157 @@
+package lsm
+
+import (
+	"os"
+	"sort"
+)
+
+/**
+LEVELED COMPACTION
+	Level 0 receives the flushed tables, whose key ranges overlap. Every deeper level holds
+	tables with disjoint ranges and may grow to ten times the size of the level above it.
+		1. Once level 0 has l0Trigger tables, all of them are merged with the tables of level
+		   1 they overlap into new level 1 tables
+		2. Otherwise the first level over its size picks its next table, taking turns through
+		   the key space, and merges it with the tables it overlaps one level down
+	The merge keeps the newest entry of every key and starts a new table every tableSize
+	bytes. Tombstones are dropped once nothing deeper can hold an older version of the key.
+	Compactions repeat until every level is within bounds.
+*/
+
+// compaction - Tables merged into the next level
+type compaction struct {
+	level  int
+	inputs []*table
+	next   []*table
+}
+
+func levelSize(tables []*table) uint64 {
+	var size uint64
+	for _, t := range tables {
+		size += t.meta.Size
+	}
+	return size
+}
+
+// maxLevelSize - Bytes level may hold before it is compacted, for levels 1 and deeper
+func (db *DB) maxLevelSize(level int) uint64 {
+	size := db.o.baseLevelSize
+	for i := 1; i < level; i++ {
+		size *= 10
+	}
+	return size
+}
+
+// overlapping - Tables of the level whose range intersects [smallest, largest]
+func (db *DB) overlapping(level int, smallest string, largest string) []*table {
+	var tables []*table
+	for _, t := range db.levels[level] {
+		if t.meta.Largest >= smallest && t.meta.Smallest <= largest {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// pickCompaction - Returns the next compaction to run, nil when every level is in bounds
+func (db *DB) pickCompaction() *compaction {
+	if len(db.levels[0]) >= db.o.l0Trigger {
+		c := &compaction{level: 0, inputs: append([]*table(nil), db.levels[0]...)}
+		smallest, largest := c.inputs[0].meta.Smallest, c.inputs[0].meta.Largest
+		for _, t := range c.inputs {
+			if t.meta.Smallest < smallest {
+				smallest = t.meta.Smallest
+			}
+			if t.meta.Largest > largest {
+				largest = t.meta.Largest
+			}
+		}
+		c.next = db.overlapping(1, smallest, largest)
+		return c
+	}
+	for level := 1; level < numLevels-1; level++ {
+		tables := db.levels[level]
+		if levelSize(tables) <= db.maxLevelSize(level) {
+			continue
+		}
+		// Take the first table after the one compacted last time round
+		picked := tables[0]
+		for _, t := range tables {
+			if t.meta.Smallest > db.compactPointer[level] {
+				picked = t
+				break
+			}
+		}
+		return &compaction{
+			level:  level,
+			inputs: []*table{picked},
+			next:   db.overlapping(level+1, picked.meta.Smallest, picked.meta.Largest),
+		}
+	}
+	return nil
+}
+
+// compact - Runs compactions until every level is in bounds, must be called with writeMu held
+func (db *DB) compact() error {
+	for c := db.pickCompaction(); c != nil; c = db.pickCompaction() {
+		if err := db.runCompaction(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) runCompaction(c *compaction) error {
+	// Newer data first: level 0 from its newest table, then the level below
+	var inputs []iterator
+	for i := len(c.inputs) - 1; i >= 0; i-- {
+		inputs = append(inputs, c.inputs[i].iterator(""))
+	}
+	for _, t := range c.next {
+		inputs = append(inputs, t.iterator(""))
+	}
+	dropTombstones := true
+	for level := c.level + 2; level < numLevels; level++ {
+		if len(db.levels[level]) > 0 {
+			dropTombstones = false
+		}
+	}
+	outputs, err := db.writeTables(newMergingIterator(inputs), dropTombstones, true)
+	if err != nil {
+		return err
+	}
+
+	obsolete := make(map[*table]bool)
+	for _, t := range append(append([]*table(nil), c.inputs...), c.next...) {
+		obsolete[t] = true
+	}
+	db.mu.Lock()
+	for _, level := range []int{c.level, c.level + 1} {
+		var kept []*table
+		for _, t := range db.levels[level] {
+			if !obsolete[t] {
+				kept = append(kept, t)
+			}
+		}
+		db.levels[level] = kept
+	}
+	next := append(db.levels[c.level+1], outputs...)
+	sort.Slice(next, func(i, j int) bool { return next[i].meta.Smallest < next[j].meta.Smallest })
+	db.levels[c.level+1] = next
+	if c.level > 0 {
+		db.compactPointer[c.level] = c.inputs[len(c.inputs)-1].meta.Largest
+	}
+	err = db.saveManifest()
+	db.compactions++
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// No reader can still be using the merged tables, they read with mu held
+	for t := range obsolete {
+		t.close()
+		os.Remove(tableName(db.dir, t.meta.Num))
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+// Package lsm implements a log-structured merge tree storage engine for write heavy
+// databases. Writes go to a log and a sorted memtable, full memtables are flushed to
+// immutable sorted tables which are merged level by level. The write filling the memtable
+// runs the flush and the compactions it calls for before returning.
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+// numLevels - Level 0 holds flushed tables, which may overlap, every deeper level holds
+// tables with disjoint key ranges
+const numLevels = 7
+
+var (
+	ErrClosed      = helper.ErrClosed
+	ErrEmptyKey    = errors.New("key must not be empty")
+	ErrKeyTooLong  = fmt.Errorf("key must not be more than %d bytes", maxStringLength)
+	ErrValueTooBig = fmt.Errorf("value must not be more than %d bytes", maxStringLength)
+)
+
+// DB - Handle of an LSM database directory. It is safe for concurrent use, writes are
+// serialized while reads run in parallel.
+type DB struct {
+	dir  string
+	o    *options
+	lock *os.File
+
+	// writeMu - Serializes writes along with the flushes and compactions they trigger.
+	// Only its holder changes the tables and the manifest.
+	writeMu sync.Mutex
+
+	// mu - Guards what readers look at, the memtables, the log and the levels
+	mu       sync.RWMutex
+	mem      *memtable
+	imm      *memtable
+	log      *wal
+	levels   [][]*table
+	manifest *manifest
+	closed   bool
+
+	flushes        uint64
+	compactions    uint64
+	compactPointer [numLevels]string
+}
+
+/**
+OPENING A DATABASE
+	1. Lock the directory through its LOCK file
+	2. Load the manifest and open the tables it lists, removing the files it doesn't list
+	   which were left behind by an interrupted flush or compaction
+	3. Replay the logs the manifest doesn't consider flushed into a memtable and flush it
+	4. Start a fresh log for the new writes
+*/
+
+// Open - Opens the database in the directory, creating it when needed
+func Open(dir string, opts ...Option) (*DB, error) {
+	o := buildOptions(opts)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, "LOCK"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := helper.LockFile(lock, true, o.lockTimeout); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	db := &DB{dir: dir, o: o, lock: lock, mem: newMemtable(), levels: make([][]*table, numLevels)}
+	if err := db.recover(); err != nil {
+		db.closeTables()
+		lock.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) recover() error {
+	m, err := loadManifest(db.dir)
+	if err != nil {
+		return err
+	}
+	db.manifest = m
+	live := make(map[uint64]bool)
+	for level, metas := range m.Levels {
+		for _, meta := range metas {
+			t, err := openTable(tableName(db.dir, meta.Num), meta)
+			if err != nil {
+				return err
+			}
+			db.levels[level] = append(db.levels[level], t)
+			live[meta.Num] = true
+		}
+	}
+
+	files, err := os.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+	var logs []uint64
+	for _, file := range files {
+		name := file.Name()
+		num, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSuffix(name, ".sst"), ".wal"), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(name, ".sst") && !live[num]:
+			os.Remove(filepath.Join(db.dir, name))
+		case strings.HasSuffix(name, ".wal") && num < m.LogNum:
+			os.Remove(filepath.Join(db.dir, name))
+		case strings.HasSuffix(name, ".wal"):
+			logs = append(logs, num)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+	for _, num := range logs {
+		err := replayWAL(walName(db.dir, num), func(entries []entry) {
+			for _, e := range entries {
+				db.mem.put(e)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if num >= m.NextFile {
+			m.NextFile = num + 1
+		}
+	}
+
+	num := db.nextFile()
+	db.log, err = createWAL(walName(db.dir, num), num, db.o.syncMode, db.o.syncInterval)
+	if err != nil {
+		return err
+	}
+	if db.mem.count > 0 {
+		outputs, err := db.writeTables(db.mem.iterator(""), false, false)
+		if err != nil {
+			return err
+		}
+		db.levels[0] = append(db.levels[0], outputs...)
+		db.mem = newMemtable()
+	}
+	m.LogNum = db.log.num
+	if err := db.saveManifest(); err != nil {
+		return err
+	}
+	for _, num := range logs {
+		os.Remove(walName(db.dir, num))
+	}
+	return nil
+}
+
+// nextFile - Allocates the number of a new table or log
+func (db *DB) nextFile() uint64 {
+	num := db.manifest.NextFile
+	db.manifest.NextFile++
+	return num
+}
+
+// saveManifest - Records the current levels in the manifest
+func (db *DB) saveManifest() error {
+	for level, tables := range db.levels {
+		metas := make([]tableMeta, len(tables))
+		for i, t := range tables {
+			metas[i] = t.meta
+		}
+		db.manifest.Levels[level] = metas
+	}
+	return db.manifest.save(db.dir)
+}
+
+// writeTables - Writes the entries of the iterator to new tables, starting a new table
+// every tableSize bytes when split is set. Tombstones are left out when dropTombstones is
+// set, nothing older can be hiding under them.
+func (db *DB) writeTables(it iterator, dropTombstones bool, split bool) ([]*table, error) {
+	var tables []*table
+	var tw *tableWriter
+	var meta tableMeta
+	finish := func() error {
+		err := tw.finish(db.o.bitsPerKey)
+		if err != nil {
+			return err
+		}
+		meta.Smallest, meta.Largest = tw.smallest, tw.largest
+		meta.Size, meta.Entries = tw.size(), uint64(len(tw.keys))
+		t, err := openTable(tableName(db.dir, meta.Num), meta)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, t)
+		tw = nil
+		return nil
+	}
+	abandon := func(err error) ([]*table, error) {
+		if tw != nil {
+			tw.abandon()
+		}
+		for _, t := range tables {
+			t.close()
+			os.Remove(tableName(db.dir, t.meta.Num))
+		}
+		return nil, err
+	}
+
+	for it.next() {
+		e := it.current()
+		if e.deleted && dropTombstones {
+			continue
+		}
+		if tw == nil {
+			meta = tableMeta{Num: db.nextFile()}
+			var err error
+			if tw, err = createTable(tableName(db.dir, meta.Num)); err != nil {
+				return abandon(err)
+			}
+		}
+		if err := tw.add(e); err != nil {
+			return abandon(err)
+		}
+		if split && tw.size() >= db.o.tableSize {
+			if err := finish(); err != nil {
+				return abandon(err)
+			}
+		}
+	}
+	if err := it.err(); err != nil {
+		return abandon(err)
+	}
+	if tw != nil {
+		if err := finish(); err != nil {
+			return abandon(err)
+		}
+	}
+	return tables, nil
+}
+
+func validateEntry(e entry) error {
+	switch {
+	case e.key == "":
+		return ErrEmptyKey
+	case len(e.key) > maxStringLength:
+		return ErrKeyTooLong
+	case len(e.value) > maxStringLength:
+		return ErrValueTooBig
+	}
+	return nil
+}
+
+// write - Logs the entries, applies them to the memtable and flushes it once full
+func (db *DB) write(entries []entry) error {
+	for _, e := range entries {
+		if err := validateEntry(e); err != nil {
+			return err
+		}
+	}
+	db.writeMu.Lock()
+	if db.closed {
+		db.writeMu.Unlock()
+		return ErrClosed
+	}
+	return db.apply(entries)
+}
+
+// apply - The second half of write, must be called with writeMu held which it releases
+func (db *DB) apply(entries []entry) error {
+	log := db.log
+	if err := log.append(entries); err != nil {
+		db.writeMu.Unlock()
+		return err
+	}
+	db.mu.Lock()
+	for _, e := range entries {
+		db.mem.put(e)
+	}
+	full := db.mem.size >= db.o.memtableSize
+	db.mu.Unlock()
+
+	var err error
+	if full {
+		if err = db.flush(); err == nil {
+			err = db.compact()
+		}
+	}
+	db.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	// Wait for durability outside the lock so concurrent writers share a group commit
+	return log.commit()
+}
+
+/**
+FLUSH
+	The full memtable becomes the immutable memtable, still visible to readers, and a new
+	log is started for the writes that follow. The immutable memtable is written to a new
+	level 0 table, then the manifest records the table along with the new log, after which
+	the old log is no longer needed.
+*/
+
+// flush - Must be called with writeMu held
+func (db *DB) flush() error {
+	num := db.nextFile()
+	newLog, err := createWAL(walName(db.dir, num), num, db.o.syncMode, db.o.syncInterval)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	db.imm, db.mem = db.mem, newMemtable()
+	oldLog := db.log
+	db.log = newLog
+	db.mu.Unlock()
+
+	outputs, err := db.writeTables(db.imm.iterator(""), false, false)
+	if err != nil {
+		// Nobody wrote in the meantime, put everything back the way it was
+		db.mu.Lock()
+		db.mem, db.imm, db.log = db.imm, nil, oldLog
+		db.mu.Unlock()
+		newLog.close()
+		os.Remove(walName(db.dir, num))
+		return err
+	}
+
+	db.mu.Lock()
+	db.levels[0] = append(db.levels[0], outputs...)
+	db.imm = nil
+	db.manifest.LogNum = newLog.num
+	err = db.saveManifest()
+	db.flushes++
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	oldLog.close()
+	return os.Remove(walName(db.dir, oldLog.num))
+}
+
+// Put - Insert or replace the value of the key
+func (db *DB) Put(key string, value string) error {
+	return db.write([]entry{{key: key, value: value}})
+}
+
+// Delete - Remove the key, reporting whether it was stored. Keys that aren't stored don't
+// cost a tombstone.
+func (db *DB) Delete(key string) (bool, error) {
+	db.writeMu.Lock()
+	if db.closed {
+		db.writeMu.Unlock()
+		return false, ErrClosed
+	}
+	db.mu.RLock()
+	e, found, err := db.lookup(key)
+	db.mu.RUnlock()
+	if err != nil || !found || e.deleted {
+		db.writeMu.Unlock()
+		return false, err
+	}
+	return true, db.apply([]entry{{key: key, deleted: true}})
+}
+
+// Write - Apply the puts and deletes of the batch in order. The batch is a single log
+// record, after a crash it is replayed entirely or not at all.
+func (db *DB) Write(batch *Batch) error {
+	if len(batch.entries) == 0 {
+		return nil
+	}
+	return db.write(batch.entries)
+}
+
+// Get - Get the stored value of the key
+func (db *DB) Get(key string) (string, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return "", false, ErrClosed
+	}
+	e, found, err := db.lookup(key)
+	if err != nil || !found || e.deleted {
+		return "", false, err
+	}
+	return e.value, true, nil
+}
+
+// lookup - Finds the newest entry of the key, must be called with mu held
+func (db *DB) lookup(key string) (entry, bool, error) {
+	if e, found := db.mem.get(key); found {
+		return e, true, nil
+	}
+	if db.imm != nil {
+		if e, found := db.imm.get(key); found {
+			return e, true, nil
+		}
+	}
+	// Level 0 tables overlap, the newest one holding the key wins
+	for i := len(db.levels[0]) - 1; i >= 0; i-- {
+		if e, found, err := db.levels[0][i].get(key); err != nil || found {
+			return e, found, err
+		}
+	}
+	for _, tables := range db.levels[1:] {
+		i := sort.Search(len(tables), func(i int) bool { return tables[i].meta.Largest >= key })
+		if i < len(tables) && tables[i].meta.Smallest <= key {
+			if e, found, err := tables[i].get(key); err != nil || found {
+				return e, found, err
+			}
+		}
+	}
+	return entry{}, false, nil
+}
+
+// iterator - Merges every memtable and table from start on, must be called with mu held
+func (db *DB) iterator(start string) iterator {
+	inputs := []iterator{db.mem.iterator(start)}
+	if db.imm != nil {
+		inputs = append(inputs, db.imm.iterator(start))
+	}
+	for i := len(db.levels[0]) - 1; i >= 0; i-- {
+		inputs = append(inputs, db.levels[0][i].iterator(start))
+	}
+	for _, tables := range db.levels[1:] {
+		for _, t := range tables {
+			if t.meta.Largest >= start {
+				inputs = append(inputs, t.iterator(start))
+			}
+		}
+	}
+	return newMergingIterator(inputs)
+}
+
+// Scan - Call fn with the pairs whose key is in [start, end) in key order until fn returns
+// false. An empty end scans to the last key. The database is read locked while the scan
+// runs, fn must not write to it.
+func (db *DB) Scan(start string, end string, fn func(key string, value string) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrClosed
+	}
+	it := db.iterator(start)
+	for it.next() {
+		e := it.current()
+		if end != "" && e.key >= end {
+			break
+		}
+		if e.deleted {
+			continue
+		}
+		if !fn(e.key, e.value) {
+			break
+		}
+	}
+	return it.err()
+}
+
+func (db *DB) closeTables() {
+	for _, tables := range db.levels {
+		for _, t := range tables {
+			t.close()
+		}
+	}
+}
+
+// Close - Sync the log and release the directory. The memtable is not flushed, the log
+// holds its content for the next Open.
+func (db *DB) Close() error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+	err := db.log.close()
+	db.closeTables()
+	if closeErr := db.lock.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,271 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openSmall - Opens a database with tiny memtables and tables so a few thousand writes
+// go through flushes and compactions
+func openSmall(t *testing.T, dir string) *DB {
+	db, err := Open(dir, WithMemtableSize(4<<10), WithTableSize(8<<10), WithLevelSize(32<<10), WithL0Trigger(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPutGetDeleteAcrossLevels(t *testing.T) {
+	db := openSmall(t, t.TempDir())
+	defer db.Close()
+	random := rand.New(rand.NewSource(1))
+	total := 3000
+	for _, i := range random.Perm(total) {
+		if err := db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := make(map[int]bool)
+	for n, i := range random.Perm(total) {
+		if n%3 == 0 {
+			continue
+		}
+		found, err := db.Delete(fmt.Sprintf("key-%04d", i))
+		if err != nil || !found {
+			t.Fatal("Delete should find the key", i, err)
+		}
+		deleted[i] = true
+	}
+	if found, err := db.Delete("missing"); err != nil || found {
+		t.Error("Deleting a missing key should report it", err)
+	}
+
+	for i := 0; i < total; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key-%04d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found == deleted[i] {
+			t.Fatal("Get disagrees with the deletes", i, found)
+		}
+		if found && value != fmt.Sprintf("value-%d", i) {
+			t.Fatal("Get returned the wrong value", i, value)
+		}
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Flushes == 0 || stats.Compactions == 0 {
+		t.Error("The writes should have flushed and compacted", stats.Flushes, stats.Compactions)
+	}
+	if stats.Keys != int64(total-len(deleted)) {
+		t.Error("Stats should count the live keys", stats.Keys)
+	}
+}
+
+func TestScanMergesEveryLevel(t *testing.T) {
+	db := openSmall(t, t.TempDir())
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		db.Put(fmt.Sprintf("key-%04d", i), "old")
+	}
+	for i := 0; i < 1000; i += 2 {
+		db.Put(fmt.Sprintf("key-%04d", i), "new")
+	}
+	for i := 0; i < 1000; i += 5 {
+		db.Delete(fmt.Sprintf("key-%04d", i))
+	}
+
+	var keys []string
+	err := db.Scan("key-0100", "key-0200", func(key string, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 80 || keys[0] != "key-0101" || keys[len(keys)-1] != "key-0199" {
+		t.Fatal("Scan returned the wrong keys", len(keys), keys)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i] <= keys[i-1] {
+			t.Fatal("Scan should return keys in order", keys[i-1], keys[i])
+		}
+	}
+	if value, _, _ := db.Get("key-0102"); value != "new" {
+		t.Error("The newest value should win", value)
+	}
+}
+
+func TestReopenReplaysLog(t *testing.T) {
+	dir := t.TempDir()
+	db := openSmall(t, dir)
+	for i := 0; i < 2000; i++ {
+		db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i))
+	}
+	db.Delete("key-0007")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Get("key-0001"); err != ErrClosed {
+		t.Error("A closed database should refuse reads", err)
+	}
+
+	db = openSmall(t, dir)
+	defer db.Close()
+	for i := 0; i < 2000; i++ {
+		value, found, err := db.Get(fmt.Sprintf("key-%04d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 7 {
+			if found {
+				t.Error("The delete should survive a reopen")
+			}
+			continue
+		}
+		if value != fmt.Sprintf("value-%d", i) {
+			t.Fatal("Reopen lost a pair", i, value)
+		}
+	}
+}
+
+func TestOpenLocksDirectory(t *testing.T) {
+	dir := t.TempDir()
+	db := openSmall(t, dir)
+	defer db.Close()
+	if _, err := Open(dir, WithLockTimeout(0)); err == nil {
+		t.Error("A second Open of the directory should fail")
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	db := openSmall(t, t.TempDir())
+	defer db.Close()
+	db.Put("a", "1")
+	batch := &Batch{}
+	batch.Put("b", "2")
+	batch.Delete("a")
+	batch.Put("c", "3")
+	if err := db.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := db.Get("a"); found {
+		t.Error("The batch should delete a")
+	}
+	if value, _, _ := db.Get("c"); value != "3" {
+		t.Error("The batch should insert c", value)
+	}
+
+	bad := &Batch{}
+	bad.Put("d", "4")
+	bad.Put("", "empty")
+	if err := db.Write(bad); err != ErrEmptyKey {
+		t.Error("A batch with an empty key should be refused", err)
+	}
+	if _, found, _ := db.Get("d"); found {
+		t.Error("A refused batch should not be applied")
+	}
+}
+
+func TestWriteLimits(t *testing.T) {
+	dir := t.TempDir()
+	db := openSmall(t, dir)
+	db.Put("a", "1")
+	if err := db.Put("big", strings.Repeat("v", maxStringLength+1)); err != ErrValueTooBig {
+		t.Error("A value too big to be replayed should be refused", err)
+	}
+	if err := db.Put(strings.Repeat("k", maxStringLength+1), "v"); err != ErrKeyTooLong {
+		t.Error("A key too long to be replayed should be refused", err)
+	}
+	db.Put("b", strings.Repeat("v", maxStringLength))
+	db.Put("c", "3")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openSmall(t, dir)
+	defer db.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		if _, found, err := db.Get(key); err != nil || !found {
+			t.Error("Acknowledged writes should survive a reopen", key, err)
+		}
+	}
+}
+
+// walFile - The only log of a closed database
+func walFile(t *testing.T, dir string) string {
+	logs, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil || len(logs) != 1 {
+		t.Fatal("Expected a single log", logs, err)
+	}
+	return logs[0]
+}
+
+func TestReplayCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		db.Put(key, "1")
+	}
+	db.Close()
+
+	// Every record takes 14 bytes, tearing the last one only drops c
+	path := walFile(t, dir)
+	if err := os.Truncate(path, 14*3-1); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal("A torn tail should be cut off", err)
+	}
+	if _, found, _ := db.Get("c"); found {
+		t.Error("The torn record should be dropped")
+	}
+	db.Put("c", "1")
+	db.Put("d", "1")
+	db.Close()
+
+	// Reopening flushed a and b, damaging c which d follows is corruption
+	path = walFile(t, dir)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[walHeaderSize+3] ^= 0xff
+	if err := os.WriteFile(path, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); !errors.Is(err, errCorruptLog) {
+		t.Error("A damaged record in the middle of the log should be reported", err)
+	}
+}
+
+func TestLogsClosed(t *testing.T) {
+	db := openSmall(t, t.TempDir())
+	first := db.log
+	for i := 0; i < 200; i++ {
+		db.Put(fmt.Sprintf("key-%04d", i), fmt.Sprintf("value-%d", i))
+	}
+	if db.flushes == 0 {
+		t.Fatal("The writes should have flushed the memtable")
+	}
+	if err := first.file.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Error("A flushed log should be closed so its space is freed", err)
+	}
+	last := db.log
+	db.Close()
+	if err := last.file.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Error("Close should close the current log", err)
+	}
+}
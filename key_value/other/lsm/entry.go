@@ -0,0 +1,108 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errCorruptEntry = errors.New("corrupt entry")
+
+// entry - A key with its value, or a tombstone recording that the key was deleted
+type entry struct {
+	key     string
+	value   string
+	deleted bool
+}
+
+const (
+	kindPut    = 0
+	kindDelete = 1
+)
+
+// size - Bytes the entry takes in memory, used to decide when the memtable is full
+func (e entry) size() int {
+	return len(e.key) + len(e.value) + 16
+}
+
+/**
+ENTRY ENCODING
+	Entries are stored the same way in the log and in the tables
+		0     kind (put or delete)
+		1:    key length (uvarint), key
+		      value length (uvarint), value
+*/
+
+func appendEntry(buffer []byte, e entry) []byte {
+	kind := byte(kindPut)
+	if e.deleted {
+		kind = kindDelete
+	}
+	buffer = append(buffer, kind)
+	buffer = appendUvarint(buffer, uint64(len(e.key)))
+	buffer = append(buffer, e.key...)
+	buffer = appendUvarint(buffer, uint64(len(e.value)))
+	return append(buffer, e.value...)
+}
+
+func appendUvarint(buffer []byte, value uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], value)
+	return append(buffer, scratch[:n]...)
+}
+
+// byteReader - What entries are decoded from, a bufio.Reader or a bytes.Reader
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readEntry - Reads the next entry, io.EOF means there was none left
+func readEntry(r byteReader) (entry, error) {
+	var e entry
+	kind, err := r.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	if kind != kindPut && kind != kindDelete {
+		return e, errCorruptEntry
+	}
+	e.deleted = kind == kindDelete
+	key, err := readString(r)
+	if err != nil {
+		return e, err
+	}
+	value, err := readString(r)
+	if err != nil {
+		return e, err
+	}
+	e.key, e.value = key, value
+	return e, nil
+}
+
+// maxStringLength - Longest key or value accepted by a write, anything longer is corrupt
+// when decoding
+const maxStringLength = 1 << 20
+
+func readString(r byteReader) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", noEOF(err)
+	}
+	if length > maxStringLength {
+		return "", errCorruptEntry
+	}
+	buffer := make([]byte, length)
+	if _, err := io.ReadFull(r, buffer); err != nil {
+		return "", noEOF(err)
+	}
+	return string(buffer), nil
+}
+
+// noEOF - An entry cut short is corrupt, not the end of the input
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
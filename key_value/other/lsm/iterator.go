@@ -0,0 +1,72 @@
+package lsm
+
+// iterator - Walks entries in key order
+type iterator interface {
+	// next - Moves to the next entry, false once there is none or an error occurred
+	next() bool
+	current() entry
+	err() error
+}
+
+/**
+MERGING ITERATOR
+	Merges iterators ordered from the newest data to the oldest. Every step emits the
+	smallest current key, taken from the newest iterator holding it, and moves every
+	iterator positioned on that key past it so older versions are skipped. Tombstones are
+	emitted like any other entry, the caller decides whether to drop them.
+*/
+
+type mergingIterator struct {
+	inputs  []iterator
+	valid   []bool
+	started bool
+	entry   entry
+	failure error
+}
+
+func newMergingIterator(inputs []iterator) *mergingIterator {
+	return &mergingIterator{inputs: inputs, valid: make([]bool, len(inputs))}
+}
+
+func (it *mergingIterator) advance(i int) {
+	it.valid[i] = it.inputs[i].next()
+	if !it.valid[i] && it.inputs[i].err() != nil && it.failure == nil {
+		it.failure = it.inputs[i].err()
+	}
+}
+
+func (it *mergingIterator) next() bool {
+	if !it.started {
+		it.started = true
+		for i := range it.inputs {
+			it.advance(i)
+		}
+	}
+	if it.failure != nil {
+		return false
+	}
+	newest := -1
+	for i, input := range it.inputs {
+		if it.valid[i] && (newest == -1 || input.current().key < it.inputs[newest].current().key) {
+			newest = i
+		}
+	}
+	if newest == -1 {
+		return false
+	}
+	it.entry = it.inputs[newest].current()
+	for i, input := range it.inputs {
+		if it.valid[i] && input.current().key == it.entry.key {
+			it.advance(i)
+		}
+	}
+	return it.failure == nil
+}
+
+func (it *mergingIterator) current() entry {
+	return it.entry
+}
+
+func (it *mergingIterator) err() error {
+	return it.failure
+}
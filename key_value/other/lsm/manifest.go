@@ -0,0 +1,102 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+/**
+MANIFEST
+	The manifest lists the tables of every level and the log the memtable is rebuilt from.
+	It is rewritten as a whole after every flush and compaction: written to a temporary
+	file, synced and renamed over the previous one, so a crash leaves either the old or
+	the new list. Table and log files share one numbering, files that are newer than the
+	manifest belong to a flush or compaction that never completed.
+*/
+
+const manifestName = "MANIFEST"
+
+// tableMeta - What the manifest records about a table
+type tableMeta struct {
+	Num      uint64 `json:"num"`
+	Smallest string `json:"smallest"`
+	Largest  string `json:"largest"`
+	Size     uint64 `json:"size"`
+	Entries  uint64 `json:"entries"`
+}
+
+type manifest struct {
+	NextFile uint64        `json:"next_file"`
+	LogNum   uint64        `json:"log_num"`
+	Levels   [][]tableMeta `json:"levels"`
+}
+
+func tableName(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.sst", num))
+}
+
+func walName(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.wal", num))
+}
+
+// loadManifest - Reads the manifest of the directory, a new directory gets an empty one
+func loadManifest(dir string) (*manifest, error) {
+	m := &manifest{NextFile: 1, Levels: make([][]tableMeta, numLevels)}
+	buffer, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buffer, m); err != nil {
+		return nil, fmt.Errorf("corrupt manifest: %w", err)
+	}
+	if len(m.Levels) > numLevels {
+		return nil, errors.New("corrupt manifest: too many levels")
+	}
+	for len(m.Levels) < numLevels {
+		m.Levels = append(m.Levels, nil)
+	}
+	return m, nil
+}
+
+func (m *manifest) save(dir string) error {
+	buffer, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, manifestName+".tmp")
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buffer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, manifestName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir - Makes the creation, removal and renaming of files in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,116 @@
+package lsm
+
+/**
+MEMTABLE
+	A skiplist, every entry sits in the bottom list and in each list above it with a chance
+	of one in skipBranching, so an insert or a lookup walks O(log n) nodes. Nodes are only
+	ever added, a replaced entry is overwritten in its node.
+*/
+
+const (
+	skipMaxHeight = 12
+	skipBranching = 4
+)
+
+type skipNode struct {
+	e    entry
+	next []*skipNode
+}
+
+// memtable - The latest writes kept sorted in memory until they are flushed to a table
+type memtable struct {
+	head   *skipNode
+	height int
+	seed   uint64
+	count  int
+	size   int
+}
+
+func newMemtable() *memtable {
+	return &memtable{head: &skipNode{next: make([]*skipNode, skipMaxHeight)}, height: 1, seed: 0x9e3779b97f4a7c15}
+}
+
+// randomHeight - Height of a new node, drawn from a xorshift generator
+func (m *memtable) randomHeight() int {
+	height := 1
+	for height < skipMaxHeight {
+		m.seed ^= m.seed << 13
+		m.seed ^= m.seed >> 7
+		m.seed ^= m.seed << 17
+		if m.seed%skipBranching != 0 {
+			break
+		}
+		height++
+	}
+	return height
+}
+
+// search - The first node whose key is not before key, nil if there is none. When prev is
+// given it is filled with the last node before key in every list.
+func (m *memtable) search(key string, prev []*skipNode) *skipNode {
+	node := m.head
+	for level := m.height - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].e.key < key {
+			node = node.next[level]
+		}
+		if prev != nil {
+			prev[level] = node
+		}
+	}
+	return node.next[0]
+}
+
+// put - Inserts the entry, replacing an older entry of the same key
+func (m *memtable) put(e entry) {
+	var prev [skipMaxHeight]*skipNode
+	node := m.search(e.key, prev[:])
+	if node != nil && node.e.key == e.key {
+		m.size += e.size() - node.e.size()
+		node.e = e
+		return
+	}
+	height := m.randomHeight()
+	for ; m.height < height; m.height++ {
+		prev[m.height] = m.head
+	}
+	node = &skipNode{e: e, next: make([]*skipNode, height)}
+	for level := 0; level < height; level++ {
+		node.next[level] = prev[level].next[level]
+		prev[level].next[level] = node
+	}
+	m.count++
+	m.size += e.size()
+}
+
+func (m *memtable) get(key string) (entry, bool) {
+	if node := m.search(key, nil); node != nil && node.e.key == key {
+		return node.e, true
+	}
+	return entry{}, false
+}
+
+// iterator - Iterates the entries from the first key not before start
+func (m *memtable) iterator(start string) iterator {
+	return &memtableIterator{node: m.search(start, nil)}
+}
+
+type memtableIterator struct {
+	node    *skipNode
+	started bool
+}
+
+func (it *memtableIterator) next() bool {
+	if it.started && it.node != nil {
+		it.node = it.node.next[0]
+	}
+	it.started = true
+	return it.node != nil
+}
+
+func (it *memtableIterator) current() entry {
+	return it.node.e
+}
+
+func (it *memtableIterator) err() error {
+	return nil
+}
@@ -0,0 +1,38 @@
+package lsm
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestMemtableOrder(t *testing.T) {
+	m := newMemtable()
+	random := rand.New(rand.NewSource(38))
+	total := 5000
+	for _, i := range random.Perm(total) {
+		m.put(entry{key: fmt.Sprintf("key-%05d", i), value: "old"})
+	}
+	for i := 0; i < total; i += 2 {
+		m.put(entry{key: fmt.Sprintf("key-%05d", i), value: fmt.Sprint(i)})
+	}
+	if m.count != total {
+		t.Fatal("Replacing an entry should not add one", m.count)
+	}
+	if e, found := m.get("key-00042"); !found || e.value != "42" {
+		t.Error("Get should return the latest entry", e)
+	}
+	if _, found := m.get("key-"); found {
+		t.Error("Found a key that was never stored")
+	}
+
+	it := m.iterator("key-01000")
+	for i := 1000; i < total; i++ {
+		if !it.next() || it.current().key != fmt.Sprintf("key-%05d", i) {
+			t.Fatal("Iterator should walk the keys in order", i)
+		}
+	}
+	if it.next() {
+		t.Error("Iterator should stop after the last key")
+	}
+}
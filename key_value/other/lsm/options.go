@@ -0,0 +1,99 @@
+package lsm
+
+import (
+	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/bloom"
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+// Option - Configures how Open prepares the database directory
+type Option func(*options)
+
+type options struct {
+	memtableSize  int
+	tableSize     uint64
+	baseLevelSize uint64
+	l0Trigger     int
+	bitsPerKey    int
+
+	syncMode     helper.SyncMode
+	syncInterval time.Duration
+	lockTimeout  time.Duration
+}
+
+const (
+	DefaultMemtableSize  = 4 << 20
+	DefaultTableSize     = 2 << 20
+	DefaultBaseLevelSize = 10 << 20
+	// DefaultL0Trigger - Tables in level 0 that start a compaction into level 1
+	DefaultL0Trigger = 4
+)
+
+func buildOptions(opts []Option) *options {
+	o := &options{
+		memtableSize:  DefaultMemtableSize,
+		tableSize:     DefaultTableSize,
+		baseLevelSize: DefaultBaseLevelSize,
+		l0Trigger:     DefaultL0Trigger,
+		bitsPerKey:    bloom.DefaultBitsPerKey,
+		syncMode:      helper.SyncNone,
+		syncInterval:  helper.DefaultSyncInterval,
+		lockTimeout:   helper.DefaultLockTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithMemtableSize - Bytes of writes kept in memory before they are flushed to a table
+func WithMemtableSize(bytes int) Option {
+	return func(o *options) {
+		o.memtableSize = bytes
+	}
+}
+
+// WithTableSize - Size at which compactions start a new table
+func WithTableSize(bytes uint64) Option {
+	return func(o *options) {
+		o.tableSize = bytes
+	}
+}
+
+// WithLevelSize - Size of level 1, every deeper level may hold ten times the one above
+func WithLevelSize(bytes uint64) Option {
+	return func(o *options) {
+		o.baseLevelSize = bytes
+	}
+}
+
+// WithL0Trigger - Number of flushed tables that start a compaction into level 1
+func WithL0Trigger(tables int) Option {
+	return func(o *options) {
+		o.l0Trigger = tables
+	}
+}
+
+// WithBloomBitsPerKey - Size of the bloom filter of new tables, more bits give fewer false
+// positives
+func WithBloomBitsPerKey(bits int) Option {
+	return func(o *options) {
+		o.bitsPerKey = bits
+	}
+}
+
+// WithSync - When writes to the log are flushed to stable storage, see helper.WithSync
+func WithSync(mode helper.SyncMode, interval time.Duration) Option {
+	return func(o *options) {
+		o.syncMode = mode
+		o.syncInterval = interval
+	}
+}
+
+// WithLockTimeout - How long Open waits for another process to release the directory
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = timeout
+	}
+}
@@ -0,0 +1,270 @@
+package lsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/bloom"
+)
+
+/**
+SSTABLE FORMAT
+	Tables are immutable files of entries sorted by key, written once by a flush or a
+	compaction.
+		data    the entries, one after the other
+		index   for every indexInterval-th entry its key (uvarint length, key) and offset (8)
+		filter  bloom filter over every key of the table
+		footer  index offset, filter offset, entry count and tableMagic, 8 bytes each
+	A lookup checks the filter, finds the last indexed key not after the wanted key with a
+	binary search and reads the entries from there up to the next indexed key.
+*/
+
+const (
+	indexInterval = 16
+	footerSize    = 32
+	tableMagic    = 0x4b564c534d544231 // "KVLSMTB1"
+)
+
+var errCorruptTable = errors.New("corrupt table")
+
+type indexEntry struct {
+	key    string
+	offset uint64
+}
+
+// tableWriter - Writes the entries of a new table, which have to be added in key order
+type tableWriter struct {
+	file     *os.File
+	w        *bufio.Writer
+	offset   uint64
+	index    []indexEntry
+	keys     []string
+	smallest string
+	largest  string
+}
+
+func createTable(path string) (*tableWriter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (tw *tableWriter) add(e entry) error {
+	if len(tw.keys)%indexInterval == 0 {
+		tw.index = append(tw.index, indexEntry{key: e.key, offset: tw.offset})
+	}
+	if len(tw.keys) == 0 {
+		tw.smallest = e.key
+	}
+	tw.largest = e.key
+	tw.keys = append(tw.keys, e.key)
+	buffer := appendEntry(nil, e)
+	if _, err := tw.w.Write(buffer); err != nil {
+		return err
+	}
+	tw.offset += uint64(len(buffer))
+	return nil
+}
+
+// size - Bytes written so far
+func (tw *tableWriter) size() uint64 {
+	return tw.offset
+}
+
+// finish - Writes the index, filter and footer and syncs the table
+func (tw *tableWriter) finish(bitsPerKey int) error {
+	indexOffset := tw.offset
+	var index []byte
+	for _, ie := range tw.index {
+		index = appendUvarint(index, uint64(len(ie.key)))
+		index = append(index, ie.key...)
+		var offset [8]byte
+		binary.LittleEndian.PutUint64(offset[:], ie.offset)
+		index = append(index, offset[:]...)
+	}
+	filter := bloom.New(len(tw.keys), bitsPerKey)
+	for _, key := range tw.keys {
+		filter.Add([]byte(key))
+	}
+	filterOffset := indexOffset + uint64(len(index))
+
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer[0:], indexOffset)
+	binary.LittleEndian.PutUint64(footer[8:], filterOffset)
+	binary.LittleEndian.PutUint64(footer[16:], uint64(len(tw.keys)))
+	binary.LittleEndian.PutUint64(footer[24:], tableMagic)
+
+	for _, part := range [][]byte{index, filter.Encode(), footer} {
+		if _, err := tw.w.Write(part); err != nil {
+			return err
+		}
+	}
+	if err := tw.w.Flush(); err != nil {
+		return err
+	}
+	if err := tw.file.Sync(); err != nil {
+		return err
+	}
+	return tw.file.Close()
+}
+
+// abandon - Drops a table that could not be finished
+func (tw *tableWriter) abandon() {
+	tw.file.Close()
+	os.Remove(tw.file.Name())
+}
+
+// table - An open table, its index and filter are kept in memory
+type table struct {
+	meta    tableMeta
+	file    *os.File
+	index   []indexEntry
+	filter  *bloom.Filter
+	dataEnd uint64
+}
+
+func openTable(path string, meta tableMeta) (*table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := readTable(file, meta)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+func readTable(file *os.File, meta tableMeta) (*table, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(fi.Size())
+	if size < footerSize {
+		return nil, errCorruptTable
+	}
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, int64(size-footerSize)); err != nil {
+		return nil, err
+	}
+	indexOffset := binary.LittleEndian.Uint64(footer[0:])
+	filterOffset := binary.LittleEndian.Uint64(footer[8:])
+	if binary.LittleEndian.Uint64(footer[24:]) != tableMagic || indexOffset > filterOffset || filterOffset > size-footerSize {
+		return nil, errCorruptTable
+	}
+
+	trailer := make([]byte, size-footerSize-indexOffset)
+	if _, err := file.ReadAt(trailer, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+	t := &table{meta: meta, file: file, dataEnd: indexOffset}
+	r := bytes.NewReader(trailer[:filterOffset-indexOffset])
+	for r.Len() > 0 {
+		key, err := readString(r)
+		if err != nil {
+			return nil, errCorruptTable
+		}
+		var offset [8]byte
+		if _, err := io.ReadFull(r, offset[:]); err != nil {
+			return nil, errCorruptTable
+		}
+		t.index = append(t.index, indexEntry{key: key, offset: binary.LittleEndian.Uint64(offset[:])})
+	}
+	t.filter, err = bloom.Decode(trailer[filterOffset-indexOffset:])
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// group - Index of the last indexed key not after key, -1 when key sorts before the table
+func (t *table) group(key string) int {
+	return sort.Search(len(t.index), func(i int) bool { return t.index[i].key > key }) - 1
+}
+
+// get - Looks the key up, found is false when the table holds no entry for it
+func (t *table) get(key string) (e entry, found bool, err error) {
+	if !t.filter.MayContain([]byte(key)) {
+		return e, false, nil
+	}
+	i := t.group(key)
+	if i < 0 {
+		return e, false, nil
+	}
+	end := t.dataEnd
+	if i+1 < len(t.index) {
+		end = t.index[i+1].offset
+	}
+	r := bufio.NewReader(io.NewSectionReader(t.file, int64(t.index[i].offset), int64(end-t.index[i].offset)))
+	for {
+		e, err := readEntry(r)
+		if err == io.EOF {
+			return entry{}, false, nil
+		}
+		if err != nil {
+			return entry{}, false, err
+		}
+		if e.key == key {
+			return e, true, nil
+		}
+		if e.key > key {
+			return entry{}, false, nil
+		}
+	}
+}
+
+// iterator - Iterates the entries of the table from the first key not before start
+func (t *table) iterator(start string) iterator {
+	var offset uint64
+	if i := t.group(start); i > 0 {
+		offset = t.index[i].offset
+	}
+	r := bufio.NewReader(io.NewSectionReader(t.file, int64(offset), int64(t.dataEnd-offset)))
+	return &tableIterator{r: r, start: start}
+}
+
+func (t *table) close() error {
+	return t.file.Close()
+}
+
+type tableIterator struct {
+	r       *bufio.Reader
+	start   string
+	entry   entry
+	failure error
+}
+
+func (it *tableIterator) next() bool {
+	for {
+		e, err := readEntry(it.r)
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			it.failure = err
+			return false
+		}
+		if e.key >= it.start {
+			it.entry = e
+			return true
+		}
+	}
+}
+
+func (it *tableIterator) current() entry {
+	return it.entry
+}
+
+func (it *tableIterator) err() error {
+	return it.failure
+}
@@ -0,0 +1,65 @@
+package lsm
+
+// LevelStats - Tables of one level
+type LevelStats struct {
+	Level   int    `json:"level"`
+	Tables  int    `json:"tables"`
+	Bytes   uint64 `json:"bytes"`
+	Entries uint64 `json:"entries"`
+}
+
+// Stats - Figures about the content of an LSM database. Entries of the levels count every
+// version and tombstone stored, Keys only the live keys.
+type Stats struct {
+	Keys                    int64        `json:"keys"`
+	MemtableEntries         int          `json:"memtable_entries"`
+	MemtableBytes           int          `json:"memtable_bytes"`
+	WALBytes                int64        `json:"wal_bytes"`
+	Levels                  []LevelStats `json:"levels"`
+	Flushes                 uint64       `json:"flushes"`
+	Compactions             uint64       `json:"compactions"`
+	FilterFalsePositiveRate float64      `json:"filter_false_positive_rate"`
+}
+
+// Stats - Walks every live key, so its cost grows with the size of the database
+func (db *DB) Stats() (*Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	stats := &Stats{
+		MemtableEntries: db.mem.count,
+		MemtableBytes:   db.mem.size,
+		WALBytes:        db.log.size,
+		Levels:          []LevelStats{},
+		Flushes:         db.flushes,
+		Compactions:     db.compactions,
+	}
+	var filtered uint64
+	for level, tables := range db.levels {
+		if len(tables) == 0 {
+			continue
+		}
+		ls := LevelStats{Level: level, Tables: len(tables)}
+		for _, t := range tables {
+			ls.Bytes += t.meta.Size
+			ls.Entries += t.meta.Entries
+			// Average of the expected rate of every filter, weighted by its keys
+			stats.FilterFalsePositiveRate += t.filter.FalsePositiveRate(int(t.meta.Entries)) * float64(t.meta.Entries)
+			filtered += t.meta.Entries
+		}
+		stats.Levels = append(stats.Levels, ls)
+	}
+	if filtered > 0 {
+		stats.FilterFalsePositiveRate /= float64(filtered)
+	}
+
+	it := db.iterator("")
+	for it.next() {
+		if !it.current().deleted {
+			stats.Keys++
+		}
+	}
+	return stats, it.err()
+}
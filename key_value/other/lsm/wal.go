@@ -0,0 +1,150 @@
+package lsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/abdulmajid18/keyVal/key_value/other/helper"
+)
+
+/**
+WRITE AHEAD LOG
+	Every write is appended to the log before it reaches the memtable, so the memtable can
+	be rebuilt after a crash. One record holds all the entries of a write, a batch is
+	replayed entirely or not at all.
+		0:4   CRC-32 of the payload
+		4:8   payload length
+		8:    payload, the number of entries (uvarint) followed by the entries
+	A record cut short by the end of the log, or the last record failing its checksum, ends
+	the replay, it belongs to a write that was never acknowledged. A record failing its
+	checksum with more records after it is corruption, the writes it held were acknowledged.
+*/
+
+const walHeaderSize = 8
+
+var errCorruptLog = errors.New("corrupt log record")
+
+// wal - The log the current memtable is backed by
+type wal struct {
+	num    uint64
+	file   *os.File
+	syncer *helper.Syncer
+	size   int64
+}
+
+func createWAL(path string, num uint64, mode helper.SyncMode, interval time.Duration) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{num: num, file: file, syncer: helper.NewSyncer(file, mode, interval)}, nil
+}
+
+// append - Writes the entries as one record, commit makes it durable
+func (w *wal) append(entries []entry) error {
+	payload := appendUvarint(nil, uint64(len(entries)))
+	for _, e := range entries {
+		payload = appendEntry(payload, e)
+	}
+	record := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(record[4:], uint32(len(payload)))
+	record = append(record, payload...)
+	if _, err := w.file.Write(record); err != nil {
+		return err
+	}
+	w.size += int64(len(record))
+	return nil
+}
+
+// commit - Waits until the records appended so far are as durable as the sync mode promises.
+// A log closed in the meantime was synced when it was closed.
+func (w *wal) commit() error {
+	err := w.syncer.Commit()
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// close - Syncs and closes the file, a log removed once flushed only frees its space then
+func (w *wal) close() error {
+	err := w.syncer.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// replayWAL - Calls fn with the entries of every complete record of the log
+func replayWAL(path string, fn func(entries []entry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(file)
+	header := make([]byte, walHeaderSize)
+	for offset := int64(0); offset < info.Size(); {
+		remaining := info.Size() - offset
+		if remaining < walHeaderSize {
+			// A partial header is the torn end of the log
+			return nil
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		length := int64(binary.LittleEndian.Uint32(header[4:]))
+		if length > remaining-walHeaderSize {
+			return nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+		end := offset + walHeaderSize + length
+		var entries []entry
+		if crc32.ChecksumIEEE(payload) == binary.LittleEndian.Uint32(header[0:]) {
+			entries, err = decodeRecord(payload)
+		} else {
+			err = errCorruptLog
+		}
+		if err != nil {
+			if end == info.Size() {
+				return nil
+			}
+			return fmt.Errorf("%s: %w at offset %d", path, errCorruptLog, offset)
+		}
+		fn(entries)
+		offset = end
+	}
+	return nil
+}
+
+func decodeRecord(payload []byte) ([]entry, error) {
+	r := bytes.NewReader(payload)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]entry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		e, err := readEntry(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}